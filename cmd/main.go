@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/xiaobailjlj/mocksvr_grpc/cmd/migrate"
 	cmd "github.com/xiaobailjlj/mocksvr_grpc/cmd/root"
 	"github.com/xiaobailjlj/mocksvr_grpc/cmd/server"
 	"github.com/xiaobailjlj/mocksvr_grpc/cmd/version"
@@ -10,6 +11,7 @@ import (
 func main() {
 	// Add commands to root command
 	cmd.RootCmd.AddCommand(server.NewServerCmd())
+	cmd.RootCmd.AddCommand(migrate.NewMigrateCmd())
 	cmd.RootCmd.AddCommand(version.NewVersionCmd())
 
 	// Execute the root command
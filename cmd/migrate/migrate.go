@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	cmd "github.com/xiaobailjlj/mocksvr_grpc/cmd/root"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
+)
+
+// NewMigrateCmd creates the migrate command with its up, down and status subcommands
+func NewMigrateCmd() *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema",
+		Long: `Apply, revert and list the versioned schema migrations built into mocksvr.
+Applied versions are recorded in the schema_migrations table of the configured database.`,
+	}
+
+	var target int
+	upCmd := &cobra.Command{
+		Use:          "up",
+		Short:        "Apply pending migrations",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return withMigrator(func(ctx context.Context, m *storage.Migrator) error {
+				applied, err := m.Up(ctx, target)
+				for _, migration := range applied {
+					fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+				}
+				if err != nil {
+					return err
+				}
+				if len(applied) == 0 {
+					fmt.Println("Schema is up to date")
+				}
+				return nil
+			})
+		},
+	}
+	upCmd.Flags().IntVar(&target, "to", 0, "apply migrations up to this version (default latest)")
+
+	var steps int
+	downCmd := &cobra.Command{
+		Use:          "down",
+		Short:        "Revert the latest applied migrations",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if steps < 1 {
+				return fmt.Errorf("--steps must be at least 1")
+			}
+			return withMigrator(func(ctx context.Context, m *storage.Migrator) error {
+				reverted, err := m.Down(ctx, steps)
+				for _, migration := range reverted {
+					fmt.Printf("Reverted %d_%s\n", migration.Version, migration.Name)
+				}
+				if err != nil {
+					return err
+				}
+				if len(reverted) == 0 {
+					fmt.Println("No migrations to revert")
+				}
+				return nil
+			})
+		},
+	}
+	downCmd.Flags().IntVar(&steps, "steps", 1, "number of migrations to revert")
+
+	statusCmd := &cobra.Command{
+		Use:          "status",
+		Short:        "List migrations and whether they are applied",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return withMigrator(func(ctx context.Context, m *storage.Migrator) error {
+				statuses, err := m.Status(ctx)
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+				for _, status := range statuses {
+					state, appliedAt := "pending", ""
+					if status.Applied {
+						state, appliedAt = "applied", status.AppliedAt.Format("2006-01-02 15:04:05")
+					}
+					fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+				}
+				return w.Flush()
+			})
+		},
+	}
+
+	migrateCmd.AddCommand(upCmd, downCmd, statusCmd)
+	return migrateCmd
+}
+
+// withMigrator opens the configured database and runs fn with a Migrator for it
+func withMigrator(fn func(ctx context.Context, m *storage.Migrator) error) error {
+	cfg := cmd.GetConfig()
+	store, err := storage.New(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	m, err := storage.NewMigrator(store)
+	if err != nil {
+		return err
+	}
+	return fn(context.Background(), m)
+}
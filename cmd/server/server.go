@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"strconv"
@@ -36,18 +38,39 @@ func runServer() {
 	// Set Gin mode based on config
 	gin.SetMode(getGinMode(cfg.Server.RunMode))
 
-	// Initialize database connection
-	mysqlStorage, err := storage.NewMySQLStorage(cfg.Database.DSN)
+	// Initialize storage
+	store, err := storage.New(cfg.Database)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
-	defer mysqlStorage.Close()
-	logger.Info("Successfully connected to database")
+	defer store.Close()
+	logger.Info("Successfully connected to database",
+		zap.String("driver", cfg.Database.Driver))
+
+	if err := checkSchema(store, cfg.Database.AutoMigrate); err != nil {
+		logger.Fatal("Database schema is not ready", zap.Error(err))
+	}
 
 	// Initialize services and handlers
-	mockService := service.NewMockService(mysqlStorage)
+	mockService := service.NewMockService(store, cfg.MockHTTP.JournalSize)
 	stubHandler := handler.NewStubHandler(mockService)
-	httpHandler := handler.NewHTTPHandler(mockService)
+	httpHandler := handler.NewHTTPHandler(mockService, cfg.MockHTTP.Proxy)
+	if cfg.RouteCache.Enabled {
+		mockService.EnableRouteCache(context.Background(), cfg.RouteCache.RefreshInterval)
+		logger.Info("Route cache enabled",
+			zap.Duration("refresh_interval", cfg.RouteCache.RefreshInterval))
+	}
+
+	// Import stubs from files before serving them
+	if cfg.StubFiles.Dir != "" {
+		stubDir := handler.NewStubDir(mockService, cfg.StubFiles.Dir)
+		if err := stubDir.Sync(context.Background()); err != nil {
+			logger.Fatal("Failed to import stub files", zap.Error(err))
+		}
+		if cfg.StubFiles.Watch {
+			go stubDir.Watch(context.Background())
+		}
+	}
 
 	// Start servers
 	go startStubManagementServer(stubHandler, cfg.Management.Port)
@@ -64,6 +87,42 @@ func runServer() {
 	select {} // Block forever
 }
 
+// checkSchema refuses a database schema older than the migrations of this build, or
+// applies the pending migrations when autoMigrate is set
+func checkSchema(store storage.Storage, autoMigrate bool) error {
+	migrator, err := storage.NewMigrator(store)
+	if err == storage.ErrNoSchema {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	latest := migrator.Latest()
+	switch {
+	case version > latest:
+		logger.Warn("Database schema is newer than this build",
+			zap.Int("version", version),
+			zap.Int("latest", latest))
+		return nil
+	case version < latest && !autoMigrate:
+		return fmt.Errorf("schema is at version %d but this build needs %d; run `mocksvr migrate up` or set database.auto_migrate", version, latest)
+	case version < latest:
+		if _, err := migrator.Up(ctx, 0); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Database schema is up to date",
+		zap.Int("version", latest))
+	return nil
+}
+
 // MyBenchLogger is a middleware for benchmark endpoint logging
 func MyBenchLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -92,7 +151,7 @@ func getGinMode(runMode string) string {
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
@@ -119,15 +178,102 @@ func startStubManagementServer(stubHandler *handler.StubHandler, port int) {
 		v1.POST("/new", func(c *gin.Context) {
 			stubHandler.CreateStubGin(c)
 		})
+		v1.PUT("/update", func(c *gin.Context) {
+			stubHandler.UpdateStubGin(c)
+		})
+		v1.PATCH("/update", func(c *gin.Context) {
+			stubHandler.PatchStubGin(c)
+		})
 		v1.DELETE("/delete", func(c *gin.Context) {
 			stubHandler.DeleteStubGin(c)
 		})
+		v1.POST("/activate", func(c *gin.Context) {
+			stubHandler.ActivateStubGin(c)
+		})
+		v1.POST("/deactivate", func(c *gin.Context) {
+			stubHandler.DeactivateStubGin(c)
+		})
+		v1.GET("/query/deleted", func(c *gin.Context) {
+			stubHandler.GetDeletedStubsGin(c)
+		})
+		v1.POST("/restore", func(c *gin.Context) {
+			stubHandler.RestoreStubGin(c)
+		})
+		v1.DELETE("/purge", func(c *gin.Context) {
+			stubHandler.PurgeStubGin(c)
+		})
 		v1.GET("/query/all", func(c *gin.Context) {
 			stubHandler.GetAllStubsGin(c)
 		})
 		v1.GET("/query/rule", func(c *gin.Context) {
 			stubHandler.GetRulesGin(c)
 		})
+		v1.GET("/rule/query", func(c *gin.Context) {
+			stubHandler.GetRuleByIDGin(c)
+		})
+		v1.POST("/rule/new", func(c *gin.Context) {
+			stubHandler.CreateRuleGin(c)
+		})
+		v1.PUT("/rule/update", func(c *gin.Context) {
+			stubHandler.UpdateRuleGin(c)
+		})
+		v1.PATCH("/rule/update", func(c *gin.Context) {
+			stubHandler.PatchRuleGin(c)
+		})
+		v1.DELETE("/rule/delete", func(c *gin.Context) {
+			stubHandler.DeleteRuleGin(c)
+		})
+		v1.POST("/rule/activate", func(c *gin.Context) {
+			stubHandler.ActivateRuleGin(c)
+		})
+		v1.POST("/rule/deactivate", func(c *gin.Context) {
+			stubHandler.DeactivateRuleGin(c)
+		})
+		v1.GET("/revision/all", func(c *gin.Context) {
+			stubHandler.GetRevisionsGin(c)
+		})
+		v1.GET("/revision/query", func(c *gin.Context) {
+			stubHandler.GetRevisionGin(c)
+		})
+		v1.GET("/revision/diff", func(c *gin.Context) {
+			stubHandler.DiffRevisionsGin(c)
+		})
+		v1.POST("/revision/rollback", func(c *gin.Context) {
+			stubHandler.RollbackStubGin(c)
+		})
+		v1.POST("/rule/reorder", func(c *gin.Context) {
+			stubHandler.ReorderRulesGin(c)
+		})
+		v1.GET("/scenario/query", func(c *gin.Context) {
+			stubHandler.GetScenariosGin(c)
+		})
+		v1.POST("/scenario/reset", func(c *gin.Context) {
+			stubHandler.ResetScenariosGin(c)
+		})
+		v1.POST("/record/start", func(c *gin.Context) {
+			stubHandler.StartRecordingGin(c)
+		})
+		v1.POST("/record/stop", func(c *gin.Context) {
+			stubHandler.StopRecordingGin(c)
+		})
+		v1.GET("/record/status", func(c *gin.Context) {
+			stubHandler.GetRecordingGin(c)
+		})
+		v1.POST("/journal/query", func(c *gin.Context) {
+			stubHandler.QueryJournalGin(c)
+		})
+		v1.POST("/journal/count", func(c *gin.Context) {
+			stubHandler.CountJournalGin(c)
+		})
+		v1.DELETE("/journal/clear", func(c *gin.Context) {
+			stubHandler.ClearJournalGin(c)
+		})
+		v1.GET("/unmatched/query", func(c *gin.Context) {
+			stubHandler.GetUnmatchedRequestsGin(c)
+		})
+		v1.GET("/cache/stats", func(c *gin.Context) {
+			stubHandler.GetRouteCacheStatsGin(c)
+		})
 	}
 
 	// Add benchmark endpoint
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("release")
+	os.Exit(m.Run())
+}
+
+func TestCheckSchema(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewSQLiteStorage(storage.SQLiteScheme + filepath.Join(t.TempDir(), "mocksvr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	migrator, err := storage.NewMigrator(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrator.Latest()
+	if _, err := migrator.Up(ctx, latest-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkSchema(store, false); err == nil {
+		t.Error("checkSchema accepted an old schema without auto_migrate")
+	}
+	if v, err := migrator.Version(ctx); err != nil || v != latest-1 {
+		t.Errorf("after a refused check, Version() = %d, %v, want %d", v, err, latest-1)
+	}
+
+	if err := checkSchema(store, true); err != nil {
+		t.Fatalf("checkSchema with auto_migrate: %v", err)
+	}
+	if v, err := migrator.Version(ctx); err != nil || v != latest {
+		t.Errorf("after auto_migrate, Version() = %d, %v, want %d", v, err, latest)
+	}
+	if err := checkSchema(store, false); err != nil {
+		t.Errorf("checkSchema of an up to date schema: %v", err)
+	}
+
+	if err := checkSchema(storage.NewMemoryStorage(), false); err != nil {
+		t.Errorf("checkSchema of memory storage: %v", err)
+	}
+}
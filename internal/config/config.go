@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Config represents the application configuration
 type Config struct {
 	Server     ServerConfig     `mapstructure:"server"`
@@ -7,6 +9,8 @@ type Config struct {
 	Management ManagementConfig `mapstructure:"management"`
 	MockHTTP   MockHTTPConfig   `mapstructure:"mockhttp"`
 	MockGRPC   MockGRPCConfig   `mapstructure:"mockgrpc"`
+	StubFiles  StubFilesConfig  `mapstructure:"stub_files"`
+	RouteCache RouteCacheConfig `mapstructure:"route_cache"`
 }
 
 // ServerConfig contains general server settings
@@ -14,9 +18,15 @@ type ServerConfig struct {
 	RunMode string `mapstructure:"runmode"`
 }
 
-// DatabaseConfig contains database connection settings
+// DatabaseConfig contains database connection settings. Driver selects the storage
+// backend: mysql, sqlite, or memory, which keeps stubs in process memory until the server
+// stops and ignores DSN. Without a driver, a DSN like sqlite://mocksvr.db selects sqlite
+// and any other DSN mysql. The server refuses to start on a mysql or sqlite schema older
+// than its migrations unless AutoMigrate is set, which applies them.
 type DatabaseConfig struct {
-	DSN string `mapstructure:"dsn"`
+	Driver      string `mapstructure:"driver"`
+	DSN         string `mapstructure:"dsn"`
+	AutoMigrate bool   `mapstructure:"auto_migrate"`
 }
 
 // ManagementConfig contains stub management server settings
@@ -26,7 +36,23 @@ type ManagementConfig struct {
 
 // MockHTTPConfig contains HTTP mock server settings
 type MockHTTPConfig struct {
-	Port int `mapstructure:"port"`
+	Port        int         `mapstructure:"port"`
+	Proxy       ProxyConfig `mapstructure:"proxy"`
+	JournalSize int         `mapstructure:"journal_size"`
+}
+
+// ProxyConfig contains the upstreams that requests matching no stub are forwarded to.
+// The route with the longest matching prefix wins, then Upstream. Without either,
+// unmatched requests are not forwarded.
+type ProxyConfig struct {
+	Upstream string       `mapstructure:"upstream"`
+	Routes   []ProxyRoute `mapstructure:"routes"`
+}
+
+// ProxyRoute forwards unmatched requests whose path starts with Prefix to Upstream
+type ProxyRoute struct {
+	Prefix   string `mapstructure:"prefix"`
+	Upstream string `mapstructure:"upstream"`
 }
 
 // MockGRPCConfig contains gRPC mock server settings
@@ -34,3 +60,18 @@ type MockGRPCConfig struct {
 	Port    int  `mapstructure:"port"`
 	Enabled bool `mapstructure:"enabled"`
 }
+
+// StubFilesConfig points at a directory of YAML or JSON stub definitions that are imported
+// at startup. With Watch set, changed files are imported again while the server runs.
+type StubFilesConfig struct {
+	Dir   string `mapstructure:"dir"`
+	Watch bool   `mapstructure:"watch"`
+}
+
+// RouteCacheConfig enables the in-memory routing table that mock requests are matched
+// against. Writes through this server invalidate it right away; RefreshInterval bounds how
+// long changes made by other servers sharing the database take to show, 0 to never refresh.
+type RouteCacheConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
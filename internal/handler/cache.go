@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+// GetRouteCacheStatsGin reports the hits and misses of the route cache
+func (h *StubHandler) GetRouteCacheStatsGin(c *gin.Context) {
+	resp, err := h.mockService.GetRouteCacheStats(c, &pb.GetRouteCacheStatsRequest{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
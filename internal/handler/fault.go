@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// dripInterval is how often the drip fault writes the next part of the body
+const dripInterval = 100 * time.Millisecond
+
+// writeFault answers a request with the given fault instead of a well-formed response.
+// The response headers must already be set on w.
+func writeFault(w http.ResponseWriter, r *http.Request, fault string, bandwidth int32, code int, body string) error {
+	switch fault {
+	case model.FaultConnectionReset:
+		conn, _, err := hijack(w)
+		if err != nil {
+			return err
+		}
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			// A zero linger makes Close send RST instead of FIN
+			tcpConn.SetLinger(0)
+		}
+		return conn.Close()
+
+	case model.FaultEmptyResponse:
+		conn, _, err := hijack(w)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case model.FaultMalformedBody:
+		garbage := make([]byte, len(body))
+		if len(garbage) < 16 {
+			garbage = make([]byte, 16)
+		}
+		if _, err := rand.Read(garbage); err != nil {
+			return err
+		}
+		w.WriteHeader(code)
+		_, err := w.Write(garbage)
+		return err
+
+	case model.FaultTruncatedBody:
+		conn, bufrw, err := hijack(w)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		// Announce at least one byte, so that an empty body is cut short as well
+		length := len(body)
+		if length == 0 {
+			length = 1
+		}
+		header := w.Header().Clone()
+		header.Set("Content-Length", strconv.Itoa(length))
+		fmt.Fprintf(bufrw, "HTTP/1.1 %d %s\r\n", code, http.StatusText(code))
+		header.Write(bufrw)
+		bufrw.WriteString("\r\n")
+		bufrw.WriteString(body[:len(body)/2])
+		return bufrw.Flush()
+
+	case model.FaultHang:
+		<-r.Context().Done()
+		return nil
+
+	case model.FaultDrip:
+		return drip(w, r, bandwidth, code, body)
+
+	default:
+		return fmt.Errorf("unknown fault %q", fault)
+	}
+}
+
+// drip writes the body in small parts so that it arrives at about bandwidth bytes per
+// second, stopping early when the client goes away
+func drip(w http.ResponseWriter, r *http.Request, bandwidth int32, code int, body string) error {
+	chunk := int(bandwidth) * int(dripInterval) / int(time.Second)
+	if chunk < 1 {
+		chunk = 1
+	}
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(code)
+
+	ticker := time.NewTicker(dripInterval)
+	defer ticker.Stop()
+	for len(body) > 0 {
+		n := chunk
+		if n > len(body) {
+			n = len(body)
+		}
+		if _, err := w.Write([]byte(body[:n])); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		body = body[n:]
+		if len(body) == 0 {
+			break
+		}
+
+		select {
+		case <-r.Context().Done():
+			logger.Debug("Client went away during drip",
+				zap.Int("remaining", len(body)))
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// faultResponseCode returns the status code a fault sends to the client, empty for the
+// faults that send no response
+func faultResponseCode(fault string, code int) string {
+	switch fault {
+	case model.FaultConnectionReset, model.FaultEmptyResponse, model.FaultHang:
+		return ""
+	default:
+		return strconv.Itoa(code)
+	}
+}
+
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
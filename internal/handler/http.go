@@ -1,13 +1,19 @@
 package handler
 
 import (
-	"context"
+	"bufio"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/config"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
 	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
@@ -16,10 +22,14 @@ import (
 
 type HTTPHandler struct {
 	mockService *service.MockService
+	proxy       *upstreamProxy
 }
 
-func NewHTTPHandler(mockService *service.MockService) *HTTPHandler {
-	return &HTTPHandler{mockService: mockService}
+func NewHTTPHandler(mockService *service.MockService, proxyCfg config.ProxyConfig) *HTTPHandler {
+	return &HTTPHandler{
+		mockService: mockService,
+		proxy:       newUpstreamProxy(proxyCfg),
+	}
 }
 
 // ServeMock handles the legacy HTTP request (kept for compatibility)
@@ -30,17 +40,60 @@ func (h *HTTPHandler) ServeMock(w http.ResponseWriter, r *http.Request) {
 		body = string(bodyBytes)
 	}
 
-	resp, err := h.mockService.GetMockResponse(context.Background(), &pb.MockRequest{
-		Url:         r.URL.Path,
-		RequestBody: body,
-		QueryParams: r.URL.RawQuery,
+	entry := newJournalEntry(r, body)
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		// A hijacked connection writes nothing through w, and the fault sets the code
+		if sw.status != 0 && entry.Fault == "" {
+			entry.ResponseCode = strconv.Itoa(sw.status)
+		}
+		h.mockService.RecordRequest(entry)
+	}()
+
+	if target, ok := h.mockService.RecordingTarget(r.URL.Path); ok {
+		entry.Upstream = target
+		h.proxy.record(w, r, target, body, h.mockService)
+		return
+	}
+
+	resp, err := h.mockService.GetMockResponse(r.Context(), &pb.MockRequest{
+		Url:           r.URL.Path,
+		Method:        r.Method,
+		RequestBody:   body,
+		QueryParams:   r.URL.RawQuery,
+		RequestHeader: encodeRequestHeader(r.Header),
 	})
 
 	if err != nil {
+		if r.Context().Err() != nil {
+			// The client gave up while the response was delayed
+			return
+		}
+		if errors.Is(err, service.ErrNoMatch) {
+			entry.Unmatched = true
+			if upstream := h.proxy.upstreamFor(r.URL.Path); upstream != "" {
+				entry.Upstream = upstream
+				h.proxy.forward(w, r, upstream, body)
+				return
+			}
+			entry.ResponseCode = strconv.Itoa(http.StatusNotFound)
+			http.Error(w, mockMissMessage(r), http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	entry.InterfaceID = resp.InterfaceId
+	entry.RuleID = resp.RuleId
+	if resp.ProxyUrl != "" {
+		entry.Upstream = resp.ProxyUrl
+		h.proxy.forward(w, r, resp.ProxyUrl, body)
+		return
+	}
+	entry.ResponseCode = resp.ResponseCode
+
 	var headers map[string]string
 	if err := json.Unmarshal([]byte(resp.ResponseHeader), &headers); err == nil {
 		for k, v := range headers {
@@ -51,15 +104,59 @@ func (h *HTTPHandler) ServeMock(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Response with code:",
 		zap.String("ResponseCode", resp.ResponseCode))
 
-	if code, err := strconv.Atoi(resp.ResponseCode); err == nil {
-		w.WriteHeader(code)
-	} else {
-		w.WriteHeader(http.StatusOK)
+	code := http.StatusOK
+	if codeInt, err := strconv.Atoi(resp.ResponseCode); err == nil {
+		code = codeInt
 	}
 
+	if resp.Fault != "" {
+		entry.Fault = resp.Fault
+		entry.ResponseCode = faultResponseCode(resp.Fault, code)
+		if err := writeFault(w, r, resp.Fault, resp.FaultBandwidth, code, resp.ResponseBody); err != nil {
+			logger.Error("Failed to inject fault",
+				zap.String("fault", resp.Fault),
+				zap.Error(err))
+		}
+		return
+	}
+
+	w.WriteHeader(code)
 	w.Write([]byte(resp.ResponseBody))
 }
 
+// statusWriter remembers the status code written through a ResponseWriter, as gin's
+// writer does, so the legacy handler can journal proxied and failed responses
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets proxied and dripped responses stream through the writer
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets faults take over the connection through the writer
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
 // ServeMockGin handles the Gin version of mock serving
 func (h *HTTPHandler) ServeMockGin(c *gin.Context) {
 	var body string
@@ -68,17 +165,60 @@ func (h *HTTPHandler) ServeMockGin(c *gin.Context) {
 		body = string(bodyBytes)
 	}
 
-	resp, err := h.mockService.GetMockResponse(c, &pb.MockRequest{
-		Url:         c.Request.URL.Path,
-		RequestBody: body,
-		QueryParams: c.Request.URL.RawQuery,
+	entry := newJournalEntry(c.Request, body)
+	defer func() {
+		// A hijacked connection looks written with status 200 whatever the fault sent
+		if c.Writer.Written() && entry.Fault == "" {
+			entry.ResponseCode = strconv.Itoa(c.Writer.Status())
+		}
+		h.mockService.RecordRequest(entry)
+	}()
+
+	if target, ok := h.mockService.RecordingTarget(c.Request.URL.Path); ok {
+		entry.Upstream = target
+		h.proxy.record(c.Writer, c.Request, target, body, h.mockService)
+		return
+	}
+
+	resp, err := h.mockService.GetMockResponse(c.Request.Context(), &pb.MockRequest{
+		Url:           c.Request.URL.Path,
+		Method:        c.Request.Method,
+		RequestBody:   body,
+		QueryParams:   c.Request.URL.RawQuery,
+		RequestHeader: encodeRequestHeader(c.Request.Header),
 	})
 
 	if err != nil {
+		if c.Request.Context().Err() != nil {
+			// The client gave up while the response was delayed
+			return
+		}
+		if errors.Is(err, service.ErrNoMatch) {
+			entry.Unmatched = true
+			if upstream := h.proxy.upstreamFor(c.Request.URL.Path); upstream != "" {
+				entry.Upstream = upstream
+				h.proxy.forward(c.Writer, c.Request, upstream, body)
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  mockMissMessage(c.Request),
+				"method": c.Request.Method,
+				"url":    c.Request.URL.Path,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	entry.InterfaceID = resp.InterfaceId
+	entry.RuleID = resp.RuleId
+	if resp.ProxyUrl != "" {
+		entry.Upstream = resp.ProxyUrl
+		h.proxy.forward(c.Writer, c.Request, resp.ProxyUrl, body)
+		return
+	}
+
 	var headers map[string]string
 	if err := json.Unmarshal([]byte(resp.ResponseHeader), &headers); err == nil {
 		for k, v := range headers {
@@ -94,5 +234,54 @@ func (h *HTTPHandler) ServeMockGin(c *gin.Context) {
 		code = codeInt
 	}
 
+	if resp.Fault != "" {
+		entry.Fault = resp.Fault
+		entry.ResponseCode = faultResponseCode(resp.Fault, code)
+		if err := writeFault(c.Writer, c.Request, resp.Fault, resp.FaultBandwidth, code, resp.ResponseBody); err != nil {
+			logger.Error("Failed to inject fault",
+				zap.String("fault", resp.Fault),
+				zap.Error(err))
+		}
+		return
+	}
+
 	c.Data(code, "application/json", []byte(resp.ResponseBody))
 }
+
+// encodeRequestHeader flattens the incoming headers into the JSON form carried by MockRequest.
+// Repeated headers are joined with ", " as allowed by RFC 7230.
+func encodeRequestHeader(header http.Header) string {
+	headerJSON, err := json.Marshal(flattenHeader(header))
+	if err != nil {
+		logger.Warn("Failed to marshal request header",
+			zap.Error(err))
+		return ""
+	}
+	return string(headerJSON)
+}
+
+// flattenHeader joins repeated header values with ", " as allowed by RFC 7230
+func flattenHeader(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for k, v := range header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	return headers
+}
+
+// mockMissMessage explains a request that matched no stub and where to find out why
+func mockMissMessage(r *http.Request) string {
+	return "no stub matches " + r.Method + " " + r.URL.Path + ", see /v1/url/unmatched/query for the closest stubs"
+}
+
+// newJournalEntry records the parts of a request kept in the request journal
+func newJournalEntry(r *http.Request, body string) *model.JournalEntry {
+	return &model.JournalEntry{
+		Time:          time.Now(),
+		Method:        r.Method,
+		URL:           r.URL.Path,
+		QueryParams:   r.URL.RawQuery,
+		RequestHeader: flattenHeader(r.Header),
+		RequestBody:   body,
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/config"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+func TestServeMockJournalsForwardedResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer upstream.Close()
+
+	mockService := service.NewMockService(storage.NewMemoryStorage(), 10)
+	h := NewHTTPHandler(mockService, config.ProxyConfig{Upstream: upstream.URL})
+	rec := httptest.NewRecorder()
+	h.ServeMock(rec, httptest.NewRequest("GET", "/unmatched", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("ServeMock answered %d, want the upstream's %d", rec.Code, http.StatusTeapot)
+	}
+
+	journal, err := mockService.QueryJournal(context.Background(), &pb.JournalCriteria{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.Entries) != 1 || journal.Entries[0].ResponseCode != "418" || journal.Entries[0].Upstream != upstream.URL {
+		t.Errorf("journal = %v, want the forwarded request answered with 418", journal.Entries)
+	}
+}
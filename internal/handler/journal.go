@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+// QueryJournalGin returns the journaled mock server requests matching the criteria, newest first
+func (h *StubHandler) QueryJournalGin(c *gin.Context) {
+	pbReq, ok := bindJournalCriteria(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.mockService.QueryJournal(c, pbReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CountJournalGin returns the number of journaled mock server requests matching the criteria
+func (h *StubHandler) CountJournalGin(c *gin.Context) {
+	pbReq, ok := bindJournalCriteria(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.mockService.CountJournal(c, pbReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *StubHandler) ClearJournalGin(c *gin.Context) {
+	resp, err := h.mockService.ClearJournal(c, &pb.ClearJournalRequest{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// bindJournalCriteria reads journal criteria from the request body. An empty body matches
+// every request. On failure the error response has been written and ok is false.
+func bindJournalCriteria(c *gin.Context) (*pb.JournalCriteria, bool) {
+	var req model.JournalCriteria
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+			return nil, false
+		}
+	}
+
+	if err := service.ValidateJournalCriteria(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid criteria: " + err.Error()})
+		return nil, false
+	}
+
+	pbReq := &pb.JournalCriteria{
+		Method:      req.Method,
+		Url:         req.URL,
+		UrlType:     req.URLType,
+		InterfaceId: req.InterfaceID,
+		RuleId:      req.RuleID,
+		Limit:       req.Limit,
+	}
+	for _, cond := range req.Conditions {
+		pbReq.Conditions = append(pbReq.Conditions, &pb.Condition{
+			MatchType: cond.MatchType,
+			MatchRule: cond.MatchRule,
+		})
+	}
+	if !req.Since.IsZero() {
+		pbReq.Since = req.Since.Format(time.RFC3339Nano)
+	}
+	if !req.Until.IsZero() {
+		pbReq.Until = req.Until.Format(time.RFC3339Nano)
+	}
+	return pbReq, true
+}
+
+// GetUnmatchedRequestsGin lists recent requests that matched no stub together with the
+// stubs that came closest. The limit and candidates query parameters cap the number of
+// requests and of near misses per request.
+func (h *StubHandler) GetUnmatchedRequestsGin(c *gin.Context) {
+	pbReq := &pb.GetUnmatchedRequestsRequest{}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			pbReq.Limit = int32(l)
+		}
+	}
+	if candidatesStr := c.Query("candidates"); candidatesStr != "" {
+		if n, err := strconv.Atoi(candidatesStr); err == nil && n > 0 {
+			pbReq.Candidates = int32(n)
+		}
+	}
+
+	resp, err := h.mockService.GetUnmatchedRequests(c, pbReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/config"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	"go.uber.org/zap"
+)
+
+// upstreamProxy forwards requests the mock server does not answer itself to real services
+type upstreamProxy struct {
+	cfg config.ProxyConfig
+
+	// proxies holds a reverse proxy per upstream URL
+	proxies sync.Map
+	// recorders holds a recording reverse proxy per recording target
+	recorders sync.Map
+}
+
+func newUpstreamProxy(cfg config.ProxyConfig) *upstreamProxy {
+	return &upstreamProxy{cfg: cfg}
+}
+
+// upstreamFor returns the configured upstream for a request path that matches no stub,
+// or an empty string when such requests are not forwarded
+func (p *upstreamProxy) upstreamFor(path string) string {
+	upstream, longest := p.cfg.Upstream, -1
+	for _, route := range p.cfg.Routes {
+		if strings.HasPrefix(path, route.Prefix) && len(route.Prefix) > longest {
+			upstream, longest = route.Upstream, len(route.Prefix)
+		}
+	}
+	return upstream
+}
+
+// forward sends the request to upstream and copies its response back. body is the
+// request body, which has already been read from r.
+func (p *upstreamProxy) forward(w http.ResponseWriter, r *http.Request, upstream, body string) {
+	proxy, err := p.reverseProxy(upstream)
+	if err != nil {
+		logger.Error("Invalid proxy upstream",
+			zap.String("upstream", upstream),
+			zap.Error(err))
+		http.Error(w, "invalid proxy upstream: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	logger.Info("Forwarding request to upstream",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("upstream", upstream))
+
+	r.Body = io.NopCloser(strings.NewReader(body))
+	r.ContentLength = int64(len(body))
+	proxy.ServeHTTP(w, r)
+}
+
+func (p *upstreamProxy) reverseProxy(upstream string) (*httputil.ReverseProxy, error) {
+	if proxy, ok := p.proxies.Load(upstream); ok {
+		return proxy.(*httputil.ReverseProxy), nil
+	}
+
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("Failed to forward request to upstream",
+				zap.String("path", r.URL.Path),
+				zap.String("upstream", upstream),
+				zap.Error(err))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	p.proxies.Store(upstream, proxy)
+	return proxy, nil
+}
+
+// recordedExchangeKey is the request context key of the exchange being recorded
+type recordedExchangeKey struct{}
+
+// record forwards the request to target like forward, and saves the exchange as a stub
+// through the mock service
+func (p *upstreamProxy) record(w http.ResponseWriter, r *http.Request, target, body string, mockService *service.MockService) {
+	proxy, err := p.recordingProxy(target, mockService)
+	if err != nil {
+		http.Error(w, "invalid recording target: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	exchange := &model.RecordedExchange{
+		Method:        r.Method,
+		URL:           r.URL.Path,
+		QueryParams:   r.URL.RawQuery,
+		RequestHeader: flattenHeader(r.Header),
+		RequestBody:   body,
+	}
+
+	logger.Info("Recording request",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("target", target))
+
+	r = r.WithContext(context.WithValue(r.Context(), recordedExchangeKey{}, exchange))
+	r.Body = io.NopCloser(strings.NewReader(body))
+	r.ContentLength = int64(len(body))
+	proxy.ServeHTTP(w, r)
+}
+
+// recordingProxy returns the reverse proxy that records exchanges with target, which
+// finds the exchange of each request in its context
+func (p *upstreamProxy) recordingProxy(target string, mockService *service.MockService) (*httputil.ReverseProxy, error) {
+	if proxy, ok := p.recorders.Load(target); ok {
+		return proxy.(*httputil.ReverseProxy), nil
+	}
+
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(targetURL)
+			pr.SetXForwarded()
+			// Ask for an uncompressed response so the recorded body is readable
+			pr.Out.Header.Del("Accept-Encoding")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			exchange, ok := resp.Request.Context().Value(recordedExchangeKey{}).(*model.RecordedExchange)
+			if !ok {
+				return nil
+			}
+
+			respBody, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+			exchange.ResponseCode = strconv.Itoa(resp.StatusCode)
+			exchange.ResponseHeader = flattenHeader(resp.Header)
+			exchange.ResponseBody = string(respBody)
+
+			// The client is answered either way, so a failure is only logged
+			if err := mockService.RecordExchange(context.Background(), exchange); err != nil {
+				logger.Error("Failed to record exchange",
+					zap.String("method", exchange.Method),
+					zap.String("url", exchange.URL),
+					zap.Error(err))
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("Failed to forward request to recording target",
+				zap.String("path", r.URL.Path),
+				zap.String("target", target),
+				zap.Error(err))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	p.recorders.Store(target, proxy)
+	return proxy, nil
+}
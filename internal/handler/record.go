@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+// StartRecordingGin starts forwarding mock server requests to a real service and saving
+// the exchanges as stubs
+func (h *StubHandler) StartRecordingGin(c *gin.Context) {
+	var req model.RecordingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if err := service.ValidateProxyURL(req.Target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target: " + err.Error()})
+		return
+	}
+
+	pbReq := &pb.StartRecordingRequest{
+		Target:       req.Target,
+		Prefix:       req.Prefix,
+		Owner:        req.Owner,
+		MatchQuery:   req.MatchQuery,
+		MatchBody:    req.MatchBody,
+		MatchHeaders: req.MatchHeaders,
+	}
+
+	resp, err := h.mockService.StartRecording(c, pbReq)
+	if err != nil {
+		if errors.Is(err, service.ErrRecording) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *StubHandler) StopRecordingGin(c *gin.Context) {
+	resp, err := h.mockService.StopRecording(c, &pb.StopRecordingRequest{})
+	if err != nil {
+		if errors.Is(err, service.ErrNotRecording) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *StubHandler) GetRecordingGin(c *gin.Context) {
+	resp, err := h.mockService.GetRecording(c, &pb.GetRecordingRequest{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
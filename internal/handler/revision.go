@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+// GetRevisionsGin lists the revisions of the stub given by url_id, newest first
+func (h *StubHandler) GetRevisionsGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+
+	resp, err := h.mockService.GetRevisions(c, &pb.GetRevisionsRequest{InterfaceId: urlId})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetRevisionGin returns a revision of the stub given by url_id with its snapshot. The
+// latest revision is returned when version is omitted.
+func (h *StubHandler) GetRevisionGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+	version, ok := queryVersion(c, "version")
+	if !ok {
+		return
+	}
+
+	resp, err := h.mockService.GetRevision(c, &pb.GetRevisionRequest{
+		InterfaceId: urlId,
+		Version:     version,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DiffRevisionsGin lists the fields that changed between the from and to revisions of the
+// stub given by url_id. to defaults to the latest revision and from to the one before it.
+func (h *StubHandler) DiffRevisionsGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+	from, ok := queryVersion(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := queryVersion(c, "to")
+	if !ok {
+		return
+	}
+
+	resp, err := h.mockService.DiffRevisions(c, &pb.DiffRevisionsRequest{
+		InterfaceId: urlId,
+		From:        from,
+		To:          to,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RollbackStubGin puts the stub given by url_id back the way it was at version
+func (h *StubHandler) RollbackStubGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+	version, ok := queryVersion(c, "version")
+	if !ok {
+		return
+	}
+	if version == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version is required"})
+		return
+	}
+
+	resp, err := h.mockService.RollbackStub(c, &pb.RollbackStubRequest{
+		InterfaceId: urlId,
+		Version:     version,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// queryVersion parses an optional revision version query parameter, 0 when omitted. It
+// writes a 400 response and reports false when the parameter is invalid.
+func queryVersion(c *gin.Context, name string) (int32, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, true
+	}
+	version, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return int32(version), true
+}
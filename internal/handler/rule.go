@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+// GetRuleByIDGin returns the rule given by rule_id
+func (h *StubHandler) GetRuleByIDGin(c *gin.Context) {
+	ruleId, err := strconv.ParseInt(c.Query("rule_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule_id"})
+		return
+	}
+
+	resp, err := h.mockService.GetRuleByID(c, &pb.GetRuleByIdRequest{Id: ruleId})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateRuleGin adds the rule in the request body to the stub given by url_id
+func (h *StubHandler) CreateRuleGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+
+	var rule model.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	if err := validateRule(&rule, "rule"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pbRule, err := toPbRule(rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule header format"})
+		return
+	}
+
+	resp, err := h.mockService.CreateRule(c, &pb.CreateRuleRequest{
+		InterfaceId: urlId,
+		Rule:        pbRule,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateRuleGin replaces the rule given by rule_id with the request body
+func (h *StubHandler) UpdateRuleGin(c *gin.Context) {
+	ruleId, err := strconv.ParseInt(c.Query("rule_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule_id"})
+		return
+	}
+
+	var rule model.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	h.updateRule(c, ruleId, &rule)
+}
+
+// PatchRuleGin changes the fields present in the request body of the rule given by rule_id
+func (h *StubHandler) PatchRuleGin(c *gin.Context) {
+	ruleId, err := strconv.ParseInt(c.Query("rule_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule_id"})
+		return
+	}
+
+	patch, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	current, err := h.mockService.GetRuleByID(c, &pb.GetRuleByIdRequest{Id: ruleId})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	currentRule, err := service.RuleFromPb(current.Rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rule model.Rule
+	if _, err := applyPatch(currentRule, &rule, patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	h.updateRule(c, ruleId, &rule)
+}
+
+func (h *StubHandler) updateRule(c *gin.Context, ruleId int64, rule *model.Rule) {
+	if err := validateRule(rule, "rule"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pbRule, err := toPbRule(*rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule header format"})
+		return
+	}
+
+	resp, err := h.mockService.UpdateRule(c, &pb.UpdateRuleRequest{
+		Id:   ruleId,
+		Rule: pbRule,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteRuleGin deletes the rule given by rule_id
+func (h *StubHandler) DeleteRuleGin(c *gin.Context) {
+	ruleId, err := strconv.ParseInt(c.Query("rule_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule_id"})
+		return
+	}
+
+	resp, err := h.mockService.DeleteRule(c, &pb.DeleteRuleRequest{Id: ruleId})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+func (h *StubHandler) GetScenariosGin(c *gin.Context) {
+	resp, err := h.mockService.GetScenarios(c, &pb.GetScenariosRequest{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ResetScenariosGin resets the scenario given by the name query parameter, or every
+// scenario when it is omitted
+func (h *StubHandler) ResetScenariosGin(c *gin.Context) {
+	pbReq := &pb.ResetScenariosRequest{
+		Name: c.Query("name"),
+	}
+
+	resp, err := h.mockService.ResetScenarios(c, pbReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+// ActivateStubGin makes the stub given by url_id match requests again
+func (h *StubHandler) ActivateStubGin(c *gin.Context) {
+	h.setStubStatus(c, model.StatusActive)
+}
+
+// DeactivateStubGin parks the stub given by url_id: it is kept but matches no request
+func (h *StubHandler) DeactivateStubGin(c *gin.Context) {
+	h.setStubStatus(c, model.StatusInactive)
+}
+
+// ActivateRuleGin makes the rule given by rule_id match requests again
+func (h *StubHandler) ActivateRuleGin(c *gin.Context) {
+	h.setRuleStatus(c, model.StatusActive)
+}
+
+// DeactivateRuleGin parks the rule given by rule_id: it is kept but skipped when matching
+func (h *StubHandler) DeactivateRuleGin(c *gin.Context) {
+	h.setRuleStatus(c, model.StatusInactive)
+}
+
+func (h *StubHandler) setStubStatus(c *gin.Context, status model.Status) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+
+	resp, err := h.mockService.SetMockUrlStatus(c, &pb.SetStatusRequest{
+		Id:     urlId,
+		Status: string(status),
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *StubHandler) setRuleStatus(c *gin.Context, status model.Status) {
+	ruleId, err := strconv.ParseInt(c.Query("rule_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule_id"})
+		return
+	}
+
+	resp, err := h.mockService.SetRuleStatus(c, &pb.SetStatusRequest{
+		Id:     ruleId,
+		Status: string(status),
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetDeletedStubsGin lists deleted stubs, which can be restored or purged
+func (h *StubHandler) GetDeletedStubsGin(c *gin.Context) {
+	q := c.Request.URL.Query()
+	q.Set("status", string(model.StatusDeleted))
+	c.Request.URL.RawQuery = q.Encode()
+	h.GetAllStubsGin(c)
+}
+
+// RestoreStubGin brings back the deleted stub given by url_id with the rules deleted with it
+func (h *StubHandler) RestoreStubGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+
+	resp, err := h.mockService.RestoreStub(c, &pb.RestoreStubRequest{Id: urlId})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PurgeStubGin removes the deleted stub given by url_id and all of its rules for good
+func (h *StubHandler) PurgeStubGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
+
+	resp, err := h.mockService.PurgeStub(c, &pb.PurgeStubRequest{Id: urlId})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -3,17 +3,303 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
 	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
 )
 
+var validMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	model.MethodAny:    true,
+}
+
+func isValidMethod(method string) bool {
+	return validMethods[strings.ToUpper(method)]
+}
+
+// toPbRule converts a rule from a management request into its protobuf form
+func toPbRule(rule model.Rule) (*pb.Rule, error) {
+	ruleHeaderJSON, err := json.Marshal(rule.ResponseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := make([]*pb.Condition, 0, len(rule.Conditions))
+	for _, cond := range rule.Conditions {
+		conditions = append(conditions, &pb.Condition{
+			MatchType: cond.MatchType,
+			MatchRule: cond.MatchRule,
+		})
+	}
+
+	delaySpecJSON, err := service.FormatDelaySpec(rule.DelaySpec)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*pb.RuleResponse, 0, len(rule.Responses))
+	for _, resp := range rule.Responses {
+		respHeaderJSON, err := json.Marshal(resp.ResponseHeader)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, &pb.RuleResponse{
+			ResponseCode:   resp.ResponseCode,
+			ResponseHeader: string(respHeaderJSON),
+			ResponseBody:   resp.ResponseBody,
+			Weight:         resp.Weight,
+		})
+	}
+
+	return &pb.Rule{
+		Id:             rule.ID,
+		Priority:       rule.Priority,
+		MatchType:      rule.MatchType,
+		MatchRule:      rule.MatchRule,
+		Logic:          rule.Logic,
+		Conditions:     conditions,
+		ResponseCode:   rule.ResponseCode,
+		ResponseHeader: string(ruleHeaderJSON),
+		ResponseBody:   rule.ResponseBody,
+		Template:       rule.Template,
+		ResponseMode:   rule.ResponseMode,
+		Responses:      responses,
+		DelayTime:      rule.DelayTime,
+		DelaySpec:      delaySpecJSON,
+		Fault:          rule.Fault,
+		FaultBandwidth: rule.FaultBandwidth,
+		Scenario:       rule.Scenario,
+		RequiredState:  rule.RequiredState,
+		NewState:       rule.NewState,
+		Description:    rule.Description,
+		Meta:           rule.Meta,
+	}, nil
+}
+
+// validateStubRequest checks a stub and its rules before they are saved
+func validateStubRequest(req *model.StubRequest) error {
+	// Validate URL format against its url_type
+	if err := service.ValidateURL(req.URLType, req.URL); err != nil {
+		return err
+	}
+
+	// Validate HTTP method, empty means any method
+	if req.Method != "" && !isValidMethod(req.Method) {
+		return fmt.Errorf("Method must be one of GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS or ANY")
+	}
+
+	// Validate response code is a valid HTTP status code
+	code, err := strconv.Atoi(req.ResponseCode)
+	if err != nil || code < 100 || code > 599 {
+		return fmt.Errorf("Response code must be a valid HTTP status code (100-599)")
+	}
+
+	// Validate response header contains content-type
+	if _, hasContentType := req.ResponseHeader["Content-Type"]; !hasContentType {
+		return fmt.Errorf("Response header must include Content-Type")
+	}
+
+	// Validate templated responses parse
+	if req.Template {
+		if err := service.ValidateResponseTemplate(req.ResponseBody, req.ResponseHeader); err != nil {
+			return fmt.Errorf("Invalid default response: %v", err)
+		}
+	}
+
+	if err := service.ValidateDelaySpec(req.DelaySpec); err != nil {
+		return fmt.Errorf("Invalid delay_spec: %v", err)
+	}
+
+	if req.ProxyURL != "" {
+		if err := service.ValidateProxyURL(req.ProxyURL); err != nil {
+			return fmt.Errorf("Invalid proxy_url: %v", err)
+		}
+	}
+
+	for i := range req.Rules {
+		if err := validateRule(&req.Rules[i], fmt.Sprintf("rule %d", i+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRule checks a rule before it is saved. name identifies the rule in errors.
+func validateRule(rule *model.Rule, name string) error {
+	if service.NormalizeResponseMode(rule.ResponseMode) != model.ResponseModeSingle {
+		// Validate the rule's response sequence or weighted set
+		if err := service.ValidateRuleResponses(rule); err != nil {
+			return fmt.Errorf("Invalid responses in %s: %v", name, err)
+		}
+	} else {
+		// Validate rule response code
+		ruleCode, err := strconv.Atoi(rule.ResponseCode)
+		if err != nil || ruleCode < 100 || ruleCode > 599 {
+			return fmt.Errorf("Invalid response_code in %s: must be a valid HTTP status code", name)
+		}
+
+		// Validate rule has content-type in header
+		if _, hasContentType := rule.ResponseHeader["Content-Type"]; !hasContentType {
+			return fmt.Errorf("Invalid %s: missing Content-Type in response_header", name)
+		}
+
+		if rule.ResponseBody == "" {
+			return fmt.Errorf("Invalid %s: missing response_body", name)
+		}
+
+		if rule.Template {
+			if err := service.ValidateResponseTemplate(rule.ResponseBody, rule.ResponseHeader); err != nil {
+				return fmt.Errorf("Invalid response in %s: %v", name, err)
+			}
+		}
+	}
+
+	// Validate the rule's conditions against their match types
+	if err := service.ValidateRuleConditions(rule); err != nil {
+		return fmt.Errorf("Invalid conditions in %s: %v", name, err)
+	}
+
+	if err := service.ValidateDelaySpec(rule.DelaySpec); err != nil {
+		return fmt.Errorf("Invalid delay_spec in %s: %v", name, err)
+	}
+
+	if err := service.ValidateFault(rule.Fault, rule.FaultBandwidth); err != nil {
+		return fmt.Errorf("Invalid fault in %s: %v", name, err)
+	}
+	return nil
+}
+
+// toPbStubRequest converts a stub from a management request into its protobuf form
+func toPbStubRequest(req *model.StubRequest) (*pb.SetMockUrlRequest, error) {
+	headerJSON, err := json.Marshal(req.ResponseHeader)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid header format")
+	}
+
+	delaySpecJSON, err := service.FormatDelaySpec(req.DelaySpec)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid delay_spec")
+	}
+
+	pbRules := make([]*pb.Rule, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		pbRule, err := toPbRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid rule header format")
+		}
+		pbRules = append(pbRules, pbRule)
+	}
+
+	return &pb.SetMockUrlRequest{
+		Url:            req.URL,
+		Method:         req.Method,
+		UrlType:        req.URLType,
+		ResponseCode:   req.ResponseCode,
+		ResponseHeader: string(headerJSON),
+		ResponseBody:   req.ResponseBody,
+		Template:       req.Template,
+		DelaySpec:      delaySpecJSON,
+		ProxyUrl:       req.ProxyURL,
+		Owner:          req.Owner,
+		Description:    req.Description,
+		Meta:           req.Meta,
+		Rules:          pbRules,
+	}, nil
+}
+
+// stubRequestFromPb converts a stored stub back into the form of a management request
+func stubRequestFromPb(u *pb.MockUrl) (*model.StubRequest, error) {
+	req := &model.StubRequest{
+		URL:          u.Url,
+		Method:       u.Method,
+		URLType:      u.UrlType,
+		ResponseCode: u.ResponseCode,
+		ResponseBody: u.ResponseBody,
+		Template:     u.Template,
+		ProxyURL:     u.ProxyUrl,
+		Owner:        u.Owner,
+		Description:  u.Description,
+		Meta:         u.Meta,
+	}
+	if u.ResponseHeader != "" {
+		if err := json.Unmarshal([]byte(u.ResponseHeader), &req.ResponseHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if req.DelaySpec, err = service.ParseDelaySpec(u.DelaySpec); err != nil {
+		return nil, err
+	}
+
+	for _, pbRule := range u.Rules {
+		rule, err := service.RuleFromPb(pbRule)
+		if err != nil {
+			return nil, err
+		}
+		req.Rules = append(req.Rules, *rule)
+	}
+	return req, nil
+}
+
+// applyPatch sets out to current with the top-level fields of a JSON patch replaced.
+// Fields missing from the patch keep their current value and null clears a field.
+// It returns the fields present in the patch.
+func applyPatch(current, out interface{}, patch []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, err
+	}
+
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(currentJSON, &merged); err != nil {
+		return nil, err
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+
+	mergedJSON, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(mergedJSON, out)
+}
+
+// errorStatus returns the HTTP status for an error from the mock service
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrStubNotFound), errors.Is(err, service.ErrRuleNotFound),
+		errors.Is(err, service.ErrRevisionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrRuleNotInStub), errors.Is(err, service.ErrInvalidStatus),
+		errors.Is(err, service.ErrInvalidRollback), errors.Is(err, service.ErrInvalidReorder):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrStubChanged):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 type StubHandler struct {
 	mockService *service.MockService
 }
@@ -35,42 +321,23 @@ func (h *StubHandler) CreateStub(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	headerJSON, err := json.Marshal(req.ResponseHeader)
-	if err != nil {
-		http.Error(w, "Invalid header format", http.StatusBadRequest)
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	pbRules := make([]*pb.Rule, 0, len(req.Rules))
-	for _, rule := range req.Rules {
-		ruleHeaderJSON, err := json.Marshal(rule.ResponseHeader)
-		if err != nil {
-			http.Error(w, "Invalid rule header format", http.StatusBadRequest)
-			return
-		}
-
-		pbRules = append(pbRules, &pb.Rule{
-			MatchType:      rule.MatchType,
-			MatchRule:      rule.MatchRule,
-			ResponseCode:   rule.ResponseCode,
-			ResponseHeader: string(ruleHeaderJSON),
-			ResponseBody:   rule.ResponseBody,
-			DelayTime:      rule.DelayTime,
-			Description:    rule.Description,
-		})
+	if err := validateStubRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	pbReq := &pb.SetMockUrlRequest{
-		Url:            req.URL,
-		ResponseCode:   req.ResponseCode,
-		ResponseHeader: string(headerJSON),
-		ResponseBody:   req.ResponseBody,
-		Owner:          req.Owner,
-		Description:    req.Description,
-		Rules:          pbRules,
+	pbReq, err := toPbStubRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	resp, err := h.mockService.SetMockUrl(context.Background(), pbReq)
+	resp, err := h.mockService.SetMockUrl(r.Context(), pbReq)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -88,118 +355,113 @@ func (h *StubHandler) CreateStubGin(c *gin.Context) {
 		return
 	}
 
-	// Validate URL format
-	if !strings.HasPrefix(req.URL, "/") {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "URL must start with a forward slash (/)",
-		})
+	if err := validateStubRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate response code is a valid HTTP status code
-	code, err := strconv.Atoi(req.ResponseCode)
-	if err != nil || code < 100 || code > 599 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Response code must be a valid HTTP status code (100-599)",
-		})
+	pbReq, err := toPbStubRequest(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate response header contains content-type
-	if _, hasContentType := req.ResponseHeader["Content-Type"]; !hasContentType {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Response header must include Content-Type",
-		})
+	resp, err := h.mockService.SetMockUrl(c, pbReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate rules if they exist
-	if len(req.Rules) > 0 {
-		for i, rule := range req.Rules {
-			// Validate match type is within valid range
-			if rule.MatchType < 1 || rule.MatchType > 3 {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Invalid match_type in rule %d: must be between 1 and 3", i+1),
-				})
-				return
-			}
+	c.JSON(http.StatusOK, resp)
+}
 
-			// Validate rule response code
-			ruleCode, err := strconv.Atoi(rule.ResponseCode)
-			if err != nil || ruleCode < 100 || ruleCode > 599 {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Invalid response_code in rule %d: must be a valid HTTP status code", i+1),
-				})
-				return
-			}
+// UpdateStubGin replaces the stub given by url_id with the request body. Rules with an id
+// are updated in place, rules without one are created and the stub's other rules are
+// deleted.
+func (h *StubHandler) UpdateStubGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
+	}
 
-			// Validate rule has content-type in header
-			if _, hasContentType := rule.ResponseHeader["Content-Type"]; !hasContentType {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Rule %d is missing Content-Type in response_header", i+1),
-				})
-				return
-			}
+	var req model.StubRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
 
-			// Additional rule validation for match_rule based on match_type
-			switch rule.MatchType {
-			case 1: // Query param
-				if !strings.Contains(rule.MatchRule, "=") {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"error": fmt.Sprintf("Rule %d has match_type 1 but match_rule is not a valid query parameter format", i+1),
-					})
-					return
-				}
-			case 2: // JSON body
-				var jsonTest map[string]interface{}
-				if err := json.Unmarshal([]byte(rule.MatchRule), &jsonTest); err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"error": fmt.Sprintf("Rule %d has match_type 2 but match_rule is not valid JSON", i+1),
-					})
-					return
-				}
-			}
-		}
+	h.updateStub(c, urlId, &req, true, 0)
+}
+
+// PatchStubGin changes the fields present in the request body of the stub given by url_id.
+// The stub's rules are only replaced, as with UpdateStubGin, when the body has rules. It
+// answers 409 Conflict when the stub is changed by another request in the meantime.
+func (h *StubHandler) PatchStubGin(c *gin.Context) {
+	urlId, err := strconv.ParseInt(c.Query("url_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url_id"})
+		return
 	}
 
-	headerJSON, err := json.Marshal(req.ResponseHeader)
+	patch, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	current, err := h.mockService.GetRule(c, &pb.GetRuleRequest{Id: urlId})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(current.Urls) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrStubNotFound.Error()})
+		return
+	}
+	currentReq, err := stubRequestFromPb(current.Urls[0])
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid header format"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	pbRules := make([]*pb.Rule, 0, len(req.Rules))
-	for _, rule := range req.Rules {
-		ruleHeaderJSON, err := json.Marshal(rule.ResponseHeader)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule header format"})
-			return
-		}
+	var req model.StubRequest
+	fields, err := applyPatch(currentReq, &req, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
 
-		pbRules = append(pbRules, &pb.Rule{
-			MatchType:      rule.MatchType,
-			MatchRule:      rule.MatchRule,
-			ResponseCode:   rule.ResponseCode,
-			ResponseHeader: string(ruleHeaderJSON),
-			ResponseBody:   rule.ResponseBody,
-			DelayTime:      rule.DelayTime,
-			Description:    rule.Description,
-		})
+	// The stub may change between reading it and saving the merge, so the update is
+	// refused unless the stub is still at the version read
+	_, replaceRules := fields["rules"]
+	h.updateStub(c, urlId, &req, replaceRules, current.Urls[0].Version)
+}
+
+func (h *StubHandler) updateStub(c *gin.Context, urlId int64, req *model.StubRequest, replaceRules bool, expectedVersion int64) {
+	if err := validateStubRequest(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	pbReq := &pb.SetMockUrlRequest{
-		Url:            req.URL,
-		ResponseCode:   req.ResponseCode,
-		ResponseHeader: string(headerJSON),
-		ResponseBody:   req.ResponseBody,
-		Owner:          req.Owner,
-		Description:    req.Description,
-		Rules:          pbRules,
+	stub, err := toPbStubRequest(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	resp, err := h.mockService.SetMockUrl(c, pbReq)
+	resp, err := h.mockService.UpdateMockUrl(c, &pb.UpdateMockUrlRequest{
+		Id:              urlId,
+		Stub:            stub,
+		ReplaceRules:    replaceRules,
+		ExpectedVersion: expectedVersion,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -249,7 +511,7 @@ func (h *StubHandler) DeleteStubGin(c *gin.Context) {
 
 	resp, err := h.mockService.DeleteStub(c, pbReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -302,6 +564,7 @@ func (h *StubHandler) GetAllStubsGin(c *gin.Context) {
 	// Parse query parameters
 	owner := c.Query("owner")
 	keyword := c.Query("keyword")
+	status := c.Query("status")
 
 	// Default pagination values
 	page := 1
@@ -322,13 +585,14 @@ func (h *StubHandler) GetAllStubsGin(c *gin.Context) {
 	pbReq := &pb.GetAllMockUrlsRequest{
 		Owner:    owner,
 		Keyword:  keyword,
+		Status:   status,
 		Page:     int32(page),
 		PageSize: int32(pageSize),
 	}
 
 	resp, err := h.mockService.GetAllMockUrls(c, pbReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -384,3 +648,25 @@ func (h *StubHandler) GetRulesGin(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// ReorderRulesGin handles the Gin version of the reorder rules request
+func (h *StubHandler) ReorderRulesGin(c *gin.Context) {
+	var req model.ReorderRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	pbReq := &pb.ReorderRulesRequest{
+		Id:      req.URLID,
+		RuleIds: req.RuleIDs,
+	}
+
+	resp, err := h.mockService.ReorderRules(c, pbReq)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
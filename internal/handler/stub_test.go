@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+func TestCreateStub(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"valid", `{"url": "/users", "method": "GET", "response_code": "200", "response_header": {"Content-Type": "text/plain"}, "response_body": "ok", "owner": "alice", "meta": "{\"team\": \"a\"}"}`, http.StatusOK},
+		{"missing owner", `{"url": "/users", "response_code": "200", "response_header": {"Content-Type": "text/plain"}, "response_body": "ok"}`, http.StatusBadRequest},
+		{"bad response code", `{"url": "/users", "response_code": "999", "response_header": {"Content-Type": "text/plain"}, "response_body": "ok", "owner": "alice"}`, http.StatusBadRequest},
+		{"bad url template", `{"url": "/users/{id", "url_type": "template", "response_code": "200", "response_header": {"Content-Type": "text/plain"}, "response_body": "ok", "owner": "alice"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := service.NewMockService(storage.NewMemoryStorage(), 0)
+			rec := httptest.NewRecorder()
+			NewStubHandler(mockService).CreateStub(rec, httptest.NewRequest("POST", "/v1/url/new", strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("CreateStub answered %d %s, want %d", rec.Code, rec.Body, tt.wantCode)
+			}
+
+			urls, err := mockService.GetAllMockUrls(context.Background(), &pb.GetAllMockUrlsRequest{Page: 1, PageSize: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode != http.StatusOK {
+				if len(urls.Urls) != 0 {
+					t.Errorf("a refused stub was saved: %v", urls.Urls)
+				}
+				return
+			}
+			if len(urls.Urls) != 1 || urls.Urls[0].Meta != `{"team": "a"}` {
+				t.Errorf("saved stubs = %v, want the stub with its meta", urls.Urls)
+			}
+		})
+	}
+}
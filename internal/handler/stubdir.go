@@ -0,0 +1,397 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// stubDirDebounce is how long the watcher waits for more changes before importing
+const stubDirDebounce = 300 * time.Millisecond
+
+// StubDir imports stubs from a directory of .yaml, .yml and .json files. Each file holds
+// one stub or a list of stubs shaped like the body of POST /v1/url/new. A stub is saved
+// over the one with the same method and URL, and stubs whose definition is removed from
+// the directory are deleted. Only files that changed since the last sync are imported,
+// so edits made through the management API last until their file changes. Imported stubs
+// are saved with their file as source, so the first sync also deletes the stubs whose
+// definition was removed while the server was down.
+type StubDir struct {
+	mockService *service.MockService
+	dir         string
+
+	mu         sync.Mutex
+	files      map[string]*stubFile
+	ids        map[string]int64
+	reconciled bool
+}
+
+// stubFile is what the last sync imported from one file
+type stubFile struct {
+	hash [sha256.Size]byte
+	keys []string
+}
+
+func NewStubDir(mockService *service.MockService, dir string) *StubDir {
+	return &StubDir{
+		mockService: mockService,
+		dir:         dir,
+		files:       make(map[string]*stubFile),
+		ids:         make(map[string]int64),
+	}
+}
+
+// Sync imports the files that changed since the last sync and deletes the stubs whose
+// definition has gone. A file that fails to parse or validate is skipped and keeps its
+// stubs as they were. A file that fails part way through saving keeps the stubs saved so
+// far and is imported again on the next sync.
+func (d *StubDir) Sync(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var removed []string
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isStubFile(path) {
+			return nil
+		}
+		seen[path] = true
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("Failed to read stub file",
+				zap.String("path", path),
+				zap.Error(err))
+			return nil
+		}
+		hash := sha256.Sum256(data)
+		previous := d.files[path]
+		if previous != nil && previous.hash == hash {
+			return nil
+		}
+
+		keys, err := d.importFile(ctx, path, data)
+		if err != nil {
+			logger.Error("Failed to import stub file",
+				zap.String("path", path),
+				zap.Error(err))
+			// Track the stubs saved before the failure so they go with the file, and
+			// leave the hash unset so the file is imported again
+			if len(keys) > 0 {
+				file := &stubFile{keys: keys}
+				if previous != nil {
+					file.keys = append(missingKeys(previous.keys, keys), keys...)
+				}
+				d.files[path] = file
+			}
+			return nil
+		}
+		if previous != nil {
+			removed = append(removed, missingKeys(previous.keys, keys)...)
+		}
+		d.files[path] = &stubFile{hash: hash, keys: keys}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to read stub directory",
+			zap.String("dir", d.dir),
+			zap.Error(err))
+		return err
+	}
+
+	for path, file := range d.files {
+		if !seen[path] {
+			removed = append(removed, file.keys...)
+			delete(d.files, path)
+		}
+	}
+	if !d.reconciled {
+		saved, err := d.reconcile(ctx, seen)
+		if err != nil {
+			// The stubs saved by an earlier run are picked up on the next sync
+			logger.Warn("Failed to load stubs imported from files",
+				zap.String("dir", d.dir),
+				zap.Error(err))
+		} else {
+			removed = append(removed, saved...)
+			d.reconciled = true
+		}
+	}
+	d.deleteStubs(ctx, removed)
+	return nil
+}
+
+// reconcile tracks the stubs saved from files by an earlier run and returns the keys of
+// those whose file no longer defines them. The stubs of a file that exists but failed to
+// import are kept with the file, as when it fails after it was imported.
+func (d *StubDir) reconcile(ctx context.Context, seen map[string]bool) ([]string, error) {
+	stubs, err := d.mockService.FileStubs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, stub := range stubs {
+		key := stubKey(stub.Method, stub.URL)
+		if _, ok := d.ids[key]; !ok {
+			d.ids[key] = stub.ID
+		}
+
+		path := filepath.Join(d.dir, filepath.FromSlash(strings.TrimPrefix(stub.Source, model.SourceFilePrefix)))
+		file := d.files[path]
+		switch {
+		case file == nil && seen[path]:
+			d.files[path] = &stubFile{keys: []string{key}}
+		case file == nil:
+			removed = append(removed, key)
+		case hasKey(file.keys, key):
+			// Still defined by its file
+		case file.hash == [sha256.Size]byte{}:
+			// The file failed to import, so it is imported again on the next sync
+			file.keys = append(file.keys, key)
+		default:
+			removed = append(removed, key)
+		}
+	}
+	return removed, nil
+}
+
+// importFile saves the stubs defined in a file and returns their keys. Nothing is saved
+// unless every stub in the file is valid. When saving a stub fails, the keys of the stubs
+// saved before it are returned with the error.
+func (d *StubDir) importFile(ctx context.Context, path string, data []byte) ([]string, error) {
+	stubs, err := parseStubFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(d.dir, path)
+	if err != nil {
+		return nil, err
+	}
+
+	pbReqs := make([]*pb.SetMockUrlRequest, 0, len(stubs))
+	for i := range stubs {
+		if err := binding.Validator.ValidateStruct(&stubs[i]); err != nil {
+			return nil, fmt.Errorf("stub %d: %v", i+1, err)
+		}
+		if err := validateStubRequest(&stubs[i]); err != nil {
+			return nil, fmt.Errorf("stub %d: %v", i+1, err)
+		}
+		pbReq, err := toPbStubRequest(&stubs[i])
+		if err != nil {
+			return nil, fmt.Errorf("stub %d: %v", i+1, err)
+		}
+		pbReq.Source = model.SourceFilePrefix + filepath.ToSlash(rel)
+		pbReqs = append(pbReqs, pbReq)
+	}
+
+	keys := make([]string, 0, len(pbReqs))
+	for _, pbReq := range pbReqs {
+		resp, err := d.mockService.SetMockUrl(ctx, pbReq)
+		if err != nil {
+			return keys, err
+		}
+		key := stubKey(pbReq.Method, pbReq.Url)
+		d.ids[key] = resp.Id
+		keys = append(keys, key)
+	}
+
+	logger.Info("Imported stub file",
+		zap.String("path", path),
+		zap.Int("stubs", len(keys)))
+	return keys, nil
+}
+
+// deleteStubs deletes the stubs with the given keys unless another file still defines them
+func (d *StubDir) deleteStubs(ctx context.Context, keys []string) {
+	defined := make(map[string]bool)
+	for _, file := range d.files {
+		for _, key := range file.keys {
+			defined[key] = true
+		}
+	}
+
+	for _, key := range keys {
+		if defined[key] {
+			continue
+		}
+		id, ok := d.ids[key]
+		if !ok {
+			continue
+		}
+		delete(d.ids, key)
+		if _, err := d.mockService.DeleteStub(ctx, &pb.DeleteStubRequest{Id: id}); err != nil {
+			logger.Warn("Failed to delete stub removed from stub files",
+				zap.String("stub", key),
+				zap.Int64("id", id),
+				zap.Error(err))
+			continue
+		}
+		logger.Info("Deleted stub removed from stub files",
+			zap.String("stub", key),
+			zap.Int64("id", id))
+	}
+}
+
+// Watch syncs the directory whenever its files change, until ctx is done
+func (d *StubDir) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("Failed to create stub directory watcher",
+			zap.Error(err))
+		return err
+	}
+	defer watcher.Close()
+
+	// fsnotify does not watch subdirectories, so add each of them
+	err = filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		return watcher.Add(path)
+	})
+	if err != nil {
+		logger.Error("Failed to watch stub directory",
+			zap.String("dir", d.dir),
+			zap.Error(err))
+		return err
+	}
+	logger.Info("Watching stub directory",
+		zap.String("dir", d.dir))
+
+	// Editors write a file in several steps, so wait for the changes to settle
+	timer := time.NewTimer(stubDirDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watcher.Add(event.Name); err != nil {
+						logger.Warn("Failed to watch new stub subdirectory",
+							zap.String("dir", event.Name),
+							zap.Error(err))
+					}
+				}
+			}
+			timer.Reset(stubDirDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("Stub directory watcher error",
+				zap.Error(err))
+		case <-timer.C:
+			// Sync logs its own errors, and the next change to the directory retries it
+			_ = d.Sync(ctx)
+		}
+	}
+}
+
+func isStubFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseStubFile decodes the stubs in a file. YAML is converted to JSON first, so both
+// formats use the field names of the stub API.
+func parseStubFile(path string, data []byte) ([]model.StubRequest, error) {
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			return nil, nil
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var stubs []model.StubRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if data[0] == '[' {
+		if err := dec.Decode(&stubs); err != nil {
+			return nil, err
+		}
+		return stubs, nil
+	}
+
+	var stub model.StubRequest
+	if err := dec.Decode(&stub); err != nil {
+		return nil, err
+	}
+	return append(stubs, stub), nil
+}
+
+// stubKey identifies a stub by its method and URL, as the storage does
+func stubKey(method, url string) string {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		method = model.MethodAny
+	}
+	return method + " " + url
+}
+
+// hasKey reports whether keys holds key
+func hasKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// missingKeys returns the keys in previous that are not in current
+func missingKeys(previous, current []string) []string {
+	kept := make(map[string]bool, len(current))
+	for _, key := range current {
+		kept[key] = true
+	}
+	var missing []string
+	for _, key := range previous {
+		if !kept[key] {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
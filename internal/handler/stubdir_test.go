@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/service"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("release")
+	os.Exit(m.Run())
+}
+
+func TestStubDirSyncAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := storage.NewMemoryStorage()
+
+	write := func(name string, urls ...string) {
+		t.Helper()
+		var stubs []string
+		for _, url := range urls {
+			stubs = append(stubs, fmt.Sprintf(`{"url": %q, "method": "GET", "response_code": "200", "response_header": {"Content-Type": "text/plain"}, "response_body": "ok", "owner": "files"}`, url))
+		}
+		data := "[" + strings.Join(stubs, ",") + "]"
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// start syncs the directory as a server starting on the same storage does
+	start := func() {
+		t.Helper()
+		if err := NewStubDir(service.NewMockService(store, 0), dir).Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	urls := func() []string {
+		t.Helper()
+		routes, err := store.GetMockUrlRoutes(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var urls []string
+		for _, route := range routes {
+			urls = append(urls, route.URL)
+		}
+		sort.Strings(urls)
+		return urls
+	}
+
+	write("a.json", "/a", "/b")
+	write("sub/c.json", "/c")
+	write("d.json", "/d")
+	write("e.json", "/e")
+	start()
+	if got, want := urls(), []string{"/a", "/b", "/c", "/d", "/e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after the first start, stubs = %v, want %v", got, want)
+	}
+	if _, err := store.SaveMockUrl(ctx, &model.Interface{URL: "/api", Method: "GET", URLType: model.URLTypeExact, ResponseCode: "200"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// While the server is down, /b leaves a.json, sub/c.json is removed, /d moves from
+	// d.json to a.json and e.json breaks, which keeps its stub
+	write("a.json", "/a", "/d")
+	for _, name := range []string{"sub/c.json", "d.json"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "e.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	start()
+	if got, want := urls(), []string{"/a", "/api", "/d", "/e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after restarting, stubs = %v, want %v", got, want)
+	}
+}
@@ -11,39 +11,293 @@ const (
 	StatusDeleted  Status = "deleted"
 )
 
+// StatusFilterAll lists stubs in every status but deleted
+const StatusFilterAll = "all"
+
+// SourceFilePrefix starts the source of a stub imported from a stub file, followed by the
+// file's path relative to the stub directory
+const SourceFilePrefix = "file:"
+
+// MethodAny matches requests of any HTTP method
+const MethodAny = "ANY"
+
+// Interface URL types
+const (
+	URLTypeExact    = "exact"    // url equals the request path
+	URLTypeTemplate = "template" // url is a path template such as /users/{id} or /files/**
+	URLTypeRegex    = "regex"    // url is a regular expression matching the whole request path
+)
+
+// Rule match types
+const (
+	MatchTypeQuery     int32 = 1 // match request query string
+	MatchTypeBody      int32 = 2 // match request body, semantically when both sides are JSON
+	MatchTypeHeader    int32 = 3 // match request headers
+	MatchTypePathParam int32 = 4 // match path parameters captured by a URL template or regex
+	MatchTypeBodyJSON  int32 = 5 // match when the JSON request body contains the JSON in match_rule
+	MatchTypeJSONPath  int32 = 6 // match a JSONPath predicate against the JSON request body
+)
+
 type StubRequest struct {
 	URL            string            `json:"url" binding:"required"`
+	Method         string            `json:"method"`
+	URLType        string            `json:"url_type"`
 	ResponseCode   string            `json:"response_code" binding:"required"`
 	ResponseHeader map[string]string `json:"response_header" binding:"required"`
 	ResponseBody   string            `json:"response_body" binding:"required"`
+	Template       bool              `json:"template"`
+	DelaySpec      *DelaySpec        `json:"delay_spec"`
+	ProxyURL       string            `json:"proxy_url"`
 	Owner          string            `json:"owner" binding:"required"`
 	Description    string            `json:"description"`
 	Meta           string            `json:"meta"`
 	Rules          []Rule            `json:"rules"`
 }
 
+// Rule logic combining its conditions
+const (
+	LogicAnd = "and"
+	LogicOr  = "or"
+)
+
+// Rule matches a request when its conditions, combined with Logic, hold. The rule's own
+// MatchType and MatchRule form its first condition when MatchType is set, followed by
+// Conditions. Rules are evaluated by ascending Priority, then in the order they were saved.
 type Rule struct {
-	MatchType      int32             `json:"match_type" binding:"required"`
-	MatchRule      string            `json:"match_rule" binding:"required"`
-	ResponseCode   string            `json:"response_code" binding:"required"`
-	ResponseHeader map[string]string `json:"response_header" binding:"required"`
-	ResponseBody   string            `json:"response_body" binding:"required"`
+	ID             int64             `json:"id"`
+	InterfaceID    int64             `json:"interface_id,omitempty"`
+	Status         Status            `json:"status,omitempty"`
+	Priority       int32             `json:"priority"`
+	MatchType      int32             `json:"match_type"`
+	MatchRule      string            `json:"match_rule"`
+	Logic          string            `json:"logic"`
+	Conditions     []Condition       `json:"conditions"`
+	ResponseCode   string            `json:"response_code"`
+	ResponseHeader map[string]string `json:"response_header"`
+	ResponseBody   string            `json:"response_body"`
+	Template       bool              `json:"template"`
+	ResponseMode   string            `json:"response_mode"`
+	Responses      []RuleResponse    `json:"responses"`
 	DelayTime      int32             `json:"delay_time"`
+	DelaySpec      *DelaySpec        `json:"delay_spec"`
+	Fault          string            `json:"fault"`
+	FaultBandwidth int32             `json:"fault_bandwidth"`
+	Scenario       string            `json:"scenario"`
+	RequiredState  string            `json:"required_state"`
+	NewState       string            `json:"new_state"`
 	Description    string            `json:"description"`
 	Meta           string            `json:"meta"`
 }
 
+// Rule response modes
+const (
+	// ResponseModeSingle always returns the rule's own response
+	ResponseModeSingle = "single"
+	// ResponseModeCycle returns the rule's responses in order, starting over after the last
+	ResponseModeCycle = "cycle"
+	// ResponseModeLast returns the rule's responses in order, then keeps returning the last
+	ResponseModeLast = "last"
+	// ResponseModeWeighted returns one of the rule's responses at random, by weight
+	ResponseModeWeighted = "weighted"
+)
+
+// RuleResponse is one response of a rule that returns a sequence or weighted set
+// of responses
+type RuleResponse struct {
+	ResponseCode   string            `json:"response_code"`
+	ResponseHeader map[string]string `json:"response_header"`
+	ResponseBody   string            `json:"response_body"`
+	Weight         int32             `json:"weight"`
+}
+
+// Delay distributions
+const (
+	DelayFixed      = "fixed"
+	DelayUniform    = "uniform"
+	DelayNormal     = "normal"
+	DelayLogNormal  = "lognormal"
+	DelayPercentile = "percentile"
+)
+
+// DelaySpec describes how long to wait before responding, in milliseconds:
+//
+//	{"type": "fixed", "value": 100}
+//	{"type": "uniform", "min": 50, "max": 150}
+//	{"type": "normal", "mean": 100, "stddev": 20}
+//	{"type": "lognormal", "mean": 100, "stddev": 50}
+//	{"type": "percentile", "p50": 80, "p99": 900}
+//
+// A percentile profile is a log-normal distribution fitted to its p50 and p99. Sampled
+// delays are never negative and, when Max is set, never exceed it.
+type DelaySpec struct {
+	Type   string  `json:"type"`
+	Value  float64 `json:"value,omitempty"`
+	Min    float64 `json:"min,omitempty"`
+	Max    float64 `json:"max,omitempty"`
+	Mean   float64 `json:"mean,omitempty"`
+	StdDev float64 `json:"stddev,omitempty"`
+	P50    float64 `json:"p50,omitempty"`
+	P99    float64 `json:"p99,omitempty"`
+}
+
+// Faults a rule can inject instead of a well-formed response
+const (
+	// FaultConnectionReset resets the connection without responding
+	FaultConnectionReset = "connection_reset"
+	// FaultEmptyResponse closes the connection without responding
+	FaultEmptyResponse = "empty_response"
+	// FaultMalformedBody sends the status and headers followed by random bytes
+	FaultMalformedBody = "malformed_body"
+	// FaultTruncatedBody announces the full body length but closes the connection halfway.
+	// An empty body is announced as one byte, so the response is still cut short.
+	FaultTruncatedBody = "truncated_body"
+	// FaultHang never responds, holding the connection until the client gives up
+	FaultHang = "hang"
+	// FaultDrip sends the body slowly, at FaultBandwidth bytes per second
+	FaultDrip = "drip"
+)
+
+// Query condition operators
+const (
+	QueryOpEquals   = "equals"
+	QueryOpContains = "contains"
+	QueryOpRegex    = "regex"
+	QueryOpPresent  = "present"
+	QueryOpAbsent   = "absent"
+)
+
+// QueryCondition is one element of a structured match_type 1 rule. The match_rule is
+// either a query string such as "a=1&b=2" or a JSON array of conditions such as
+// [{"key": "region", "op": "equals", "value": "eu"}, {"key": "debug", "op": "absent"}].
+//
+// Value is satisfied when any of the request values for Key satisfies Op. When Values is
+// given instead, each of them must be satisfied by some request value.
+type QueryCondition struct {
+	Key    string   `json:"key"`
+	Op     string   `json:"op"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// Condition is one match condition of a rule
+type Condition struct {
+	MatchType int32  `json:"match_type" binding:"required"`
+	MatchRule string `json:"match_rule" binding:"required"`
+}
+
 type Interface struct {
 	ID             int64
 	URL            string
+	Method         string
+	URLType        string
 	ResponseCode   string
 	ResponseHeader map[string]string
 	ResponseBody   string
+	Template       bool
+	DelaySpec      *DelaySpec
+	ProxyURL       string
 	Owner          string
 	Description    string
 	Meta           string
+	Status         Status
+	DeletedAt      time.Time
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
+	// Version counts the changes to the interface and its rules. When set on an update,
+	// the interface must still be at that version.
+	Version int64
+	// Source is where the interface is defined: empty when it is managed through the
+	// API, or SourceFilePrefix followed by the path of its stub file
+	Source string
+}
+
+// ReorderRulesRequest sets the evaluation order of an interface's rules. RuleIDs must list
+// every rule of the interface, first to be evaluated first.
+type ReorderRulesRequest struct {
+	URLID   int64   `json:"url_id" binding:"required"`
+	RuleIDs []int64 `json:"rule_ids" binding:"required"`
+}
+
+// RecordingRequest starts a recording session. Requests whose path starts with Prefix
+// are forwarded to Target and each distinct exchange is saved as a stub. MatchQuery,
+// MatchBody and MatchHeaders choose which request parts become rule conditions;
+// exchanges that differ only in other parts are recorded once.
+type RecordingRequest struct {
+	Target       string   `json:"target" binding:"required"`
+	Prefix       string   `json:"prefix"`
+	Owner        string   `json:"owner" binding:"required"`
+	MatchQuery   bool     `json:"match_query"`
+	MatchBody    bool     `json:"match_body"`
+	MatchHeaders []string `json:"match_headers"`
+}
+
+// RecordedExchange is a request forwarded while recording, with the upstream response
+type RecordedExchange struct {
+	Method         string
+	URL            string
+	QueryParams    string
+	RequestHeader  map[string]string
+	RequestBody    string
+	ResponseCode   string
+	ResponseHeader map[string]string
+	ResponseBody   string
+}
+
+// JournalEntry is a request received by the HTTP mock server. InterfaceID and RuleID are
+// the stub and rule that answered it, zero when none did, and Upstream is the service it
+// was forwarded to, if any. Unmatched is set when no stub matched the request's method
+// and URL. Fault is the fault injected instead of a well-formed response, in which case
+// ResponseCode is empty when no response was sent at all.
+type JournalEntry struct {
+	ID            int64             `json:"id"`
+	Time          time.Time         `json:"time"`
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	QueryParams   string            `json:"query_params"`
+	RequestHeader map[string]string `json:"request_header"`
+	RequestBody   string            `json:"request_body"`
+	InterfaceID   int64             `json:"interface_id"`
+	RuleID        int64             `json:"rule_id"`
+	ResponseCode  string            `json:"response_code"`
+	Upstream      string            `json:"upstream"`
+	Unmatched     bool              `json:"unmatched"`
+	Fault         string            `json:"fault"`
+}
+
+// NearMiss is a stub that came close to matching an unmatched request. Score ranks how
+// close it came, from 0 to 1, and Reasons explain why its method or URL did not match.
+// Rules reports how each of the stub's rules fares against the request.
+type NearMiss struct {
+	InterfaceID int64      `json:"interface_id"`
+	URL         string     `json:"url"`
+	URLType     string     `json:"url_type"`
+	Method      string     `json:"method"`
+	Score       float64    `json:"score"`
+	Reasons     []string   `json:"reasons"`
+	Rules       []RuleMiss `json:"rules"`
+}
+
+// RuleMiss tells whether a rule matches a request, and why not when it does not
+type RuleMiss struct {
+	RuleID  int64  `json:"rule_id"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// JournalCriteria selects journal entries. Every criterion that is set must hold. URL is
+// compared according to URLType, like a stub URL, and Conditions use the rule match types,
+// e.g. {"match_type": 6, "match_rule": "$.amount == 10"}. Since and Until bound the time
+// the request was received. Limit caps the number of entries returned, newest first.
+type JournalCriteria struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	URLType     string      `json:"url_type"`
+	InterfaceID int64       `json:"interface_id"`
+	RuleID      int64       `json:"rule_id"`
+	Conditions  []Condition `json:"conditions"`
+	Since       time.Time   `json:"since"`
+	Until       time.Time   `json:"until"`
+	Limit       int32       `json:"limit"`
 }
 
 type MockResponse struct {
@@ -51,4 +305,48 @@ type MockResponse struct {
 	ResponseCode   string            `json:"response_code"`
 	ResponseHeader map[string]string `json:"response_header"`
 	ResponseBody   string            `json:"response_body"`
+	Template       bool              `json:"template"`
+	DelaySpec      *DelaySpec        `json:"delay_spec,omitempty"`
+	ProxyURL       string            `json:"proxy_url,omitempty"`
+	PathParams     map[string]string `json:"path_params,omitempty"`
+}
+
+// Revision actions, the kind of change a revision records
+const (
+	RevisionCreate         = "create"
+	RevisionUpdate         = "update"
+	RevisionDelete         = "delete"
+	RevisionRestore        = "restore"
+	RevisionPurge          = "purge"
+	RevisionRollback       = "rollback"
+	RevisionActivate       = "activate"
+	RevisionDeactivate     = "deactivate"
+	RevisionRuleCreate     = "rule_create"
+	RevisionRuleUpdate     = "rule_update"
+	RevisionRuleDelete     = "rule_delete"
+	RevisionRuleActivate   = "rule_activate"
+	RevisionRuleDeactivate = "rule_deactivate"
+	RevisionRuleReorder    = "rule_reorder"
+)
+
+// Revision is the state of a stub and its rules after one change. Versions count up from
+// 1 per stub. Author is the stub's owner and Snapshot the stub in its JSON API form.
+type Revision struct {
+	ID          int64
+	InterfaceID int64
+	Version     int32
+	Action      string
+	Author      string
+	Comment     string
+	Snapshot    string
+	CreatedAt   time.Time
+}
+
+// FieldChange is a field that differs between two revisions of a stub. Path names the
+// field, rules[id=7].response_body for a rule's, and Old and New hold its JSON values,
+// empty when the field is absent.
+type FieldChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
 }
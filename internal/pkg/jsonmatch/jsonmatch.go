@@ -0,0 +1,338 @@
+// Package jsonmatch compares decoded JSON documents for stub rules: semantic equality,
+// subset containment and predicates over a subset of JSONPath.
+//
+// A path starts with "$" followed by any number of steps: ".name" or "['name']" select an
+// object member, "[n]" selects an array element (negative indexes count from the end) and
+// ".*" or "[*]" select every member or element. Documents are values decoded by
+// encoding/json into interface{}.
+//
+// A predicate is a path optionally followed by an operator and a JSON literal, e.g.
+// `$.order.items[0].sku == "A1"` or `$.amount > 100`. A bare path checks that the path
+// exists. The supported operators are ==, !=, >, >=, <, <= and =~, whose right-hand side is
+// a string holding a regular expression. When the path selects several values the
+// predicate holds if any of them satisfies it.
+package jsonmatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type step struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Path is a compiled JSONPath expression
+type Path struct {
+	raw   string
+	steps []step
+}
+
+// CompilePath parses a JSONPath expression
+func CompilePath(expr string) (*Path, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("path %q must start with $", expr)
+	}
+
+	p := &Path{raw: expr}
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("path %q has an empty member name", expr)
+			}
+			if name == "*" {
+				p.steps = append(p.steps, step{wildcard: true})
+			} else {
+				p.steps = append(p.steps, step{name: name})
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unclosed [", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			switch {
+			case inner == "*":
+				p.steps = append(p.steps, step{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p.steps = append(p.steps, step{name: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q has an invalid index [%s]", expr, inner)
+				}
+				p.steps = append(p.steps, step{index: n, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q has an unexpected character %q", expr, rest[0])
+		}
+	}
+	return p, nil
+}
+
+// String returns the path as it was written
+func (p *Path) String() string {
+	return p.raw
+}
+
+// Select returns every value the path selects in doc
+func (p *Path) Select(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, s := range p.steps {
+		var next []interface{}
+		for _, v := range current {
+			switch node := v.(type) {
+			case map[string]interface{}:
+				if s.wildcard {
+					for _, child := range node {
+						next = append(next, child)
+					}
+				} else if !s.isIndex {
+					if child, ok := node[s.name]; ok {
+						next = append(next, child)
+					}
+				}
+			case []interface{}:
+				if s.wildcard {
+					next = append(next, node...)
+				} else if s.isIndex {
+					i := s.index
+					if i < 0 {
+						i += len(node)
+					}
+					if i >= 0 && i < len(node) {
+						next = append(next, node[i])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+var operators = []string{"==", "!=", ">=", "<=", "=~", ">", "<"}
+
+// Predicate is a compiled JSONPath predicate
+type Predicate struct {
+	raw   string
+	path  *Path
+	op    string
+	value interface{}
+	re    *regexp.Regexp
+}
+
+// CompilePredicate parses a predicate such as `$.order.id == "A1"`
+func CompilePredicate(expr string) (*Predicate, error) {
+	expr = strings.TrimSpace(expr)
+	pathEnd := len(expr)
+	depth := 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '\'' || c == '"' {
+			quote = c
+		} else if c == '[' {
+			depth++
+		} else if c == ']' {
+			depth--
+		} else if depth == 0 && strings.IndexByte(" \t=!<>", c) >= 0 {
+			pathEnd = i
+			break
+		}
+	}
+
+	path, err := CompilePath(expr[:pathEnd])
+	if err != nil {
+		return nil, err
+	}
+	pred := &Predicate{raw: expr, path: path}
+
+	rest := strings.TrimSpace(expr[pathEnd:])
+	if rest == "" {
+		return pred, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			pred.op = op
+			break
+		}
+	}
+	if pred.op == "" {
+		return nil, fmt.Errorf("predicate %q has an unknown operator", expr)
+	}
+
+	literal := strings.TrimSpace(rest[len(pred.op):])
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		pred.value = literal[1 : len(literal)-1]
+	} else if err := json.Unmarshal([]byte(literal), &pred.value); err != nil {
+		return nil, fmt.Errorf("predicate %q has an invalid value %q: %v", expr, literal, err)
+	}
+
+	if pred.op == "=~" {
+		pattern, ok := pred.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("predicate %q must compare =~ against a string", expr)
+		}
+		if pred.re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("predicate %q has an invalid regex: %v", expr, err)
+		}
+	}
+	return pred, nil
+}
+
+// String returns the predicate as it was written
+func (p *Predicate) String() string {
+	return p.raw
+}
+
+// Eval reports whether doc satisfies the predicate. When it does not, the returned string
+// explains why.
+func (p *Predicate) Eval(doc interface{}) (bool, string) {
+	values := p.path.Select(doc)
+	if len(values) == 0 {
+		return false, fmt.Sprintf("%s does not exist", p.path)
+	}
+	if p.op == "" {
+		return true, ""
+	}
+
+	for _, v := range values {
+		if p.compare(v) {
+			return true, ""
+		}
+	}
+	got, _ := json.Marshal(values[0])
+	want, _ := json.Marshal(p.value)
+	return false, fmt.Sprintf("%s is %s, want %s %s", p.path, got, p.op, want)
+}
+
+func (p *Predicate) compare(v interface{}) bool {
+	switch p.op {
+	case "==":
+		return Equal(v, p.value)
+	case "!=":
+		return !Equal(v, p.value)
+	case "=~":
+		s, ok := v.(string)
+		return ok && p.re.MatchString(s)
+	}
+
+	var cmp int
+	switch a := v.(type) {
+	case float64:
+		b, ok := p.value.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	case string:
+		b, ok := p.value.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(a, b)
+	default:
+		return false
+	}
+
+	switch p.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Equal reports whether two decoded JSON values are semantically equal, ignoring object
+// key order
+func Equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// Contains reports whether expected is a subset of actual: objects must contain every
+// expected member with a matching value, arrays must contain a matching element for every
+// expected element in any order, and scalars must be equal. When it does not, the returned
+// string names the first difference.
+func Contains(actual, expected interface{}) (bool, string) {
+	return contains(actual, expected, "$")
+}
+
+func contains(actual, expected interface{}, at string) (bool, string) {
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !ok {
+			return false, fmt.Sprintf("%s is not an object", at)
+		}
+		for k, v := range want {
+			child, ok := got[k]
+			if !ok {
+				return false, fmt.Sprintf("%s.%s is missing", at, k)
+			}
+			if ok, reason := contains(child, v, at+"."+k); !ok {
+				return false, reason
+			}
+		}
+		return true, ""
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		if !ok {
+			return false, fmt.Sprintf("%s is not an array", at)
+		}
+		for i, v := range want {
+			found := false
+			for _, child := range got {
+				if ok, _ := contains(child, v, at); ok {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false, fmt.Sprintf("%s has no element matching expected element %d", at, i)
+			}
+		}
+		return true, ""
+	default:
+		if !Equal(actual, expected) {
+			gotJSON, _ := json.Marshal(actual)
+			wantJSON, _ := json.Marshal(expected)
+			return false, fmt.Sprintf("%s is %s, want %s", at, gotJSON, wantJSON)
+		}
+		return true, ""
+	}
+}
@@ -0,0 +1,202 @@
+package jsonmatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const order = `{
+	"order": {
+		"id": "A1",
+		"amount": 150,
+		"paid": true,
+		"note": null,
+		"items": [
+			{"sku": "X1", "qty": 1},
+			{"sku": "Y2", "qty": 3}
+		],
+		"tags": {"gift": "yes", "rush": "no"}
+	}
+}`
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestCompilePath(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"$", false},
+		{"$.order.id", false},
+		{"$.order.items[0].sku", false},
+		{"$['order']['id']", false},
+		{"$.order.items[-1]", false},
+		{"$.order.*", false},
+		{"$.order.items[*].sku", false},
+		{"order.id", true},
+		{"$.order..id", true},
+		{"$.order.items[0", true},
+		{"$.order.items[x]", true},
+		{"$order", true},
+	}
+	for _, tt := range tests {
+		_, err := CompilePath(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CompilePath(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPathSelect(t *testing.T) {
+	doc := decode(t, order)
+	tests := []struct {
+		path string
+		want []string // selected values as JSON, sorted
+	}{
+		{"$.order.id", []string{`"A1"`}},
+		{"$['order']['amount']", []string{`150`}},
+		{"$.order.items[0].sku", []string{`"X1"`}},
+		{"$.order.items[-1].sku", []string{`"Y2"`}},
+		{"$.order.items[2]", nil},
+		{"$.order.items[-3]", nil},
+		{"$.order.items[*].sku", []string{`"X1"`, `"Y2"`}},
+		{"$.order.items.*.qty", []string{`1`, `3`}},
+		{"$.order.tags.*", []string{`"no"`, `"yes"`}},
+		{"$.order.missing", nil},
+		{"$.order.id.deeper", nil},
+		{"$.order.items.sku", nil},
+		{"$.order.note", []string{`null`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := CompilePath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range p.Select(doc) {
+				b, _ := json.Marshal(v)
+				got = append(got, string(b))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredicateEval(t *testing.T) {
+	doc := decode(t, order)
+	tests := []struct {
+		predicate string
+		want      bool
+	}{
+		{"$.order.id", true},
+		{"$.order.note", true},
+		{"$.order.missing", false},
+		{`$.order.id == "A1"`, true},
+		{`$.order.id == 'A1'`, true},
+		{`$.order.id != "A1"`, false},
+		{"$.order.amount == 150", true},
+		{"$.order.amount > 100", true},
+		{"$.order.amount >= 150", true},
+		{"$.order.amount < 150", false},
+		{"$.order.amount <= 100", false},
+		{`$.order.amount > "100"`, false},
+		{"$.order.paid == true", true},
+		{"$.order.note == null", true},
+		{`$.order.id =~ "^A\\d$"`, true},
+		{`$.order.amount =~ "150"`, false},
+		{`$.order.id > "A0"`, true},
+		{`$.order.items[*].sku == "Y2"`, true},
+		{`$.order.items[*].sku == "Z9"`, false},
+		{"$.order.items[*].qty > 2", true},
+		{`$.order.tags.* == "yes"`, true},
+		{`$['order'].items[-1].qty == 3`, true},
+		{`$.order.items[0] == {"sku": "X1", "qty": 1}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.predicate, func(t *testing.T) {
+			p, err := CompilePredicate(tt.predicate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, reason := p.Eval(doc)
+			if got != tt.want {
+				t.Errorf("Eval = %v (%s), want %v", got, reason, tt.want)
+			}
+			if !got && reason == "" {
+				t.Error("Eval gave no reason for a failed predicate")
+			}
+		})
+	}
+}
+
+func TestCompilePredicateErrors(t *testing.T) {
+	tests := []string{
+		"order.id == 1",
+		"$.order.id ~= 1",
+		"$.order.id == A1",
+		"$.order.id =~ 5",
+		`$.order.id =~ "("`,
+	}
+	for _, expr := range tests {
+		if _, err := CompilePredicate(expr); err == nil {
+			t.Errorf("CompilePredicate(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	actual := decode(t, order)
+	tests := []struct {
+		name     string
+		expected string
+		want     bool
+	}{
+		{"empty object", `{}`, true},
+		{"nested member", `{"order": {"id": "A1"}}`, true},
+		{"wrong value", `{"order": {"id": "B2"}}`, false},
+		{"missing member", `{"order": {"currency": "EUR"}}`, false},
+		{"array subset in any order", `{"order": {"items": [{"sku": "Y2"}, {"sku": "X1"}]}}`, true},
+		{"array element missing", `{"order": {"items": [{"sku": "Z9"}]}}`, false},
+		{"object where array", `{"order": {"items": {"sku": "X1"}}}`, false},
+		{"array where object", `{"order": {"tags": ["gift"]}}`, false},
+		{"null value", `{"order": {"note": null}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := Contains(actual, decode(t, tt.expected))
+			if got != tt.want {
+				t.Errorf("Contains = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{`{"a": 1, "b": [1, 2]}`, `{"b": [1, 2], "a": 1}`, true},
+		{`{"a": 1}`, `{"a": 1.0}`, true},
+		{`[1, 2]`, `[2, 1]`, false},
+		{`{"a": 1}`, `{"a": 1, "b": 2}`, false},
+	}
+	for _, tt := range tests {
+		if got := Equal(decode(t, tt.a), decode(t, tt.b)); got != tt.want {
+			t.Errorf("Equal(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package lru provides a bounded cache that evicts its least recently used entries. The
+// mock path uses it to keep compiled URL patterns, regular expressions, JSONPath
+// predicates and response templates, whose sources come from stubs and so can grow
+// without bound as stubs are edited.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+type entry struct {
+	key   string
+	value interface{}
+}
+
+// Cache is a string-keyed cache holding at most a fixed number of entries. It is safe
+// for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+// New returns a cache holding at most size entries
+func New(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// Get returns the value cached for key and marks it as recently used
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*entry).value, true
+}
+
+// Add caches value for key, evicting the least recently used entry when the cache is full
+func (c *Cache) Add(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*entry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Len returns the number of cached entries
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
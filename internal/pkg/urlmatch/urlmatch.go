@@ -0,0 +1,177 @@
+// Package urlmatch matches request paths against stub URL patterns.
+//
+// Two kinds of patterns are supported:
+//
+//   - Templates split the path on "/" and match it segment by segment. A segment is
+//     either a literal, "{name}" which matches one segment and captures it as a path
+//     parameter, "*" which matches one segment without capturing it, or "**" which
+//     matches any number of segments (including none).
+//   - Regular expressions must match the whole path. Named groups are captured as path
+//     parameters.
+//
+// When several patterns match a path, Compare decides which one wins: templates beat
+// regular expressions, and a template beats another one when, at the first segment where
+// they differ, it has the more specific segment (literal, then "{name}", then "*", then "**").
+// If neither is more specific the template with more segments wins. Ties are left to the
+// caller.
+package urlmatch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type segmentKind int
+
+// Segment kinds, ordered from most to least specific
+const (
+	segLiteral segmentKind = iota
+	segParam
+	segWildcard
+	segDoubleWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string // literal text or parameter name
+}
+
+// Pattern is a compiled URL pattern
+type Pattern struct {
+	raw      string
+	segments []segment
+	re       *regexp.Regexp
+}
+
+// CompileTemplate compiles a path template such as /users/{id} or /files/**
+func CompileTemplate(template string) (*Pattern, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("template %q must start with /", template)
+	}
+
+	p := &Pattern{raw: template}
+	names := make(map[string]bool)
+	for _, part := range splitPath(template) {
+		switch {
+		case part == "**":
+			p.segments = append(p.segments, segment{kind: segDoubleWildcard})
+		case part == "*":
+			p.segments = append(p.segments, segment{kind: segWildcard})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := part[1 : len(part)-1]
+			if name == "" || strings.ContainsAny(name, "{}/") {
+				return nil, fmt.Errorf("template %q has an invalid parameter %q", template, part)
+			}
+			if names[name] {
+				return nil, fmt.Errorf("template %q uses parameter %q more than once", template, name)
+			}
+			names[name] = true
+			p.segments = append(p.segments, segment{kind: segParam, value: name})
+		case strings.ContainsAny(part, "{}*"):
+			return nil, fmt.Errorf("template %q has an invalid segment %q: parameters and wildcards must span a whole segment", template, part)
+		default:
+			p.segments = append(p.segments, segment{kind: segLiteral, value: part})
+		}
+	}
+	return p, nil
+}
+
+// CompileRegex compiles a regular expression that must match the whole path
+func CompileRegex(expr string) (*Pattern, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL regex %q: %v", expr, err)
+	}
+	return &Pattern{raw: expr, re: re}, nil
+}
+
+// IsTemplate reports whether a URL contains template syntax
+func IsTemplate(url string) bool {
+	return strings.ContainsAny(url, "{*")
+}
+
+// String returns the pattern as it was written
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// Match reports whether the path matches and returns the captured path parameters
+func (p *Pattern) Match(path string) (map[string]string, bool) {
+	params := make(map[string]string)
+
+	if p.re != nil {
+		m := p.re.FindStringSubmatch(path)
+		if m == nil {
+			return nil, false
+		}
+		for i, name := range p.re.SubexpNames() {
+			if name != "" {
+				params[name] = m[i]
+			}
+		}
+		return params, true
+	}
+
+	if !matchSegments(p.segments, splitPath(path), params) {
+		return nil, false
+	}
+	return params, true
+}
+
+func matchSegments(segments []segment, parts []string, params map[string]string) bool {
+	if len(segments) == 0 {
+		return len(parts) == 0
+	}
+
+	seg := segments[0]
+	if seg.kind == segDoubleWildcard {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(segments[1:], parts[i:], params) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+	switch seg.kind {
+	case segLiteral:
+		if seg.value != parts[0] {
+			return false
+		}
+	case segParam:
+		params[seg.value] = parts[0]
+	}
+	return matchSegments(segments[1:], parts[1:], params)
+}
+
+// Compare returns a negative number when p takes precedence over q, a positive number
+// when q takes precedence over p, and zero when neither does
+func (p *Pattern) Compare(q *Pattern) int {
+	switch {
+	case p.re != nil && q.re != nil:
+		return 0
+	case p.re != nil:
+		return 1
+	case q.re != nil:
+		return -1
+	}
+
+	for i := 0; i < len(p.segments) && i < len(q.segments); i++ {
+		if p.segments[i].kind != q.segments[i].kind {
+			return int(p.segments[i].kind) - int(q.segments[i].kind)
+		}
+	}
+	return len(q.segments) - len(p.segments)
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
@@ -0,0 +1,129 @@
+package urlmatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{"/users/{id}", false},
+		{"/files/**", false},
+		{"/a/*/b", false},
+		{"/", false},
+		{"users/{id}", true},
+		{"/users/{}", true},
+		{"/users/{id}/{id}", true},
+		{"/users/id-{id}", true},
+		{"/files/*.json", true},
+	}
+	for _, tt := range tests {
+		_, err := CompileTemplate(tt.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CompileTemplate(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		regex      bool
+		path       string
+		wantOK     bool
+		wantParams map[string]string
+	}{
+		{"literal", "/users/list", false, "/users/list", true, map[string]string{}},
+		{"literal mismatch", "/users/list", false, "/users/all", false, nil},
+		{"trailing slash", "/users/list", false, "/users/list/", true, map[string]string{}},
+		{"param", "/users/{id}", false, "/users/42", true, map[string]string{"id": "42"}},
+		{"param needs a segment", "/users/{id}", false, "/users", false, nil},
+		{"param spans one segment", "/users/{id}", false, "/users/42/orders", false, nil},
+		{"two params", "/users/{user}/orders/{order}", false, "/users/1/orders/2", true, map[string]string{"user": "1", "order": "2"}},
+		{"wildcard", "/a/*/c", false, "/a/b/c", true, map[string]string{}},
+		{"double wildcard none", "/files/**", false, "/files", true, map[string]string{}},
+		{"double wildcard many", "/files/**", false, "/files/a/b/c", true, map[string]string{}},
+		{"double wildcard in the middle", "/a/**/{name}", false, "/a/x/y/z", true, map[string]string{"name": "z"}},
+		{"regex", `/items/(?P<id>\d+)`, true, "/items/7", true, map[string]string{"id": "7"}},
+		{"regex matches the whole path", `/items/\d+`, true, "/items/7/extra", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compile := CompileTemplate
+			if tt.regex {
+				compile = CompileRegex
+			}
+			p, err := compile(tt.pattern)
+			if err != nil {
+				t.Fatalf("compile %q: %v", tt.pattern, err)
+			}
+			params, ok := p.Match(tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("Match(%q) ok = %v, want %v", tt.path, ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("Match(%q) params = %v, want %v", tt.path, params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestPatternCompare(t *testing.T) {
+	// Each case lists a pattern that takes precedence over the other; "re:" marks a regex
+	tests := []struct {
+		name   string
+		winner string
+		loser  string
+	}{
+		{"template over regex", "/users/**", "re:/users/.*"},
+		{"literal over param", "/users/me", "/users/{id}"},
+		{"param over wildcard", "/users/{id}", "/users/*"},
+		{"wildcard over double wildcard", "/users/*", "/users/**"},
+		{"first difference decides", "/users/{id}/**", "/users/*/orders"},
+		{"more segments", "/users/{id}/orders", "/users/{id}"},
+		{"double wildcard with more segments", "/files/**/raw", "/files/**"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, q := mustCompile(t, tt.winner), mustCompile(t, tt.loser)
+			if got := p.Compare(q); got >= 0 {
+				t.Errorf("%q.Compare(%q) = %d, want < 0", tt.winner, tt.loser, got)
+			}
+			if got := q.Compare(p); got <= 0 {
+				t.Errorf("%q.Compare(%q) = %d, want > 0", tt.loser, tt.winner, got)
+			}
+		})
+	}
+
+	ties := [][2]string{
+		{"re:/a/.*", "re:/b/.*"},
+		{"/users/{id}", "/orders/{id}"},
+		{"/a/b", "/c/d"},
+	}
+	for _, tie := range ties {
+		p, q := mustCompile(t, tie[0]), mustCompile(t, tie[1])
+		if got := p.Compare(q); got != 0 {
+			t.Errorf("%q.Compare(%q) = %d, want 0", tie[0], tie[1], got)
+		}
+	}
+}
+
+func mustCompile(t *testing.T, pattern string) *Pattern {
+	t.Helper()
+	var p *Pattern
+	var err error
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		p, err = CompileRegex(expr)
+	} else {
+		p, err = CompileTemplate(pattern)
+	}
+	if err != nil {
+		t.Fatalf("compile %q: %v", pattern, err)
+	}
+	return p
+}
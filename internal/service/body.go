@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/jsonmatch"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/lru"
+)
+
+// predicateCache holds compiled JSONPath predicates keyed by their source
+var predicateCache = lru.New(4096)
+
+// CompileJSONPathRule compiles a match_type 6 rule such as `$.order.items[0].sku == "A1"`
+func CompileJSONPathRule(matchRule string) (*jsonmatch.Predicate, error) {
+	if p, ok := predicateCache.Get(matchRule); ok {
+		return p.(*jsonmatch.Predicate), nil
+	}
+	p, err := jsonmatch.CompilePredicate(matchRule)
+	if err != nil {
+		return nil, err
+	}
+	predicateCache.Add(matchRule, p)
+	return p, nil
+}
+
+// decodedBody returns the request body decoded as JSON
+func (m *matchRequest) decodedBody() (interface{}, error) {
+	if !m.bodyParsed {
+		m.bodyParsed = true
+		m.bodyErr = json.Unmarshal([]byte(m.body), &m.bodyJSON)
+	}
+	return m.bodyJSON, m.bodyErr
+}
+
+// matchBodyEqual compares the body with a match_type 2 rule. When both are JSON they are
+// compared semantically, so whitespace and key order do not matter; otherwise the raw
+// strings must be equal.
+func (m *matchRequest) matchBodyEqual(matchRule string) (bool, string) {
+	var expected interface{}
+	if err := json.Unmarshal([]byte(matchRule), &expected); err == nil {
+		if actual, err := m.decodedBody(); err == nil {
+			if !jsonmatch.Equal(actual, expected) {
+				return false, "request body is not equal to match_rule JSON"
+			}
+			return true, ""
+		}
+	}
+
+	if m.body != matchRule {
+		return false, "request body does not equal match_rule"
+	}
+	return true, ""
+}
+
+// matchBodyContains checks that the JSON body contains the match_type 5 rule as a subset
+func (m *matchRequest) matchBodyContains(matchRule string) (bool, string) {
+	var expected interface{}
+	if err := json.Unmarshal([]byte(matchRule), &expected); err != nil {
+		return false, fmt.Sprintf("match_rule is not valid JSON: %v", err)
+	}
+	actual, err := m.decodedBody()
+	if err != nil {
+		return false, "request body is not valid JSON"
+	}
+	return jsonmatch.Contains(actual, expected)
+}
+
+// matchJSONPath evaluates a match_type 6 predicate against the JSON body
+func (m *matchRequest) matchJSONPath(matchRule string) (bool, string) {
+	pred, err := CompileJSONPathRule(matchRule)
+	if err != nil {
+		return false, err.Error()
+	}
+	actual, err := m.decodedBody()
+	if err != nil {
+		return false, "request body is not valid JSON"
+	}
+	return pred.Eval(actual)
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+)
+
+// RuleFromPb converts a protobuf rule into the storage model
+func RuleFromPb(pbRule *pb.Rule) (*model.Rule, error) {
+	var ruleHeader map[string]string
+	if pbRule.ResponseHeader != "" {
+		if err := json.Unmarshal([]byte(pbRule.ResponseHeader), &ruleHeader); err != nil {
+			logger.Error("Failed to parse rule response header",
+				zap.String("header", pbRule.ResponseHeader),
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	conditions := make([]model.Condition, 0, len(pbRule.Conditions))
+	for _, cond := range pbRule.Conditions {
+		conditions = append(conditions, model.Condition{
+			MatchType: cond.MatchType,
+			MatchRule: cond.MatchRule,
+		})
+	}
+
+	delaySpec, err := ParseDelaySpec(pbRule.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to parse rule delay spec",
+			zap.String("delay_spec", pbRule.DelaySpec),
+			zap.Error(err))
+		return nil, err
+	}
+
+	responses := make([]model.RuleResponse, 0, len(pbRule.Responses))
+	for i, pbResp := range pbRule.Responses {
+		var respHeader map[string]string
+		if pbResp.ResponseHeader != "" {
+			if err := json.Unmarshal([]byte(pbResp.ResponseHeader), &respHeader); err != nil {
+				logger.Error("Failed to parse rule response header",
+					zap.Int("response_index", i),
+					zap.String("header", pbResp.ResponseHeader),
+					zap.Error(err))
+				return nil, err
+			}
+		}
+		responses = append(responses, model.RuleResponse{
+			ResponseCode:   pbResp.ResponseCode,
+			ResponseHeader: respHeader,
+			ResponseBody:   pbResp.ResponseBody,
+			Weight:         pbResp.Weight,
+		})
+	}
+
+	return &model.Rule{
+		ID:             pbRule.Id,
+		InterfaceID:    pbRule.InterfaceId,
+		Priority:       pbRule.Priority,
+		MatchType:      pbRule.MatchType,
+		MatchRule:      pbRule.MatchRule,
+		Logic:          normalizeLogic(pbRule.Logic),
+		Conditions:     conditions,
+		ResponseCode:   pbRule.ResponseCode,
+		ResponseHeader: ruleHeader,
+		ResponseBody:   pbRule.ResponseBody,
+		Template:       pbRule.Template,
+		ResponseMode:   NormalizeResponseMode(pbRule.ResponseMode),
+		Responses:      responses,
+		DelayTime:      pbRule.DelayTime,
+		DelaySpec:      delaySpec,
+		Fault:          pbRule.Fault,
+		FaultBandwidth: pbRule.FaultBandwidth,
+		Scenario:       pbRule.Scenario,
+		RequiredState:  pbRule.RequiredState,
+		NewState:       pbRule.NewState,
+		Description:    pbRule.Description,
+		Meta:           pbRule.Meta,
+	}, nil
+}
+
+// ruleToPb converts a stored rule into its protobuf form
+func ruleToPb(rule *model.Rule) (*pb.Rule, error) {
+	ruleHeaderJSON, err := json.Marshal(rule.ResponseHeader)
+	if err != nil {
+		logger.Error("Failed to marshal rule response header",
+			zap.Error(err))
+		return nil, err
+	}
+
+	conditions := make([]*pb.Condition, 0, len(rule.Conditions))
+	for _, cond := range rule.Conditions {
+		conditions = append(conditions, &pb.Condition{
+			MatchType: cond.MatchType,
+			MatchRule: cond.MatchRule,
+		})
+	}
+
+	delaySpecJSON, err := FormatDelaySpec(rule.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to marshal rule delay spec",
+			zap.Error(err))
+		return nil, err
+	}
+
+	responses := make([]*pb.RuleResponse, 0, len(rule.Responses))
+	for _, resp := range rule.Responses {
+		respHeaderJSON, err := json.Marshal(resp.ResponseHeader)
+		if err != nil {
+			logger.Error("Failed to marshal rule response header",
+				zap.Error(err))
+			return nil, err
+		}
+		responses = append(responses, &pb.RuleResponse{
+			ResponseCode:   resp.ResponseCode,
+			ResponseHeader: string(respHeaderJSON),
+			ResponseBody:   resp.ResponseBody,
+			Weight:         resp.Weight,
+		})
+	}
+
+	return &pb.Rule{
+		Id:             rule.ID,
+		InterfaceId:    rule.InterfaceID,
+		Status:         string(rule.Status),
+		Priority:       rule.Priority,
+		MatchType:      rule.MatchType,
+		MatchRule:      rule.MatchRule,
+		Logic:          rule.Logic,
+		Conditions:     conditions,
+		ResponseCode:   rule.ResponseCode,
+		ResponseHeader: string(ruleHeaderJSON),
+		ResponseBody:   rule.ResponseBody,
+		Template:       rule.Template,
+		ResponseMode:   rule.ResponseMode,
+		Responses:      responses,
+		DelayTime:      rule.DelayTime,
+		DelaySpec:      delaySpecJSON,
+		Fault:          rule.Fault,
+		FaultBandwidth: rule.FaultBandwidth,
+		Scenario:       rule.Scenario,
+		RequiredState:  rule.RequiredState,
+		NewState:       rule.NewState,
+		Description:    rule.Description,
+		Meta:           rule.Meta,
+	}, nil
+}
+
+// mockUrlToPb loads the rules of an interface and converts both into protobuf form
+func (s *MockService) mockUrlToPb(ctx context.Context, iface *model.Interface) (*pb.MockUrl, error) {
+	// Convert interface header to JSON string
+	headerJSON, err := json.Marshal(iface.ResponseHeader)
+	if err != nil {
+		logger.Error("Failed to marshal interface response header",
+			zap.Int64("interface_id", iface.ID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	delaySpecJSON, err := FormatDelaySpec(iface.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to marshal interface delay spec",
+			zap.Int64("interface_id", iface.ID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Get rules for the interface
+	rules, err := s.storage.GetRulesByInterfaceID(ctx, iface.ID)
+	if err != nil {
+		logger.Error("Failed to get rules for interface",
+			zap.Int64("interface_id", iface.ID),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Convert rules to protobuf format
+	pbRules := make([]*pb.Rule, 0, len(rules))
+	for _, rule := range rules {
+		pbRule, err := ruleToPb(rule)
+		if err != nil {
+			logger.Error("Failed to convert rule",
+				zap.Int64("interface_id", iface.ID),
+				zap.Error(err))
+			return nil, err
+		}
+		pbRules = append(pbRules, pbRule)
+	}
+
+	var deleteTime string
+	if !iface.DeletedAt.IsZero() {
+		deleteTime = iface.DeletedAt.Format(time.RFC3339)
+	}
+
+	return &pb.MockUrl{
+		Id:             iface.ID,
+		Url:            iface.URL,
+		Method:         iface.Method,
+		UrlType:        iface.URLType,
+		ResponseCode:   iface.ResponseCode,
+		ResponseHeader: string(headerJSON),
+		ResponseBody:   iface.ResponseBody,
+		Template:       iface.Template,
+		DelaySpec:      delaySpecJSON,
+		ProxyUrl:       iface.ProxyURL,
+		Owner:          iface.Owner,
+		Description:    iface.Description,
+		Meta:           iface.Meta,
+		Status:         string(iface.Status),
+		DeleteTime:     deleteTime,
+		Version:        iface.Version,
+		Source:         iface.Source,
+		Rules:          pbRules,
+	}, nil
+}
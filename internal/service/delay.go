@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+)
+
+// z99 is the standard normal quantile of the 99th percentile
+const z99 = 2.3263478740408408
+
+// ParseDelaySpec decodes and validates a JSON delay spec. An empty string means no spec.
+func ParseDelaySpec(s string) (*model.DelaySpec, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var spec model.DelaySpec
+	if err := json.Unmarshal([]byte(s), &spec); err != nil {
+		return nil, fmt.Errorf("delay_spec is not valid JSON: %v", err)
+	}
+	if err := ValidateDelaySpec(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// FormatDelaySpec encodes a delay spec as JSON, or as an empty string when there is none
+func FormatDelaySpec(spec *model.DelaySpec) (string, error) {
+	if spec == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ValidateDelaySpec checks that a delay spec has the parameters its type needs
+func ValidateDelaySpec(spec *model.DelaySpec) error {
+	if spec == nil {
+		return nil
+	}
+	spec.Type = strings.ToLower(strings.TrimSpace(spec.Type))
+	if spec.Min < 0 || spec.Max < 0 {
+		return fmt.Errorf("delay_spec min and max must not be negative")
+	}
+
+	switch spec.Type {
+	case model.DelayFixed:
+		if spec.Value < 0 {
+			return fmt.Errorf("fixed delay_spec needs a value of at least 0")
+		}
+	case model.DelayUniform:
+		if spec.Max <= spec.Min {
+			return fmt.Errorf("uniform delay_spec needs max greater than min")
+		}
+	case model.DelayNormal:
+		if spec.Mean < 0 || spec.StdDev < 0 {
+			return fmt.Errorf("normal delay_spec needs a mean and stddev of at least 0")
+		}
+	case model.DelayLogNormal:
+		if spec.Mean <= 0 || spec.StdDev < 0 {
+			return fmt.Errorf("lognormal delay_spec needs a positive mean and a stddev of at least 0")
+		}
+	case model.DelayPercentile:
+		if spec.P50 <= 0 || spec.P99 < spec.P50 {
+			return fmt.Errorf("percentile delay_spec needs a positive p50 and a p99 of at least p50")
+		}
+	default:
+		return fmt.Errorf("unknown delay_spec type %q, must be one of %s, %s, %s, %s or %s", spec.Type,
+			model.DelayFixed, model.DelayUniform, model.DelayNormal, model.DelayLogNormal, model.DelayPercentile)
+	}
+	return nil
+}
+
+// sampleDelay draws a delay from a spec, falling back to a fixed delay in milliseconds
+// when there is no spec
+func sampleDelay(spec *model.DelaySpec, fixedMillis int32) time.Duration {
+	if spec == nil {
+		return time.Duration(fixedMillis) * time.Millisecond
+	}
+
+	var ms float64
+	switch spec.Type {
+	case model.DelayFixed:
+		ms = spec.Value
+	case model.DelayUniform:
+		ms = spec.Min + rand.Float64()*(spec.Max-spec.Min)
+	case model.DelayNormal:
+		ms = spec.Mean + rand.NormFloat64()*spec.StdDev
+	case model.DelayLogNormal:
+		// Parameters of the underlying normal distribution for the requested mean and stddev
+		sigma2 := math.Log(1 + (spec.StdDev*spec.StdDev)/(spec.Mean*spec.Mean))
+		mu := math.Log(spec.Mean) - sigma2/2
+		ms = math.Exp(mu + rand.NormFloat64()*math.Sqrt(sigma2))
+	case model.DelayPercentile:
+		mu := math.Log(spec.P50)
+		sigma := (math.Log(spec.P99) - mu) / z99
+		ms = math.Exp(mu + rand.NormFloat64()*sigma)
+	}
+
+	if ms < spec.Min {
+		ms = spec.Min
+	}
+	if spec.Max > 0 && ms > spec.Max {
+		ms = spec.Max
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// sleepContext waits for d, returning early with the context's error when it is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/urlmatch"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+)
+
+// DefaultJournalSize is the number of requests the journal keeps when no size is configured
+const DefaultJournalSize = 1000
+
+// journal keeps the most recent requests received by the HTTP mock server in a ring buffer
+type journal struct {
+	mu      sync.RWMutex
+	entries []model.JournalEntry
+	next    int
+	full    bool
+	lastID  int64
+}
+
+func newJournal(size int) *journal {
+	if size <= 0 {
+		size = DefaultJournalSize
+	}
+	return &journal{entries: make([]model.JournalEntry, size)}
+}
+
+// add appends an entry, dropping the oldest one when the journal is full
+func (j *journal) add(entry model.JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.lastID++
+	entry.ID = j.lastID
+	j.entries[j.next] = entry
+	j.next = (j.next + 1) % len(j.entries)
+	if j.next == 0 {
+		j.full = true
+	}
+}
+
+// snapshot returns the entries, newest first
+func (j *journal) snapshot() []model.JournalEntry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	n := j.next
+	if j.full {
+		n = len(j.entries)
+	}
+	entries := make([]model.JournalEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		entries = append(entries, j.entries[(j.next-i+len(j.entries))%len(j.entries)])
+	}
+	return entries
+}
+
+func (j *journal) clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = make([]model.JournalEntry, len(j.entries))
+	j.next = 0
+	j.full = false
+}
+
+// RecordRequest adds a request received by the HTTP mock server to the journal
+func (s *MockService) RecordRequest(entry *model.JournalEntry) {
+	s.journal.add(*entry)
+}
+
+func (s *MockService) QueryJournal(ctx context.Context, req *pb.JournalCriteria) (*pb.QueryJournalResponse, error) {
+	logger.Info("Querying journal",
+		zap.String("method", req.Method),
+		zap.String("url", req.Url),
+		zap.Int("conditions", len(req.Conditions)))
+
+	entries, err := s.findJournalEntries(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := len(entries)
+	if req.Limit > 0 && int(req.Limit) < limit {
+		limit = int(req.Limit)
+	}
+	pbEntries := make([]*pb.JournalEntry, 0, limit)
+	for i := 0; i < limit; i++ {
+		pbEntries = append(pbEntries, journalEntryToPb(&entries[i]))
+	}
+
+	return &pb.QueryJournalResponse{
+		Success: true,
+		Count:   int32(len(entries)),
+		Entries: pbEntries,
+	}, nil
+}
+
+func (s *MockService) CountJournal(ctx context.Context, req *pb.JournalCriteria) (*pb.CountJournalResponse, error) {
+	logger.Info("Counting journal entries",
+		zap.String("method", req.Method),
+		zap.String("url", req.Url),
+		zap.Int("conditions", len(req.Conditions)))
+
+	entries, err := s.findJournalEntries(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CountJournalResponse{
+		Success: true,
+		Count:   int32(len(entries)),
+	}, nil
+}
+
+func (s *MockService) ClearJournal(ctx context.Context, req *pb.ClearJournalRequest) (*pb.ClearJournalResponse, error) {
+	logger.Info("Clearing journal")
+
+	s.journal.clear()
+
+	return &pb.ClearJournalResponse{
+		Success: true,
+		Message: "Journal cleared",
+	}, nil
+}
+
+// findJournalEntries returns the journal entries matching the criteria, newest first
+func (s *MockService) findJournalEntries(req *pb.JournalCriteria) ([]model.JournalEntry, error) {
+	criteria, err := journalCriteriaFromPb(req)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newJournalFilter(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []model.JournalEntry
+	for _, entry := range s.journal.snapshot() {
+		if filter.matches(&entry) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched, nil
+}
+
+// ValidateJournalCriteria checks the URL and conditions of journal criteria
+func ValidateJournalCriteria(criteria *model.JournalCriteria) error {
+	_, err := newJournalFilter(criteria)
+	return err
+}
+
+// journalFilter is a compiled form of journal criteria
+type journalFilter struct {
+	criteria *model.JournalCriteria
+	pattern  *urlmatch.Pattern
+}
+
+func newJournalFilter(criteria *model.JournalCriteria) (*journalFilter, error) {
+	f := &journalFilter{criteria: criteria}
+
+	if criteria.URL != "" {
+		switch urlType := NormalizeURLType(criteria.URLType, criteria.URL); urlType {
+		case model.URLTypeTemplate:
+			p, err := urlmatch.CompileTemplate(criteria.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid url template: %v", err)
+			}
+			f.pattern = p
+		case model.URLTypeRegex:
+			p, err := urlmatch.CompileRegex(criteria.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid url regex: %v", err)
+			}
+			f.pattern = p
+		case model.URLTypeExact:
+		default:
+			return nil, fmt.Errorf("invalid url_type %q", criteria.URLType)
+		}
+	}
+
+	for i, cond := range criteria.Conditions {
+		if err := ValidateCondition(cond.MatchType, cond.MatchRule); err != nil {
+			return nil, fmt.Errorf("condition %d: %v", i+1, err)
+		}
+	}
+	return f, nil
+}
+
+func (f *journalFilter) matches(entry *model.JournalEntry) bool {
+	c := f.criteria
+	if c.Method != "" && !strings.EqualFold(c.Method, entry.Method) {
+		return false
+	}
+	if c.InterfaceID != 0 && c.InterfaceID != entry.InterfaceID {
+		return false
+	}
+	if c.RuleID != 0 && c.RuleID != entry.RuleID {
+		return false
+	}
+	if !c.Since.IsZero() && entry.Time.Before(c.Since) {
+		return false
+	}
+	if !c.Until.IsZero() && entry.Time.After(c.Until) {
+		return false
+	}
+
+	var pathParams map[string]string
+	if c.URL != "" {
+		if f.pattern == nil {
+			if c.URL != entry.URL {
+				return false
+			}
+		} else {
+			params, ok := f.pattern.Match(entry.URL)
+			if !ok {
+				return false
+			}
+			pathParams = params
+		}
+	}
+
+	if len(c.Conditions) == 0 {
+		return true
+	}
+	m := newJournalMatchRequest(entry, pathParams)
+	for _, cond := range c.Conditions {
+		if ok, _ := m.match(cond.MatchType, cond.MatchRule); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// newJournalMatchRequest prepares a journaled request for matching against rules
+func newJournalMatchRequest(entry *model.JournalEntry, pathParams map[string]string) *matchRequest {
+	m := &matchRequest{
+		method:     entry.Method,
+		url:        entry.URL,
+		query:      entry.QueryParams,
+		body:       entry.RequestBody,
+		headers:    make(map[string]string, len(entry.RequestHeader)),
+		pathParams: pathParams,
+	}
+	for k, v := range entry.RequestHeader {
+		m.headers[http.CanonicalHeaderKey(k)] = v
+	}
+	return m
+}
+
+func journalCriteriaFromPb(req *pb.JournalCriteria) (*model.JournalCriteria, error) {
+	criteria := &model.JournalCriteria{
+		Method:      req.Method,
+		URL:         req.Url,
+		URLType:     req.UrlType,
+		InterfaceID: req.InterfaceId,
+		RuleID:      req.RuleId,
+		Limit:       req.Limit,
+	}
+	for _, cond := range req.Conditions {
+		criteria.Conditions = append(criteria.Conditions, model.Condition{
+			MatchType: cond.MatchType,
+			MatchRule: cond.MatchRule,
+		})
+	}
+
+	var err error
+	if req.Since != "" {
+		if criteria.Since, err = time.Parse(time.RFC3339Nano, req.Since); err != nil {
+			return nil, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if req.Until != "" {
+		if criteria.Until, err = time.Parse(time.RFC3339Nano, req.Until); err != nil {
+			return nil, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	return criteria, nil
+}
+
+func journalEntryToPb(entry *model.JournalEntry) *pb.JournalEntry {
+	headerJSON, _ := json.Marshal(entry.RequestHeader)
+	return &pb.JournalEntry{
+		Id:            entry.ID,
+		Time:          entry.Time.Format(time.RFC3339Nano),
+		Method:        entry.Method,
+		Url:           entry.URL,
+		QueryParams:   entry.QueryParams,
+		RequestHeader: string(headerJSON),
+		RequestBody:   entry.RequestBody,
+		InterfaceId:   entry.InterfaceID,
+		RuleId:        entry.RuleID,
+		ResponseCode:  entry.ResponseCode,
+		Upstream:      entry.Upstream,
+		Unmatched:     entry.Unmatched,
+		Fault:         entry.Fault,
+	}
+}
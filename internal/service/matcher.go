@@ -0,0 +1,264 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+)
+
+// matchRequest holds the parts of an incoming request that rules are matched against
+type matchRequest struct {
+	method     string
+	url        string
+	query      string
+	body       string
+	headers    map[string]string
+	pathParams map[string]string
+
+	// bodyJSON is the decoded request body, parsed on first use
+	bodyJSON   interface{}
+	bodyErr    error
+	bodyParsed bool
+}
+
+func newMatchRequest(req *pb.MockRequest, pathParams map[string]string) *matchRequest {
+	m := &matchRequest{
+		method:     req.Method,
+		url:        req.Url,
+		query:      req.QueryParams,
+		body:       req.RequestBody,
+		headers:    make(map[string]string),
+		pathParams: pathParams,
+	}
+
+	if req.RequestHeader != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(req.RequestHeader), &headers); err != nil {
+			logger.Warn("Failed to parse request header, matching without headers",
+				zap.String("header", req.RequestHeader),
+				zap.Error(err))
+		}
+		for k, v := range headers {
+			m.headers[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	return m
+}
+
+// ruleConditions returns every condition of a rule, starting with the rule's own
+// match_type and match_rule when set
+func ruleConditions(rule *model.Rule) []model.Condition {
+	conditions := make([]model.Condition, 0, len(rule.Conditions)+1)
+	if rule.MatchType != 0 {
+		conditions = append(conditions, model.Condition{MatchType: rule.MatchType, MatchRule: rule.MatchRule})
+	}
+	return append(conditions, rule.Conditions...)
+}
+
+// matchRule reports whether the request satisfies a rule, combining its conditions with
+// the rule's logic. A scenario rule without conditions matches every request. When the
+// request does not match, the returned string explains why.
+func (m *matchRequest) matchRule(rule *model.Rule) (bool, string) {
+	conditions := ruleConditions(rule)
+	if len(conditions) == 0 {
+		if rule.Scenario != "" {
+			return true, ""
+		}
+		return false, "rule has no conditions"
+	}
+
+	anyOf := rule.Logic == model.LogicOr
+	var reasons []string
+	for _, cond := range conditions {
+		matched, reason := m.match(cond.MatchType, cond.MatchRule)
+		if matched && anyOf {
+			return true, ""
+		}
+		if !matched && !anyOf {
+			return false, reason
+		}
+		if !matched {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if anyOf {
+		return false, "no condition matched: " + strings.Join(reasons, "; ")
+	}
+	return true, ""
+}
+
+// match reports whether the request satisfies a single match condition.
+// When it does not, the returned string explains why.
+func (m *matchRequest) match(matchType int32, matchRule string) (bool, string) {
+	switch matchType {
+	case model.MatchTypeQuery:
+		return m.matchQuery(matchRule)
+	case model.MatchTypeBody:
+		return m.matchBodyEqual(matchRule)
+	case model.MatchTypeBodyJSON:
+		return m.matchBodyContains(matchRule)
+	case model.MatchTypeJSONPath:
+		return m.matchJSONPath(matchRule)
+	case model.MatchTypeHeader:
+		return m.matchHeaders(matchRule)
+	case model.MatchTypePathParam:
+		return m.matchPathParams(matchRule)
+	default:
+		return false, fmt.Sprintf("unsupported match_type %d", matchType)
+	}
+}
+
+// matchHeaders checks that every header in the rule is present in the request with the
+// expected value. Header names are case-insensitive. A header sent several times matches
+// if any of its values equals the expected one.
+func (m *matchRequest) matchHeaders(matchRule string) (bool, string) {
+	expected, err := ParseHeaderRule(matchRule)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	for name, want := range expected {
+		got, ok := m.headers[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return false, fmt.Sprintf("header %s is missing", name)
+		}
+		if !headerValueMatches(got, want) {
+			return false, fmt.Sprintf("header %s is %q, want %q", name, got, want)
+		}
+	}
+	return true, ""
+}
+
+func headerValueMatches(got, want string) bool {
+	if got == want {
+		return true
+	}
+	for _, v := range strings.Split(got, ",") {
+		if strings.TrimSpace(v) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathParams checks that every parameter in the rule was captured from the
+// request path with the expected value
+func (m *matchRequest) matchPathParams(matchRule string) (bool, string) {
+	expected, err := ParsePathParamRule(matchRule)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	for name, want := range expected {
+		got, ok := m.pathParams[name]
+		if !ok {
+			return false, fmt.Sprintf("path parameter %s was not captured", name)
+		}
+		if got != want {
+			return false, fmt.Sprintf("path parameter %s is %q, want %q", name, got, want)
+		}
+	}
+	return true, ""
+}
+
+// ParseHeaderRule parses a match_type 3 rule, a JSON object of header name to value,
+// e.g. {"X-Tenant": "acme"}
+func ParseHeaderRule(matchRule string) (map[string]string, error) {
+	return parseStringMapRule(matchRule, "header")
+}
+
+// ParsePathParamRule parses a match_type 4 rule, a JSON object of path parameter name
+// to value, e.g. {"id": "123"}
+func ParsePathParamRule(matchRule string) (map[string]string, error) {
+	return parseStringMapRule(matchRule, "path parameter")
+}
+
+func parseStringMapRule(matchRule, kind string) (map[string]string, error) {
+	var values map[string]string
+	if err := json.Unmarshal([]byte(matchRule), &values); err != nil {
+		return nil, fmt.Errorf("%s rule must be a JSON object of %s name to value: %v", kind, kind, err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%s rule must contain at least one %s", kind, kind)
+	}
+	return values, nil
+}
+
+// normalizeLogic lower-cases a rule logic, treating an empty one as and
+func normalizeLogic(logic string) string {
+	logic = strings.ToLower(strings.TrimSpace(logic))
+	if logic == "" {
+		return model.LogicAnd
+	}
+	return logic
+}
+
+// ValidateRuleConditions checks a rule's logic and that it has at least one condition,
+// each of which is valid for its match_type. Scenario rules may have no conditions.
+func ValidateRuleConditions(rule *model.Rule) error {
+	if logic := normalizeLogic(rule.Logic); logic != model.LogicAnd && logic != model.LogicOr {
+		return fmt.Errorf("logic must be %s or %s", model.LogicAnd, model.LogicOr)
+	}
+	if rule.Scenario == "" && (rule.RequiredState != "" || rule.NewState != "") {
+		return fmt.Errorf("required_state and new_state need a scenario")
+	}
+
+	conditions := ruleConditions(rule)
+	if len(conditions) == 0 {
+		if rule.Scenario != "" {
+			return nil
+		}
+		return fmt.Errorf("match_type and match_rule or conditions are required")
+	}
+	for i, cond := range conditions {
+		if err := ValidateCondition(cond.MatchType, cond.MatchRule); err != nil {
+			if len(conditions) == 1 {
+				return err
+			}
+			return fmt.Errorf("condition %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ValidateCondition checks that a match_rule is valid for its match_type
+func ValidateCondition(matchType int32, matchRule string) error {
+	switch matchType {
+	case model.MatchTypeQuery:
+		if _, err := ParseQueryRule(matchRule); err != nil {
+			return fmt.Errorf("match_type 1 but match_rule is not a valid query parameter format: %v", err)
+		}
+	case model.MatchTypeBody:
+		var jsonTest map[string]interface{}
+		if err := json.Unmarshal([]byte(matchRule), &jsonTest); err != nil {
+			return fmt.Errorf("match_type 2 but match_rule is not valid JSON")
+		}
+	case model.MatchTypeHeader:
+		if _, err := ParseHeaderRule(matchRule); err != nil {
+			return fmt.Errorf("match_type 3 but match_rule is not valid: %v", err)
+		}
+	case model.MatchTypePathParam:
+		if _, err := ParsePathParamRule(matchRule); err != nil {
+			return fmt.Errorf("match_type 4 but match_rule is not valid: %v", err)
+		}
+	case model.MatchTypeBodyJSON:
+		if !json.Valid([]byte(matchRule)) {
+			return fmt.Errorf("match_type 5 but match_rule is not valid JSON")
+		}
+	case model.MatchTypeJSONPath:
+		if _, err := CompileJSONPathRule(matchRule); err != nil {
+			return fmt.Errorf("match_type 6 but match_rule is not a valid JSONPath predicate: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid match_type %d: must be between 1 and 6", matchType)
+	}
+	return nil
+}
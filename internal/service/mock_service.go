@@ -3,27 +3,64 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
 	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
 	"go.uber.org/zap"
+	"strings"
 	"time"
 )
 
+var (
+	// ErrNoMatch is returned by GetMockResponse when no stub matches the request
+	ErrNoMatch = errors.New("no stub matches the request")
+	// ErrStubNotFound is returned when a stub ID does not refer to an existing stub
+	ErrStubNotFound = errors.New("stub not found")
+	// ErrRuleNotFound is returned when a rule ID does not refer to an existing rule
+	ErrRuleNotFound = errors.New("rule not found")
+	// ErrRuleNotInStub is returned when a stub update lists a rule of another stub
+	ErrRuleNotInStub = errors.New("rule does not belong to the stub")
+	// ErrInvalidStatus is returned for a status a stub or rule cannot be set to or listed by
+	ErrInvalidStatus = errors.New("invalid status")
+	// ErrStubChanged is returned when a stub update expects a stub that has changed since
+	ErrStubChanged = errors.New("stub has changed since it was read")
+	// ErrInvalidReorder is returned when a rule order does not list each of a stub's rules once
+	ErrInvalidReorder = storage.ErrInvalidReorder
+)
+
 type MockService struct {
 	pb.UnimplementedMockServerServer
-	storage *storage.MySQLStorage
+	storage   storage.Storage
+	scenarios *scenarioStore
+	responses *responseSelector
+	recorder  *recorder
+	journal   *journal
+	routes    *routeCache
 }
 
-func NewMockService(storage *storage.MySQLStorage) *MockService {
-	return &MockService{storage: storage}
+// NewMockService creates the mock service. journalSize is the number of requests kept in
+// the request journal, DefaultJournalSize when it is not positive.
+func NewMockService(storage storage.Storage, journalSize int) *MockService {
+	return &MockService{
+		storage:   storage,
+		scenarios: newScenarioStore(),
+		responses: newResponseSelector(),
+		recorder:  newRecorder(),
+		journal:   newJournal(journalSize),
+	}
 }
 
 func (s *MockService) SetMockUrl(ctx context.Context, req *pb.SetMockUrlRequest) (*pb.SetMockUrlResponse, error) {
+	method := normalizeMethod(req.Method)
+
 	logger.Info("Setting mock URL",
 		zap.String("url", req.Url),
+		zap.String("method", method),
 		zap.String("response_code", req.ResponseCode),
 		zap.String("response_header", req.ResponseHeader),
 		zap.String("response_body", req.ResponseBody),
@@ -56,160 +93,220 @@ func (s *MockService) SetMockUrl(ctx context.Context, req *pb.SetMockUrlRequest)
 		}
 	}
 
+	delaySpec, err := ParseDelaySpec(req.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to parse delay spec",
+			zap.String("delay_spec", req.DelaySpec),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Convert every rule before saving anything, so a bad rule leaves the stub as it was
+	rules := make([]*model.Rule, 0, len(req.Rules))
+	for i, pbRule := range req.Rules {
+		rule, err := RuleFromPb(pbRule)
+		if err != nil {
+			logger.Error("Failed to convert rule",
+				zap.Int("rule_index", i),
+				zap.Error(err))
+			return nil, err
+		}
+		rule.ID = 0
+		rules = append(rules, rule)
+	}
+
 	// Save main interface
-	interfaceID, err := s.storage.SaveMockUrl(
-		ctx,
-		req.Url,
-		req.ResponseCode,
-		respHeader,
-		req.ResponseBody,
-		req.Owner,
-		req.Description,
-		req.Meta,
-	)
+	interfaceID, err := s.storage.SaveMockUrl(ctx, &model.Interface{
+		URL:            req.Url,
+		Method:         method,
+		URLType:        NormalizeURLType(req.UrlType, req.Url),
+		ResponseCode:   req.ResponseCode,
+		ResponseHeader: respHeader,
+		ResponseBody:   req.ResponseBody,
+		Template:       req.Template,
+		DelaySpec:      delaySpec,
+		ProxyURL:       req.ProxyUrl,
+		Owner:          req.Owner,
+		Description:    req.Description,
+		Meta:           req.Meta,
+		Source:         req.Source,
+	})
 	if err != nil {
 		logger.Error("Failed to save mock URL",
 			zap.String("url", req.Url),
 			zap.Error(err))
 		return nil, err
 	}
+	defer s.invalidateRoutes(interfaceID)
 
 	logger.Info("Saved mock URL successfully",
 		zap.String("url", req.Url),
+		zap.String("method", method),
 		zap.Int64("interface_id", interfaceID))
 
-	// Save rules
-	for i, pbRule := range req.Rules {
-		var ruleHeader map[string]string
-		if pbRule.ResponseHeader != "" {
-			if err := json.Unmarshal([]byte(pbRule.ResponseHeader), &ruleHeader); err != nil {
-				logger.Error("Failed to parse rule response header",
-					zap.Int("rule_index", i),
-					zap.String("header", pbRule.ResponseHeader),
-					zap.Error(err))
-				return nil, err
-			}
-		}
-
-		rule := &model.Rule{
-			MatchType:      pbRule.MatchType,
-			MatchRule:      pbRule.MatchRule,
-			ResponseCode:   pbRule.ResponseCode,
-			ResponseHeader: ruleHeader,
-			ResponseBody:   pbRule.ResponseBody,
-			DelayTime:      pbRule.DelayTime,
-			Description:    pbRule.Description,
-			Meta:           pbRule.Meta,
-		}
-
-		if err := s.storage.SaveRule(ctx, interfaceID, rule); err != nil {
-			logger.Error("Failed to save rule",
-				zap.Int("rule_index", i),
-				zap.Int64("interface_id", interfaceID),
-				zap.Error(err))
-			return nil, err
-		}
-
-		logger.Debug("Saved rule successfully",
-			zap.Int("rule_index", i),
+	// Replace the interface's rules, so rules left out of this request stop matching
+	if err := s.storage.ReplaceRules(ctx, interfaceID, rules); err != nil {
+		logger.Error("Failed to save rules",
 			zap.Int64("interface_id", interfaceID),
-			zap.Int32("match_type", rule.MatchType))
+			zap.Error(err))
+		return nil, err
 	}
+	s.responses.forgetStub(interfaceID)
+
+	s.recordRevision(ctx, interfaceID, s.saveAction(ctx, interfaceID), "")
 
 	return &pb.SetMockUrlResponse{
 		Success: true,
 		Message: "Mock URL created successfully",
+		Id:      interfaceID,
 	}, nil
 }
 
+// saveAction tells whether saving a stub by URL and method created it or updated it,
+// going by its latest revision. A stub saved over a deleted or purged one counts as created.
+func (s *MockService) saveAction(ctx context.Context, interfaceID int64) string {
+	latest, err := s.storage.GetRevision(ctx, interfaceID, 0)
+	if err != nil || latest.Action == model.RevisionDelete || latest.Action == model.RevisionPurge {
+		return model.RevisionCreate
+	}
+	return model.RevisionUpdate
+}
+
 func (s *MockService) GetMockResponse(ctx context.Context, req *pb.MockRequest) (*pb.MockResponse, error) {
+	method := normalizeMethod(req.Method)
+
 	logger.Info("Getting mock response",
+		zap.String("method", method),
 		zap.String("url", req.Url),
 		zap.String("query_params", req.QueryParams))
 
-	mockResp, err := s.storage.GetMockResponse(ctx, req.Url)
+	mockResp, rules, err := s.findStub(ctx, method, req.Url)
+	if err == sql.ErrNoRows {
+		logger.Info("No stub matches the request",
+			zap.String("method", method),
+			zap.String("url", req.Url))
+		return nil, ErrNoMatch
+	}
 	if err != nil {
 		logger.Error("Failed to get mock response",
+			zap.String("method", method),
 			zap.String("url", req.Url),
 			zap.Error(err))
 		return nil, err
 	}
 
-	rules, err := s.storage.GetRules(ctx, mockResp.InterfaceID)
-	if err != nil {
-		logger.Error("Failed to get rules",
-			zap.Int64("interface_id", mockResp.InterfaceID),
-			zap.Error(err))
-		return nil, err
-	}
-
 	logger.Debug("Found rules for URL",
 		zap.String("url", req.Url),
 		zap.Int("rules_count", len(rules)))
 
+	matchReq := newMatchRequest(req, mockResp.PathParams)
 	for i, rule := range rules {
-		matches := false
-		if rule.MatchType == 1 && req.QueryParams == rule.MatchRule {
-			matches = true
-			logger.Debug("Query parameter rule matched",
+		matches, reason := matchReq.matchRule(&rule)
+		if !matches {
+			logger.Debug("Rule not matched",
 				zap.Int("rule_index", i),
-				zap.String("query_params", req.QueryParams))
-		} else if rule.MatchType == 2 && req.RequestBody == rule.MatchRule {
-			matches = true
-			logger.Debug("Request body rule matched",
-				zap.Int("rule_index", i),
-				zap.String("request_body", req.RequestBody))
+				zap.Int32("match_type", rule.MatchType),
+				zap.String("reason", reason))
+			continue
 		}
 
-		if matches {
-			if rule.DelayTime > 0 {
-				logger.Debug("Applying delay",
-					zap.Int32("delay_ms", rule.DelayTime))
-				time.Sleep(time.Duration(rule.DelayTime) * time.Millisecond)
-			}
+		if rule.Scenario != "" && !s.scenarios.transition(rule.Scenario, rule.RequiredState, rule.NewState) {
+			logger.Debug("Rule not matched",
+				zap.Int("rule_index", i),
+				zap.String("scenario", rule.Scenario),
+				zap.String("required_state", rule.RequiredState),
+				zap.String("reason", "scenario is not in the required state"))
+			continue
+		}
 
-			headerJSON, err := json.Marshal(rule.ResponseHeader)
-			if err != nil {
-				logger.Error("Failed to marshal rule response header",
-					zap.Int("rule_index", i),
+		logger.Debug("Rule matched",
+			zap.Int("rule_index", i),
+			zap.Int32("match_type", rule.MatchType),
+			zap.Int("conditions", len(rule.Conditions)))
+
+		if delay := sampleDelay(rule.DelaySpec, rule.DelayTime); delay > 0 {
+			logger.Debug("Applying delay",
+				zap.Duration("delay", delay))
+			if err := sleepContext(ctx, delay); err != nil {
+				logger.Debug("Request cancelled during delay",
+					zap.String("url", req.Url),
 					zap.Error(err))
 				return nil, err
 			}
+		}
 
-			return &pb.MockResponse{
-				ResponseCode:   rule.ResponseCode,
-				ResponseHeader: string(headerJSON),
-				ResponseBody:   rule.ResponseBody,
-			}, nil
+		picked := s.responses.pick(mockResp.InterfaceID, &rule)
+		resp, err := buildMockResponse(picked.ResponseCode, picked.ResponseHeader, picked.ResponseBody, rule.Template, matchReq)
+		if err != nil {
+			logger.Error("Failed to build rule response",
+				zap.Int("rule_index", i),
+				zap.Error(err))
+			return nil, err
+		}
+		resp.InterfaceId = mockResp.InterfaceID
+		resp.RuleId = rule.ID
+		if rule.Fault != "" {
+			logger.Debug("Injecting fault",
+				zap.Int("rule_index", i),
+				zap.String("fault", rule.Fault))
+			resp.Fault = rule.Fault
+			resp.FaultBandwidth = rule.FaultBandwidth
 		}
+		return resp, nil
+	}
+
+	if mockResp.ProxyURL != "" {
+		logger.Info("No rules matched, forwarding to the stub's upstream",
+			zap.String("url", req.Url),
+			zap.String("proxy_url", mockResp.ProxyURL))
+		return &pb.MockResponse{
+			ProxyUrl:    mockResp.ProxyURL,
+			InterfaceId: mockResp.InterfaceID,
+		}, nil
 	}
 
 	// If no rules match, return default response
 	logger.Info("No rules matched, using default response",
 		zap.String("url", req.Url))
 
-	headerJSON, err := json.Marshal(mockResp.ResponseHeader)
+	if delay := sampleDelay(mockResp.DelaySpec, 0); delay > 0 {
+		logger.Debug("Applying delay",
+			zap.Duration("delay", delay))
+		if err := sleepContext(ctx, delay); err != nil {
+			logger.Debug("Request cancelled during delay",
+				zap.String("url", req.Url),
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	resp, err := buildMockResponse(mockResp.ResponseCode, mockResp.ResponseHeader, mockResp.ResponseBody, mockResp.Template, matchReq)
 	if err != nil {
-		logger.Error("Failed to marshal default response header",
+		logger.Error("Failed to build default response",
 			zap.Error(err))
 		return nil, err
 	}
-
-	return &pb.MockResponse{
-		ResponseCode:   mockResp.ResponseCode,
-		ResponseHeader: string(headerJSON),
-		ResponseBody:   mockResp.ResponseBody,
-	}, nil
+	resp.InterfaceId = mockResp.InterfaceID
+	return resp, nil
 }
 
 func (s *MockService) GetAllMockUrls(ctx context.Context, req *pb.GetAllMockUrlsRequest) (*pb.GetAllMockUrlsResponse, error) {
 	logger.Info("Getting all mock URLs",
 		zap.String("keyword", req.Keyword),
 		zap.String("owner", req.Owner),
+		zap.String("status", req.Status),
 		zap.Int32("page", req.Page),
 		zap.Int32("pageSize", req.PageSize))
 
-	interfaces, total, err := s.storage.GetAllMockUrls(ctx, req.Keyword, req.Owner, int(req.Page), int(req.PageSize))
+	status := req.Status
+	if status == "" {
+		status = string(model.StatusActive)
+	}
+	if err := ValidateStatusFilter(status); err != nil {
+		return nil, err
+	}
+
+	interfaces, total, err := s.storage.GetAllMockUrls(ctx, req.Keyword, req.Owner, status, int(req.Page), int(req.PageSize))
 	if err != nil {
 		logger.Error("Failed to get mock URLs",
 			zap.Error(err))
@@ -218,59 +315,11 @@ func (s *MockService) GetAllMockUrls(ctx context.Context, req *pb.GetAllMockUrls
 
 	pbUrls := make([]*pb.MockUrl, 0, len(interfaces))
 	for _, iface := range interfaces {
-		// Convert interface header to JSON string
-		headerJSON, err := json.Marshal(iface.ResponseHeader)
-		if err != nil {
-			logger.Error("Failed to marshal interface response header",
-				zap.Int64("interface_id", iface.ID),
-				zap.Error(err))
-			return nil, err
-		}
-
-		// Get rules for each interface
-		rules, err := s.storage.GetRulesByInterfaceID(ctx, iface.ID)
+		pbUrl, err := s.mockUrlToPb(ctx, iface)
 		if err != nil {
-			logger.Error("Failed to get rules for interface",
-				zap.Int64("interface_id", iface.ID),
-				zap.Error(err))
 			return nil, err
 		}
-
-		// Convert rules to protobuf format
-		pbRules := make([]*pb.Rule, 0, len(rules))
-		for _, rule := range rules {
-			// Convert rule header to JSON string
-			ruleHeaderJSON, err := json.Marshal(rule.ResponseHeader)
-			if err != nil {
-				logger.Error("Failed to marshal rule response header",
-					zap.Int64("interface_id", iface.ID),
-					zap.Error(err))
-				return nil, err
-			}
-
-			pbRules = append(pbRules, &pb.Rule{
-				MatchType:      rule.MatchType,
-				MatchRule:      rule.MatchRule,
-				ResponseCode:   rule.ResponseCode,
-				ResponseHeader: string(ruleHeaderJSON),
-				ResponseBody:   rule.ResponseBody,
-				DelayTime:      rule.DelayTime,
-				Description:    rule.Description,
-				Meta:           rule.Meta,
-			})
-		}
-
-		pbUrls = append(pbUrls, &pb.MockUrl{
-			Id:             iface.ID,
-			Url:            iface.URL,
-			ResponseCode:   iface.ResponseCode,
-			ResponseHeader: string(headerJSON),
-			ResponseBody:   iface.ResponseBody,
-			Owner:          iface.Owner,
-			Description:    iface.Description,
-			Meta:           iface.Meta,
-			Rules:          pbRules,
-		})
+		pbUrls = append(pbUrls, pbUrl)
 	}
 
 	logger.Info("Retrieved mock URLs successfully",
@@ -300,86 +349,608 @@ func (s *MockService) GetRule(ctx context.Context, req *pb.GetRuleRequest) (*pb.
 
 	pbUrls := make([]*pb.MockUrl, 0, len(interfaces))
 	for _, iface := range interfaces {
-		// Convert interface header to JSON string
-		headerJSON, err := json.Marshal(iface.ResponseHeader)
+		pbUrl, err := s.mockUrlToPb(ctx, iface)
 		if err != nil {
-			logger.Error("Failed to marshal interface response header",
-				zap.Int64("interface_id", iface.ID),
+			return nil, err
+		}
+		pbUrls = append(pbUrls, pbUrl)
+	}
+
+	logger.Info("Retrieved mock URLs successfully",
+		zap.Int("count", len(pbUrls)))
+
+	return &pb.GetRuleResponse{
+		Success: true,
+		Message: "Mock URLs retrieved successfully",
+		Urls:    pbUrls,
+	}, nil
+}
+
+func (s *MockService) DeleteStub(ctx context.Context, req *pb.DeleteStubRequest) (*pb.DeleteStubResponse, error) {
+	defer s.invalidateRoutes(req.Id)
+
+	logger.Info("Delete stub",
+		zap.Int64("id", req.Id))
+
+	// The deleted stub can no longer be loaded, so take its snapshot beforehand
+	snapshot, snapshotErr := s.getMockUrlPb(ctx, req.Id)
+
+	err := s.storage.DeleteMockUrl(ctx, req.Id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: stub %d does not exist or is already deleted", ErrStubNotFound, req.Id)
+	}
+	if err != nil {
+		logger.Error("Failed to delete stub",
+			zap.Int64("id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+	s.responses.forgetStub(req.Id)
+
+	if snapshotErr == nil {
+		snapshot.Status = string(model.StatusDeleted)
+		snapshot.DeleteTime = time.Now().Format(time.RFC3339)
+		s.saveRevision(ctx, snapshot, model.RevisionDelete, "")
+	}
+
+	logger.Info("Delete stub successfully",
+		zap.Int64("id", req.Id))
+
+	return &pb.DeleteStubResponse{
+		Success: true,
+	}, nil
+}
+
+// FileStubs returns the ID, URL, method, status and source of every stub that has not
+// been deleted and was imported from a stub file
+func (s *MockService) FileStubs(ctx context.Context) ([]*model.Interface, error) {
+	routes, err := s.storage.GetMockUrlRoutes(ctx)
+	if err != nil {
+		logger.Error("Failed to list stubs imported from files",
+			zap.Error(err))
+		return nil, err
+	}
+
+	var stubs []*model.Interface
+	for _, route := range routes {
+		if strings.HasPrefix(route.Source, model.SourceFilePrefix) {
+			stubs = append(stubs, route)
+		}
+	}
+	return stubs, nil
+}
+
+// normalizeMethod upper-cases an HTTP method, treating an empty one as ANY
+func normalizeMethod(method string) string {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		return model.MethodAny
+	}
+	return method
+}
+
+func (s *MockService) ReorderRules(ctx context.Context, req *pb.ReorderRulesRequest) (*pb.ReorderRulesResponse, error) {
+	defer s.invalidateRoutes(req.Id)
+
+	logger.Info("Reorder rules",
+		zap.Int64("id", req.Id),
+		zap.Int64s("rule_ids", req.RuleIds))
+
+	if err := s.storage.ReorderRules(ctx, req.Id, req.RuleIds); err != nil {
+		logger.Error("Failed to reorder rules",
+			zap.Int64("id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+	s.recordRevision(ctx, req.Id, model.RevisionRuleReorder, "")
+
+	return &pb.ReorderRulesResponse{
+		Success: true,
+		Message: "Rules reordered successfully",
+	}, nil
+}
+
+// GetScenarios returns the current state of every scenario used by a rule
+func (s *MockService) GetScenarios(ctx context.Context, req *pb.GetScenariosRequest) (*pb.GetScenariosResponse, error) {
+	logger.Info("Getting scenarios")
+
+	names, err := s.storage.GetScenarios(ctx)
+	if err != nil {
+		logger.Error("Failed to get scenarios",
+			zap.Error(err))
+		return nil, err
+	}
+
+	states := s.scenarios.snapshot(names)
+	scenarios := make([]*pb.ScenarioState, 0, len(states))
+	for _, name := range sortedScenarioNames(states) {
+		scenarios = append(scenarios, &pb.ScenarioState{
+			Name:  name,
+			State: states[name],
+		})
+	}
+
+	return &pb.GetScenariosResponse{
+		Success:   true,
+		Scenarios: scenarios,
+	}, nil
+}
+
+// ResetScenarios returns the named scenario, or every scenario when no name is given,
+// to its initial state, and rewinds the response sequences of its rules
+func (s *MockService) ResetScenarios(ctx context.Context, req *pb.ResetScenariosRequest) (*pb.ResetScenariosResponse, error) {
+	logger.Info("Resetting scenarios",
+		zap.String("name", req.Name))
+
+	s.scenarios.reset(req.Name)
+	s.responses.reset(req.Name)
+
+	message := "All scenarios reset"
+	if req.Name != "" {
+		message = "Scenario " + req.Name + " reset"
+	}
+	return &pb.ResetScenariosResponse{
+		Success: true,
+		Message: message,
+	}, nil
+}
+
+// UpdateMockUrl overwrites an existing stub, which may change its URL and method. With
+// ReplaceRules the stub's rules are synced with the request's: rules with an ID are
+// updated in place, rules without one are created and the stub's other rules are deleted.
+// Otherwise the rules are left untouched. With ExpectedVersion the update is refused with
+// ErrStubChanged when the stub has moved past that version.
+func (s *MockService) UpdateMockUrl(ctx context.Context, req *pb.UpdateMockUrlRequest) (*pb.UpdateMockUrlResponse, error) {
+	defer s.invalidateRoutes(req.Id)
+
+	if _, err := s.updateMockUrl(ctx, req); err != nil {
+		return nil, err
+	}
+
+	pbUrl, err := s.getMockUrlPb(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	s.saveRevision(ctx, pbUrl, model.RevisionUpdate, "")
+
+	return &pb.UpdateMockUrlResponse{
+		Success: true,
+		Message: "Mock URL updated successfully",
+		Url:     pbUrl,
+	}, nil
+}
+
+// updateMockUrl applies a stub update and returns the synced rules, in request order
+// with their IDs set, when ReplaceRules is set
+func (s *MockService) updateMockUrl(ctx context.Context, req *pb.UpdateMockUrlRequest) ([]*model.Rule, error) {
+	stub := req.Stub
+	if stub == nil {
+		return nil, errors.New("stub is required")
+	}
+	method := normalizeMethod(stub.Method)
+
+	logger.Info("Updating mock URL",
+		zap.Int64("id", req.Id),
+		zap.String("url", stub.Url),
+		zap.String("method", method),
+		zap.Bool("replace_rules", req.ReplaceRules),
+		zap.Int("rules_count", len(stub.Rules)))
+
+	var respHeader map[string]string
+	if stub.ResponseHeader != "" {
+		if err := json.Unmarshal([]byte(stub.ResponseHeader), &respHeader); err != nil {
+			logger.Error("Failed to parse response header",
+				zap.String("header", stub.ResponseHeader),
 				zap.Error(err))
 			return nil, err
 		}
+	}
+
+	delaySpec, err := ParseDelaySpec(stub.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to parse delay spec",
+			zap.String("delay_spec", stub.DelaySpec),
+			zap.Error(err))
+		return nil, err
+	}
 
-		// Get rules for each interface
-		rules, err := s.storage.GetRulesByInterfaceID(ctx, iface.ID)
+	// Check the rules before changing anything, so a bad rule ID leaves the stub as it was
+	var rules []*model.Rule
+	var current []*model.Rule
+	if req.ReplaceRules {
+		current, err = s.storage.GetRulesByInterfaceID(ctx, req.Id)
 		if err != nil {
-			logger.Error("Failed to get rules for interface",
-				zap.Int64("interface_id", iface.ID),
-				zap.Error(err))
 			return nil, err
 		}
+		owned := make(map[int64]bool, len(current))
+		for _, rule := range current {
+			owned[rule.ID] = true
+		}
 
-		// Convert rules to protobuf format
-		pbRules := make([]*pb.Rule, 0, len(rules))
-		for _, rule := range rules {
-			// Convert rule header to JSON string
-			ruleHeaderJSON, err := json.Marshal(rule.ResponseHeader)
+		for i, pbRule := range stub.Rules {
+			rule, err := RuleFromPb(pbRule)
 			if err != nil {
-				logger.Error("Failed to marshal rule response header",
-					zap.Int64("interface_id", iface.ID),
+				logger.Error("Failed to convert rule",
+					zap.Int("rule_index", i),
 					zap.Error(err))
 				return nil, err
 			}
+			if rule.ID != 0 && !owned[rule.ID] {
+				return nil, fmt.Errorf("%w: rule %d, stub %d", ErrRuleNotInStub, rule.ID, req.Id)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	err = s.storage.UpdateMockUrl(ctx, &model.Interface{
+		ID:             req.Id,
+		URL:            stub.Url,
+		Method:         method,
+		URLType:        NormalizeURLType(stub.UrlType, stub.Url),
+		ResponseCode:   stub.ResponseCode,
+		ResponseHeader: respHeader,
+		ResponseBody:   stub.ResponseBody,
+		Template:       stub.Template,
+		DelaySpec:      delaySpec,
+		ProxyURL:       stub.ProxyUrl,
+		Owner:          stub.Owner,
+		Description:    stub.Description,
+		Meta:           stub.Meta,
+		Version:        req.ExpectedVersion,
+	})
+	if err == sql.ErrNoRows {
+		return nil, ErrStubNotFound
+	}
+	if err == storage.ErrVersionConflict {
+		return nil, fmt.Errorf("%w: stub %d is no longer at version %d", ErrStubChanged, req.Id, req.ExpectedVersion)
+	}
+	if err != nil {
+		logger.Error("Failed to update mock URL",
+			zap.Int64("id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
 
-			pbRules = append(pbRules, &pb.Rule{
-				MatchType:      rule.MatchType,
-				MatchRule:      rule.MatchRule,
-				ResponseCode:   rule.ResponseCode,
-				ResponseHeader: string(ruleHeaderJSON),
-				ResponseBody:   rule.ResponseBody,
-				DelayTime:      rule.DelayTime,
-				Description:    rule.Description,
-				Meta:           rule.Meta,
-			})
+	if req.ReplaceRules {
+		err := s.storage.ReplaceRules(ctx, req.Id, rules)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: stub %d", ErrRuleNotInStub, req.Id)
 		}
+		if err != nil {
+			logger.Error("Failed to replace rules",
+				zap.Int64("id", req.Id),
+				zap.Error(err))
+			return nil, err
+		}
+		s.responses.forgetStub(req.Id)
+	}
+	return rules, nil
+}
 
-		pbUrls = append(pbUrls, &pb.MockUrl{
-			Id:             iface.ID,
-			Url:            iface.URL,
-			ResponseCode:   iface.ResponseCode,
-			ResponseHeader: string(headerJSON),
-			ResponseBody:   iface.ResponseBody,
-			Owner:          iface.Owner,
-			Description:    iface.Description,
-			Meta:           iface.Meta,
-			Rules:          pbRules,
-		})
+// getMockUrlPb loads an active stub with its rules in protobuf form
+func (s *MockService) getMockUrlPb(ctx context.Context, id int64) (*pb.MockUrl, error) {
+	interfaces, err := s.storage.GetMockUrl(ctx, id)
+	if err != nil {
+		logger.Error("Failed to get mock URL",
+			zap.Int64("id", id),
+			zap.Error(err))
+		return nil, err
+	}
+	if len(interfaces) == 0 {
+		return nil, ErrStubNotFound
 	}
+	return s.mockUrlToPb(ctx, interfaces[0])
+}
 
-	logger.Info("Retrieved mock URLs successfully",
-		zap.Int("count", len(pbUrls)))
+// GetRuleByID returns a single rule
+func (s *MockService) GetRuleByID(ctx context.Context, req *pb.GetRuleByIdRequest) (*pb.RuleResult, error) {
+	logger.Info("Getting rule",
+		zap.Int64("rule_id", req.Id))
 
-	return &pb.GetRuleResponse{
+	rule, err := s.storage.GetRuleByID(ctx, req.Id)
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		logger.Error("Failed to get rule",
+			zap.Int64("rule_id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+
+	pbRule, err := ruleToPb(rule)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RuleResult{
 		Success: true,
-		Message: "Mock URLs retrieved successfully",
-		Urls:    pbUrls,
+		Message: "Rule retrieved successfully",
+		Rule:    pbRule,
 	}, nil
 }
 
-func (s *MockService) DeleteStub(ctx context.Context, req *pb.DeleteStubRequest) (*pb.DeleteStubResponse, error) {
-	logger.Info("Delete stub",
+// CreateRule adds a rule to a stub. A rule without a priority is evaluated after the
+// stub's existing rules.
+func (s *MockService) CreateRule(ctx context.Context, req *pb.CreateRuleRequest) (*pb.RuleResult, error) {
+	defer s.invalidateRoutes(req.InterfaceId)
+
+	logger.Info("Creating rule",
+		zap.Int64("interface_id", req.InterfaceId))
+
+	if req.Rule == nil {
+		return nil, errors.New("rule is required")
+	}
+	rule, err := RuleFromPb(req.Rule)
+	if err != nil {
+		logger.Error("Failed to convert rule",
+			zap.Error(err))
+		return nil, err
+	}
+	rule.ID = 0
+
+	interfaces, err := s.storage.GetMockUrl(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	if len(interfaces) == 0 {
+		return nil, ErrStubNotFound
+	}
+
+	if rule.Priority == 0 {
+		current, err := s.storage.GetRulesByInterfaceID(ctx, req.InterfaceId)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range current {
+			if r.Priority >= rule.Priority {
+				rule.Priority = r.Priority + 1
+			}
+		}
+	}
+
+	if err := s.storage.SaveRule(ctx, req.InterfaceId, rule); err != nil {
+		logger.Error("Failed to save rule",
+			zap.Int64("interface_id", req.InterfaceId),
+			zap.Error(err))
+		return nil, err
+	}
+	rule.InterfaceID = req.InterfaceId
+	s.recordRevision(ctx, req.InterfaceId, model.RevisionRuleCreate, fmt.Sprintf("rule %d", rule.ID))
+
+	pbRule, err := ruleToPb(rule)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RuleResult{
+		Success: true,
+		Message: "Rule created successfully",
+		Rule:    pbRule,
+	}, nil
+}
+
+// UpdateRule overwrites a rule, keeping its ID and stub
+func (s *MockService) UpdateRule(ctx context.Context, req *pb.UpdateRuleRequest) (*pb.RuleResult, error) {
+	defer s.invalidateRuleRoutes(ctx, req.Id)
+
+	logger.Info("Updating rule",
+		zap.Int64("rule_id", req.Id))
+
+	if req.Rule == nil {
+		return nil, errors.New("rule is required")
+	}
+	rule, err := RuleFromPb(req.Rule)
+	if err != nil {
+		logger.Error("Failed to convert rule",
+			zap.Error(err))
+		return nil, err
+	}
+	rule.ID = req.Id
+
+	err = s.storage.UpdateRule(ctx, rule)
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		logger.Error("Failed to update rule",
+			zap.Int64("rule_id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+	s.responses.forgetRule(req.Id)
+	s.recordRuleRevision(ctx, req.Id, model.RevisionRuleUpdate)
+
+	resp, err := s.GetRuleByID(ctx, &pb.GetRuleByIdRequest{Id: req.Id})
+	if err != nil {
+		return nil, err
+	}
+	resp.Message = "Rule updated successfully"
+	return resp, nil
+}
+
+func (s *MockService) DeleteRule(ctx context.Context, req *pb.DeleteRuleRequest) (*pb.DeleteRuleResponse, error) {
+	logger.Info("Deleting rule",
+		zap.Int64("rule_id", req.Id))
+
+	rule, err := s.storage.GetRuleByID(ctx, req.Id)
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer s.invalidateRoutes(rule.InterfaceID)
+
+	err = s.storage.DeleteRule(ctx, req.Id)
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		logger.Error("Failed to delete rule",
+			zap.Int64("rule_id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+	s.responses.forgetRule(req.Id)
+	s.recordRevision(ctx, rule.InterfaceID, model.RevisionRuleDelete, fmt.Sprintf("rule %d", req.Id))
+
+	return &pb.DeleteRuleResponse{
+		Success: true,
+		Message: "Rule deleted successfully",
+	}, nil
+}
+
+// RestoreStub brings back a deleted stub together with the rules deleted with it
+func (s *MockService) RestoreStub(ctx context.Context, req *pb.RestoreStubRequest) (*pb.RestoreStubResponse, error) {
+	defer s.invalidateRoutes(req.Id)
+
+	logger.Info("Restoring stub",
 		zap.Int64("id", req.Id))
 
-	err := s.storage.DeleteMockUrl(ctx, req.Id)
+	err := s.storage.RestoreMockUrl(ctx, req.Id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: no deleted stub has id %d", ErrStubNotFound, req.Id)
+	}
 	if err != nil {
-		logger.Error("Failed to get mock URLs",
+		logger.Error("Failed to restore stub",
+			zap.Int64("id", req.Id),
 			zap.Error(err))
 		return nil, err
 	}
 
-	logger.Info("Delete stub successfully",
+	pbUrl, err := s.getMockUrlPb(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	s.saveRevision(ctx, pbUrl, model.RevisionRestore, "")
+
+	return &pb.RestoreStubResponse{
+		Success: true,
+		Message: "Stub restored successfully",
+		Url:     pbUrl,
+	}, nil
+}
+
+// PurgeStub removes a deleted stub and all of its rules for good. Its revisions are kept,
+// ending with a purge revision of the stub as it was deleted.
+func (s *MockService) PurgeStub(ctx context.Context, req *pb.PurgeStubRequest) (*pb.PurgeStubResponse, error) {
+	defer s.invalidateRoutes(req.Id)
+
+	logger.Info("Purging stub",
 		zap.Int64("id", req.Id))
 
-	return &pb.DeleteStubResponse{
+	// A deleted stub can no longer be loaded, so its latest revision stands in for it
+	snapshot := &pb.MockUrl{Id: req.Id, Status: string(model.StatusDeleted)}
+	if _, latest, err := s.loadRevision(ctx, req.Id, 0); err == nil {
+		snapshot = latest
+	}
+
+	err := s.storage.PurgeMockUrl(ctx, req.Id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: no deleted stub has id %d", ErrStubNotFound, req.Id)
+	}
+	if err != nil {
+		logger.Error("Failed to purge stub",
+			zap.Int64("id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+	s.responses.forgetStub(req.Id)
+	s.saveRevision(ctx, snapshot, model.RevisionPurge, "")
+
+	return &pb.PurgeStubResponse{
 		Success: true,
+		Message: "Stub purged successfully",
 	}, nil
 }
+
+// SetMockUrlStatus activates or deactivates a stub. An inactive stub is kept with its
+// rules but matches no request.
+func (s *MockService) SetMockUrlStatus(ctx context.Context, req *pb.SetStatusRequest) (*pb.SetStatusResponse, error) {
+	defer s.invalidateRoutes(req.Id)
+
+	logger.Info("Setting mock URL status",
+		zap.Int64("id", req.Id),
+		zap.String("status", req.Status))
+
+	status, err := parseToggleStatus(req.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storage.SetMockUrlStatus(ctx, req.Id, status)
+	if err == sql.ErrNoRows {
+		return nil, ErrStubNotFound
+	}
+	if err != nil {
+		logger.Error("Failed to set mock URL status",
+			zap.Int64("id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+	action := model.RevisionActivate
+	if status == model.StatusInactive {
+		action = model.RevisionDeactivate
+	}
+	s.recordRevision(ctx, req.Id, action, "")
+
+	return &pb.SetStatusResponse{
+		Success: true,
+		Message: "Mock URL is now " + string(status),
+	}, nil
+}
+
+// SetRuleStatus activates or deactivates a rule. An inactive rule is skipped when matching.
+func (s *MockService) SetRuleStatus(ctx context.Context, req *pb.SetStatusRequest) (*pb.SetStatusResponse, error) {
+	defer s.invalidateRuleRoutes(ctx, req.Id)
+
+	logger.Info("Setting rule status",
+		zap.Int64("rule_id", req.Id),
+		zap.String("status", req.Status))
+
+	status, err := parseToggleStatus(req.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storage.SetRuleStatus(ctx, req.Id, status)
+	if err == sql.ErrNoRows {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		logger.Error("Failed to set rule status",
+			zap.Int64("rule_id", req.Id),
+			zap.Error(err))
+		return nil, err
+	}
+	action := model.RevisionRuleActivate
+	if status == model.StatusInactive {
+		action = model.RevisionRuleDeactivate
+	}
+	s.recordRuleRevision(ctx, req.Id, action)
+
+	return &pb.SetStatusResponse{
+		Success: true,
+		Message: "Rule is now " + string(status),
+	}, nil
+}
+
+// parseToggleStatus accepts the statuses a stub or rule can be switched between
+func parseToggleStatus(status string) (model.Status, error) {
+	switch s := model.Status(strings.ToLower(status)); s {
+	case model.StatusActive, model.StatusInactive:
+		return s, nil
+	default:
+		return "", fmt.Errorf("%w %q, must be %s or %s", ErrInvalidStatus, status, model.StatusActive, model.StatusInactive)
+	}
+}
+
+// ValidateStatusFilter checks the status stubs are listed by
+func ValidateStatusFilter(status string) error {
+	switch status {
+	case string(model.StatusActive), string(model.StatusInactive), string(model.StatusDeleted), model.StatusFilterAll:
+		return nil
+	default:
+		return fmt.Errorf("%w filter %q, must be %s, %s, %s or %s", ErrInvalidStatus, status,
+			model.StatusActive, model.StatusInactive, model.StatusDeleted, model.StatusFilterAll)
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/urlmatch"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultUnmatchedLimit is the number of unmatched requests reported when no limit is given
+	defaultUnmatchedLimit = 20
+	// defaultNearMissCandidates is the number of near misses reported per unmatched request
+	// when no number is given
+	defaultNearMissCandidates = 3
+)
+
+// GetUnmatchedRequests reports the most recent journaled requests that matched no stub,
+// newest first, each with the stubs that came closest to matching it. Near misses are
+// computed against the stubs as they are now, not as they were when the request came in.
+func (s *MockService) GetUnmatchedRequests(ctx context.Context, req *pb.GetUnmatchedRequestsRequest) (*pb.GetUnmatchedRequestsResponse, error) {
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultUnmatchedLimit
+	}
+	candidates := int(req.Candidates)
+	if candidates <= 0 {
+		candidates = defaultNearMissCandidates
+	}
+
+	logger.Info("Getting unmatched requests",
+		zap.Int("limit", limit),
+		zap.Int("candidates", candidates))
+
+	var unmatched []model.JournalEntry
+	for _, entry := range s.journal.snapshot() {
+		if entry.Unmatched {
+			unmatched = append(unmatched, entry)
+		}
+	}
+
+	routes, err := s.storage.GetMockUrlRoutes(ctx)
+	if err != nil {
+		logger.Error("Failed to get mock URL routes",
+			zap.Error(err))
+		return nil, err
+	}
+
+	resp := &pb.GetUnmatchedRequestsResponse{
+		Success: true,
+		Count:   int32(len(unmatched)),
+	}
+	rules := make(map[int64][]model.Rule)
+	for i := 0; i < len(unmatched) && i < limit; i++ {
+		misses, err := s.findNearMisses(ctx, &unmatched[i], routes, candidates, rules)
+		if err != nil {
+			return nil, err
+		}
+
+		item := &pb.UnmatchedRequest{Request: journalEntryToPb(&unmatched[i])}
+		for _, miss := range misses {
+			item.NearMisses = append(item.NearMisses, nearMissToPb(miss))
+		}
+		resp.Requests = append(resp.Requests, item)
+	}
+	return resp, nil
+}
+
+// findNearMisses ranks the stubs by how close they come to matching a request and
+// returns the closest ones. Stubs whose URL has nothing in common with the request's are
+// left out. rules caches the rules of each stub across calls.
+func (s *MockService) findNearMisses(ctx context.Context, entry *model.JournalEntry, routes []*model.Interface, n int, rules map[int64][]model.Rule) ([]*model.NearMiss, error) {
+	method := normalizeMethod(entry.Method)
+
+	type candidate struct {
+		miss       *model.NearMiss
+		pathParams map[string]string
+	}
+	var candidates []candidate
+	for _, iface := range routes {
+		pathParams, urlScore, urlReason := urlNearMiss(iface.URLType, iface.URL, entry.URL)
+		if urlScore == 0 {
+			continue
+		}
+
+		miss := &model.NearMiss{
+			InterfaceID: iface.ID,
+			URL:         iface.URL,
+			URLType:     iface.URLType,
+			Method:      iface.Method,
+			Score:       0.75 * urlScore,
+		}
+		if iface.Method == method || iface.Method == model.MethodAny {
+			miss.Score += 0.25
+		} else {
+			miss.Reasons = append(miss.Reasons, fmt.Sprintf("method is %s, stub expects %s", method, iface.Method))
+		}
+		if urlReason != "" {
+			miss.Reasons = append(miss.Reasons, urlReason)
+		}
+		if iface.Status == model.StatusInactive {
+			miss.Reasons = append(miss.Reasons, "stub is inactive")
+		}
+		candidates = append(candidates, candidate{miss: miss, pathParams: pathParams})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].miss.Score > candidates[j].miss.Score
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+
+	misses := make([]*model.NearMiss, 0, len(candidates))
+	for _, c := range candidates {
+		stubRules, ok := rules[c.miss.InterfaceID]
+		if !ok {
+			var err error
+			stubRules, err = s.storage.GetRules(ctx, c.miss.InterfaceID)
+			if err != nil {
+				logger.Error("Failed to get rules",
+					zap.Int64("interface_id", c.miss.InterfaceID),
+					zap.Error(err))
+				return nil, err
+			}
+			rules[c.miss.InterfaceID] = stubRules
+		}
+
+		m := newJournalMatchRequest(entry, c.pathParams)
+		for i := range stubRules {
+			c.miss.Rules = append(c.miss.Rules, s.explainRule(m, &stubRules[i]))
+		}
+		misses = append(misses, c.miss)
+	}
+	return misses, nil
+}
+
+// explainRule tells whether a rule matches a request, applying the same checks as
+// GetMockResponse without moving the rule's scenario on
+func (s *MockService) explainRule(m *matchRequest, rule *model.Rule) model.RuleMiss {
+	matched, reason := m.matchRule(rule)
+	if matched && rule.Scenario != "" && rule.RequiredState != "" {
+		if state := s.scenarios.state(rule.Scenario); state != rule.RequiredState {
+			matched = false
+			reason = fmt.Sprintf("scenario %s is in state %s, rule requires %s", rule.Scenario, state, rule.RequiredState)
+		}
+	}
+	return model.RuleMiss{RuleID: rule.ID, Matched: matched, Reason: reason}
+}
+
+// urlNearMiss compares a request path with a stub URL. When the path matches it returns
+// the captured path parameters and a score of 1. Otherwise the score is the share of path
+// segments that agree, and the reason points at the first one that does not.
+func urlNearMiss(urlType, url, path string) (map[string]string, float64, string) {
+	switch urlType {
+	case model.URLTypeTemplate:
+		p, err := urlmatch.CompileTemplate(url)
+		if err != nil {
+			return nil, 0, ""
+		}
+		if params, ok := p.Match(path); ok {
+			return params, 1, ""
+		}
+	case model.URLTypeRegex:
+		p, err := urlmatch.CompileRegex(url)
+		if err != nil {
+			return nil, 0, ""
+		}
+		if params, ok := p.Match(path); ok {
+			return params, 1, ""
+		}
+		// A regex gives no segments to compare
+		return nil, 0, ""
+	default:
+		if url == path {
+			return nil, 1, ""
+		}
+	}
+
+	want, got := pathSegments(url), pathSegments(path)
+	same := 0
+	reason := ""
+	for i := 0; i < len(want) && i < len(got); i++ {
+		if segmentAgrees(want[i], got[i]) {
+			same++
+		} else if reason == "" {
+			reason = fmt.Sprintf("path segment %d is %q, stub expects %q", i+1, got[i], want[i])
+		}
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("path has %d segments, stub expects %d", len(got), len(want))
+	}
+
+	total := len(want)
+	if len(got) > total {
+		total = len(got)
+	}
+	if total == 0 {
+		return nil, 0, reason
+	}
+	return nil, float64(same) / float64(total), reason
+}
+
+func pathSegments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// segmentAgrees reports whether a request path segment fits a stub URL segment, treating
+// template parameters and wildcards as fitting anything
+func segmentAgrees(want, got string) bool {
+	if want == "*" || want == "**" || (strings.HasPrefix(want, "{") && strings.HasSuffix(want, "}")) {
+		return true
+	}
+	return want == got
+}
+
+func nearMissToPb(miss *model.NearMiss) *pb.NearMiss {
+	pbMiss := &pb.NearMiss{
+		InterfaceId: miss.InterfaceID,
+		Url:         miss.URL,
+		UrlType:     miss.URLType,
+		Method:      miss.Method,
+		Score:       miss.Score,
+		Reasons:     miss.Reasons,
+	}
+	for _, rule := range miss.Rules {
+		pbMiss.Rules = append(pbMiss.Rules, &pb.RuleMiss{
+			RuleId:  rule.RuleID,
+			Matched: rule.Matched,
+			Reason:  rule.Reason,
+		})
+	}
+	return pbMiss
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/urlmatch"
+)
+
+// pathParamRef matches ${path.name} placeholders in response bodies and header values
+var pathParamRef = regexp.MustCompile(`\$\{path\.([^}]+)\}`)
+
+// NormalizeURLType returns the url_type to store for a stub URL. An empty url_type is
+// inferred from the URL: template syntax makes it a template, otherwise it is exact.
+func NormalizeURLType(urlType, url string) string {
+	urlType = strings.ToLower(strings.TrimSpace(urlType))
+	if urlType != "" {
+		return urlType
+	}
+	if urlmatch.IsTemplate(url) {
+		return model.URLTypeTemplate
+	}
+	return model.URLTypeExact
+}
+
+// ValidateURL checks that a stub URL is valid for its url_type
+func ValidateURL(urlType, url string) error {
+	switch NormalizeURLType(urlType, url) {
+	case model.URLTypeExact:
+		if !strings.HasPrefix(url, "/") {
+			return fmt.Errorf("URL must start with a forward slash (/)")
+		}
+		return nil
+	case model.URLTypeTemplate:
+		_, err := urlmatch.CompileTemplate(url)
+		return err
+	case model.URLTypeRegex:
+		_, err := urlmatch.CompileRegex(url)
+		return err
+	default:
+		return fmt.Errorf("url_type must be one of %s, %s or %s",
+			model.URLTypeExact, model.URLTypeTemplate, model.URLTypeRegex)
+	}
+}
+
+// expandPathParams replaces ${path.name} placeholders with captured path parameters.
+// Placeholders for parameters that were not captured are left untouched.
+func expandPathParams(s string, params map[string]string) string {
+	if len(params) == 0 || !strings.Contains(s, "${path.") {
+		return s
+	}
+	return pathParamRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := pathParamRef.FindStringSubmatch(ref)[1]
+		if v, ok := params[name]; ok {
+			return v
+		}
+		return ref
+	})
+}
+
+// expandHeaderPathParams applies expandPathParams to every header value
+func expandHeaderPathParams(headers map[string]string, params map[string]string) map[string]string {
+	if len(params) == 0 {
+		return headers
+	}
+	expanded := make(map[string]string, len(headers))
+	for k, v := range headers {
+		expanded[k] = expandPathParams(v, params)
+	}
+	return expanded
+}
+
+// ValidateProxyURL checks that an upstream to forward requests to is an absolute http or
+// https URL
+func ValidateProxyURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL %q: %v", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("proxy URL %q must be an absolute http or https URL", rawURL)
+	}
+	return nil
+}
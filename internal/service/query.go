@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/lru"
+)
+
+// regexCache holds regular expressions used by rules, keyed by their source
+var regexCache = lru.New(4096)
+
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Get(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Add(expr, re)
+	return re, nil
+}
+
+// ParseQueryRule parses a match_type 1 rule into query conditions. A plain query string
+// such as "a=1&b=2&tag=x&tag=y" becomes one equals condition per key, and a JSON array is
+// decoded as a list of model.QueryCondition.
+func ParseQueryRule(matchRule string) ([]model.QueryCondition, error) {
+	trimmed := strings.TrimSpace(matchRule)
+	if strings.HasPrefix(trimmed, "[") {
+		var conditions []model.QueryCondition
+		if err := json.Unmarshal([]byte(trimmed), &conditions); err != nil {
+			return nil, fmt.Errorf("query rule is not a valid JSON array of conditions: %v", err)
+		}
+		if len(conditions) == 0 {
+			return nil, fmt.Errorf("query rule must contain at least one condition")
+		}
+		for i := range conditions {
+			if err := validateQueryCondition(&conditions[i]); err != nil {
+				return nil, fmt.Errorf("query condition %d: %v", i+1, err)
+			}
+		}
+		return conditions, nil
+	}
+
+	if !strings.Contains(trimmed, "=") {
+		return nil, fmt.Errorf("query rule must be a query string such as a=1&b=2 or a JSON array of conditions")
+	}
+	values, err := url.ParseQuery(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("query rule is not a valid query string: %v", err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	conditions := make([]model.QueryCondition, 0, len(keys))
+	for _, k := range keys {
+		conditions = append(conditions, model.QueryCondition{
+			Key:    k,
+			Op:     model.QueryOpEquals,
+			Values: values[k],
+		})
+	}
+	return conditions, nil
+}
+
+func validateQueryCondition(cond *model.QueryCondition) error {
+	if cond.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if cond.Op == "" {
+		cond.Op = model.QueryOpEquals
+	}
+
+	switch cond.Op {
+	case model.QueryOpEquals, model.QueryOpContains:
+		return nil
+	case model.QueryOpRegex:
+		for _, expr := range expectedQueryValues(*cond) {
+			if _, err := compileRegex(expr); err != nil {
+				return fmt.Errorf("invalid regex %q: %v", expr, err)
+			}
+		}
+		return nil
+	case model.QueryOpPresent, model.QueryOpAbsent:
+		if cond.Value != "" || len(cond.Values) > 0 {
+			return fmt.Errorf("op %s does not take a value", cond.Op)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown op %q, must be one of equals, contains, regex, present or absent", cond.Op)
+	}
+}
+
+// matchQuery checks every condition of a match_type 1 rule against the request query.
+// Parameters the rule does not mention are ignored and parameter order does not matter.
+func (m *matchRequest) matchQuery(matchRule string) (bool, string) {
+	conditions, err := ParseQueryRule(matchRule)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	actual, _ := url.ParseQuery(m.query)
+	for _, cond := range conditions {
+		if ok, reason := matchQueryCondition(cond, actual[cond.Key]); !ok {
+			return false, reason
+		}
+	}
+	return true, ""
+}
+
+func matchQueryCondition(cond model.QueryCondition, actual []string) (bool, string) {
+	switch cond.Op {
+	case model.QueryOpPresent:
+		if len(actual) == 0 {
+			return false, fmt.Sprintf("query parameter %s is missing", cond.Key)
+		}
+		return true, ""
+	case model.QueryOpAbsent:
+		if len(actual) > 0 {
+			return false, fmt.Sprintf("query parameter %s is present", cond.Key)
+		}
+		return true, ""
+	}
+
+	if len(actual) == 0 {
+		return false, fmt.Sprintf("query parameter %s is missing", cond.Key)
+	}
+	for _, want := range expectedQueryValues(cond) {
+		if !anyQueryValueMatches(cond.Op, want, actual) {
+			return false, fmt.Sprintf("query parameter %s is %q, want %s %q", cond.Key, actual, cond.Op, want)
+		}
+	}
+	return true, ""
+}
+
+func expectedQueryValues(cond model.QueryCondition) []string {
+	if len(cond.Values) > 0 {
+		return cond.Values
+	}
+	return []string{cond.Value}
+}
+
+func anyQueryValueMatches(op, want string, actual []string) bool {
+	for _, got := range actual {
+		switch op {
+		case model.QueryOpEquals:
+			if got == want {
+				return true
+			}
+		case model.QueryOpContains:
+			if strings.Contains(got, want) {
+				return true
+			}
+		case model.QueryOpRegex:
+			if re, err := compileRegex(want); err == nil && re.MatchString(got) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+)
+
+func TestParseQueryRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		want    []model.QueryCondition
+		wantErr bool
+	}{
+		{
+			name: "query string",
+			rule: "b=2&a=1",
+			want: []model.QueryCondition{
+				{Key: "a", Op: model.QueryOpEquals, Values: []string{"1"}},
+				{Key: "b", Op: model.QueryOpEquals, Values: []string{"2"}},
+			},
+		},
+		{
+			name: "repeated key",
+			rule: "tag=x&tag=y",
+			want: []model.QueryCondition{
+				{Key: "tag", Op: model.QueryOpEquals, Values: []string{"x", "y"}},
+			},
+		},
+		{
+			name: "empty value",
+			rule: "a=",
+			want: []model.QueryCondition{
+				{Key: "a", Op: model.QueryOpEquals, Values: []string{""}},
+			},
+		},
+		{
+			name: "JSON conditions default to equals",
+			rule: `[{"key": "a", "value": "1"}, {"key": "b", "op": "present"}]`,
+			want: []model.QueryCondition{
+				{Key: "a", Op: model.QueryOpEquals, Value: "1"},
+				{Key: "b", Op: model.QueryOpPresent},
+			},
+		},
+		{name: "no equals sign", rule: "abc", wantErr: true},
+		{name: "bad escape", rule: "a=%zz", wantErr: true},
+		{name: "empty JSON array", rule: `[]`, wantErr: true},
+		{name: "JSON without key", rule: `[{"value": "1"}]`, wantErr: true},
+		{name: "unknown op", rule: `[{"key": "a", "op": "like"}]`, wantErr: true},
+		{name: "present with value", rule: `[{"key": "a", "op": "present", "value": "1"}]`, wantErr: true},
+		{name: "bad regex", rule: `[{"key": "a", "op": "regex", "value": "("}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQueryRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQueryRule(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQueryRule(%q) = %+v, want %+v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		query string
+		want  bool
+	}{
+		{"equal", "a=1", "a=1", true},
+		{"order and extra parameters ignored", "a=1&b=2", "c=3&b=2&a=1", true},
+		{"different value", "a=1", "a=2", false},
+		{"missing parameter", "a=1", "b=1", false},
+		{"escaped value", "q=hello%20world", "q=hello+world", true},
+
+		// Every value of a repeated rule key must be among the request's values
+		{"repeated rule key, all present", "tag=x&tag=y", "tag=y&tag=x", true},
+		{"repeated rule key, extra request value", "tag=x&tag=y", "tag=x&tag=y&tag=z", true},
+		{"repeated rule key, one missing", "tag=x&tag=y", "tag=x", false},
+		{"single rule value, repeated request key", "tag=y", "tag=x&tag=y", true},
+		{"single rule value, none of the repeated request values", "tag=z", "tag=x&tag=y", false},
+
+		{"contains", `[{"key": "q", "op": "contains", "value": "ell"}]`, "q=hello", true},
+		{"contains any repeated value", `[{"key": "q", "op": "contains", "value": "ell"}]`, "q=abc&q=hello", true},
+		{"regex", `[{"key": "id", "op": "regex", "value": "^\\d+$"}]`, "id=42", true},
+		{"regex no match", `[{"key": "id", "op": "regex", "value": "^\\d+$"}]`, "id=4x", false},
+		{"regex every value needed", `[{"key": "id", "op": "regex", "values": ["^1", "^2"]}]`, "id=10&id=20", true},
+		{"regex one value unmatched", `[{"key": "id", "op": "regex", "values": ["^1", "^3"]}]`, "id=10&id=20", false},
+		{"present", `[{"key": "debug", "op": "present"}]`, "debug=", true},
+		{"present missing", `[{"key": "debug", "op": "present"}]`, "a=1", false},
+		{"absent", `[{"key": "debug", "op": "absent"}]`, "a=1", true},
+		{"absent but present", `[{"key": "debug", "op": "absent"}]`, "debug=1&debug=2", false},
+		{"equals empty value", `[{"key": "a", "value": ""}]`, "a=", true},
+		{"invalid rule", "abc", "abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &matchRequest{query: tt.query}
+			got, reason := m.matchQuery(tt.rule)
+			if got != tt.want {
+				t.Errorf("matchQuery(%q) against %q = %v (%s), want %v", tt.rule, tt.query, got, reason, tt.want)
+			}
+			if !got && reason == "" {
+				t.Error("matchQuery gave no reason for a mismatch")
+			}
+		})
+	}
+}
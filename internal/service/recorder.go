@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRecording is returned when starting a recording session while one is running
+	ErrRecording = errors.New("a recording session is already running")
+	// ErrNotRecording is returned when stopping a recording session while none is running
+	ErrNotRecording = errors.New("no recording session is running")
+)
+
+// recordedHeaderSkip lists response headers that describe the recorded connection rather
+// than the response, so they are not saved into stubs
+var recordedHeaderSkip = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+}
+
+// recordingSession is a running recording session. Exchanges for the same method and
+// path are saved one at a time so that concurrent requests to a new path create a single
+// stub, while exchanges for different paths are saved concurrently.
+type recordingSession struct {
+	req *model.RecordingRequest
+
+	// mu guards the fields below, and is not held while saving
+	mu sync.Mutex
+	// interfaces holds the ID of the stub saved for each method and path
+	interfaces map[string]int64
+	// seen holds the keys of the exchanges recorded so far
+	seen     map[string]bool
+	recorded int
+	// saving holds a lock per method and path, held while an exchange for it is saved
+	saving map[string]*sync.Mutex
+}
+
+// recorder saves exchanges forwarded to a real service as stubs
+type recorder struct {
+	// mu serializes starting and stopping sessions; the mock path reads session without it
+	mu      sync.Mutex
+	session atomic.Pointer[recordingSession]
+}
+
+func newRecorder() *recorder {
+	return &recorder{}
+}
+
+func (s *MockService) StartRecording(ctx context.Context, req *pb.StartRecordingRequest) (*pb.RecordingResponse, error) {
+	logger.Info("Starting recording",
+		zap.String("target", req.Target),
+		zap.String("prefix", req.Prefix),
+		zap.String("owner", req.Owner),
+		zap.Bool("match_query", req.MatchQuery),
+		zap.Bool("match_body", req.MatchBody),
+		zap.Strings("match_headers", req.MatchHeaders))
+
+	if err := ValidateProxyURL(req.Target); err != nil {
+		return nil, err
+	}
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+
+	if s.recorder.session.Load() != nil {
+		return nil, ErrRecording
+	}
+	session := &recordingSession{
+		req: &model.RecordingRequest{
+			Target:       req.Target,
+			Prefix:       req.Prefix,
+			Owner:        req.Owner,
+			MatchQuery:   req.MatchQuery,
+			MatchBody:    req.MatchBody,
+			MatchHeaders: req.MatchHeaders,
+		},
+		interfaces: make(map[string]int64),
+		seen:       make(map[string]bool),
+		saving:     make(map[string]*sync.Mutex),
+	}
+	s.recorder.session.Store(session)
+
+	resp := session.toPb()
+	resp.Message = "Recording started"
+	return resp, nil
+}
+
+func (s *MockService) StopRecording(ctx context.Context, req *pb.StopRecordingRequest) (*pb.RecordingResponse, error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+
+	session := s.recorder.session.Swap(nil)
+	if session == nil {
+		return nil, ErrNotRecording
+	}
+	resp := session.toPb()
+	resp.Active = false
+	resp.Message = "Recording stopped"
+
+	logger.Info("Stopped recording",
+		zap.String("target", resp.Target),
+		zap.Int32("recorded", resp.Recorded))
+	return resp, nil
+}
+
+func (s *MockService) GetRecording(ctx context.Context, req *pb.GetRecordingRequest) (*pb.RecordingResponse, error) {
+	session := s.recorder.session.Load()
+	if session == nil {
+		return &pb.RecordingResponse{Success: true, Message: "Not recording"}, nil
+	}
+	resp := session.toPb()
+	resp.Message = "Recording"
+	return resp, nil
+}
+
+// RecordingTarget returns the service a request path is forwarded to while recording
+func (s *MockService) RecordingTarget(path string) (string, bool) {
+	session := s.recorder.session.Load()
+	if session == nil || !strings.HasPrefix(path, session.req.Prefix) {
+		return "", false
+	}
+	return session.req.Target, true
+}
+
+// RecordExchange saves a forwarded exchange as a stub. The first exchange for a method
+// and path becomes the stub's default response, replacing any stub already saved for
+// them together with its rules. When the session matches on request parts, each distinct
+// combination of them is also saved as a rule.
+func (s *MockService) RecordExchange(ctx context.Context, ex *model.RecordedExchange) error {
+	session := s.recorder.session.Load()
+	if session == nil {
+		return ErrNotRecording
+	}
+
+	conditions := session.conditions(ex)
+	key := ex.Method + " " + ex.URL
+	exchangeKey := key
+	for _, cond := range conditions {
+		exchangeKey += fmt.Sprintf("\n%d:%s", cond.MatchType, cond.MatchRule)
+	}
+
+	saving := session.savingLock(key)
+	saving.Lock()
+	defer saving.Unlock()
+
+	session.mu.Lock()
+	seen := session.seen[exchangeKey]
+	interfaceID, ok := session.interfaces[key]
+	session.mu.Unlock()
+	if seen {
+		logger.Debug("Exchange already recorded",
+			zap.String("method", ex.Method),
+			zap.String("url", ex.URL))
+		return nil
+	}
+
+	responseHeader := make(map[string]string, len(ex.ResponseHeader))
+	for k, v := range ex.ResponseHeader {
+		if !recordedHeaderSkip[http.CanonicalHeaderKey(k)] {
+			responseHeader[k] = v
+		}
+	}
+
+	defer func() {
+		if interfaceID != 0 {
+			s.invalidateRoutes(interfaceID)
+		}
+	}()
+	if !ok {
+		var err error
+		interfaceID, err = s.storage.SaveMockUrl(ctx, &model.Interface{
+			URL:            ex.URL,
+			Method:         ex.Method,
+			URLType:        model.URLTypeExact,
+			ResponseCode:   ex.ResponseCode,
+			ResponseHeader: responseHeader,
+			ResponseBody:   ex.ResponseBody,
+			Owner:          session.req.Owner,
+			Description:    "Recorded from " + session.req.Target,
+		})
+		if err != nil {
+			logger.Error("Failed to save recorded mock URL",
+				zap.String("method", ex.Method),
+				zap.String("url", ex.URL),
+				zap.Error(err))
+			return err
+		}
+		// Drop the rules of a stub saved before the session, so they cannot shadow the
+		// recorded responses
+		if err := s.storage.ReplaceRules(ctx, interfaceID, nil); err != nil {
+			logger.Error("Failed to delete rules of recorded mock URL",
+				zap.Int64("interface_id", interfaceID),
+				zap.Error(err))
+			return err
+		}
+		s.responses.forgetStub(interfaceID)
+		session.mu.Lock()
+		session.interfaces[key] = interfaceID
+		session.mu.Unlock()
+		s.recordRevision(ctx, interfaceID, s.saveAction(ctx, interfaceID), "recorded from "+session.req.Target)
+	}
+
+	if len(conditions) > 0 {
+		rule := &model.Rule{
+			Logic:          model.LogicAnd,
+			Conditions:     conditions,
+			ResponseCode:   ex.ResponseCode,
+			ResponseHeader: responseHeader,
+			ResponseBody:   ex.ResponseBody,
+			ResponseMode:   model.ResponseModeSingle,
+			Description:    "Recorded from " + session.req.Target,
+		}
+		if err := s.storage.SaveRule(ctx, interfaceID, rule); err != nil {
+			logger.Error("Failed to save recorded rule",
+				zap.Int64("interface_id", interfaceID),
+				zap.Error(err))
+			return err
+		}
+		s.recordRevision(ctx, interfaceID, model.RevisionRuleCreate, fmt.Sprintf("rule %d recorded from %s", rule.ID, session.req.Target))
+	}
+
+	session.mu.Lock()
+	session.seen[exchangeKey] = true
+	session.recorded++
+	session.mu.Unlock()
+
+	logger.Info("Recorded exchange",
+		zap.String("method", ex.Method),
+		zap.String("url", ex.URL),
+		zap.Int64("interface_id", interfaceID),
+		zap.Int("conditions", len(conditions)))
+	return nil
+}
+
+// conditions returns the rule conditions for the request parts the session matches on.
+// Parts that are empty in the request, or that no condition can match such as a body
+// that is not a JSON object, are left out.
+func (session *recordingSession) conditions(ex *model.RecordedExchange) []model.Condition {
+	var conditions []model.Condition
+	if session.req.MatchQuery && ex.QueryParams != "" {
+		conditions = appendValidCondition(conditions, model.MatchTypeQuery, ex.QueryParams)
+	}
+	if session.req.MatchBody && ex.RequestBody != "" {
+		conditions = appendValidCondition(conditions, model.MatchTypeBody, ex.RequestBody)
+	}
+
+	headers := make(map[string]string)
+	for _, name := range session.req.MatchHeaders {
+		name = http.CanonicalHeaderKey(name)
+		for k, v := range ex.RequestHeader {
+			if http.CanonicalHeaderKey(k) == name {
+				headers[name] = v
+			}
+		}
+	}
+	if len(headers) > 0 {
+		// Marshal sorts the keys, so equal headers give equal rules
+		rule, _ := json.Marshal(headers)
+		conditions = append(conditions, model.Condition{MatchType: model.MatchTypeHeader, MatchRule: string(rule)})
+	}
+	return conditions
+}
+
+// appendValidCondition appends a recorded condition when its rule is valid for its match
+// type, as for rules saved through the API
+func appendValidCondition(conditions []model.Condition, matchType int32, matchRule string) []model.Condition {
+	if err := ValidateCondition(matchType, matchRule); err != nil {
+		logger.Debug("Recorded request part cannot be matched, leaving it out",
+			zap.Int32("match_type", matchType),
+			zap.Error(err))
+		return conditions
+	}
+	return append(conditions, model.Condition{MatchType: matchType, MatchRule: matchRule})
+}
+
+// savingLock returns the lock held while an exchange for a method and path is saved
+func (session *recordingSession) savingLock(key string) *sync.Mutex {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	lock, ok := session.saving[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		session.saving[key] = lock
+	}
+	return lock
+}
+
+func (session *recordingSession) toPb() *pb.RecordingResponse {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	return &pb.RecordingResponse{
+		Success:      true,
+		Active:       true,
+		Target:       session.req.Target,
+		Prefix:       session.req.Prefix,
+		Owner:        session.req.Owner,
+		MatchQuery:   session.req.MatchQuery,
+		MatchBody:    session.req.MatchBody,
+		MatchHeaders: session.req.MatchHeaders,
+		Recorded:     int32(session.recorded),
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+)
+
+// NormalizeResponseMode lower-cases a rule response mode, treating an empty one as single
+func NormalizeResponseMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return model.ResponseModeSingle
+	}
+	return mode
+}
+
+// ValidateRuleResponses checks the response sequence or weighted set of a rule
+func ValidateRuleResponses(rule *model.Rule) error {
+	mode := NormalizeResponseMode(rule.ResponseMode)
+	switch mode {
+	case model.ResponseModeSingle:
+		return nil
+	case model.ResponseModeCycle, model.ResponseModeLast, model.ResponseModeWeighted:
+	default:
+		return fmt.Errorf("response_mode must be one of %s, %s, %s or %s",
+			model.ResponseModeSingle, model.ResponseModeCycle, model.ResponseModeLast, model.ResponseModeWeighted)
+	}
+
+	if len(rule.Responses) == 0 {
+		return fmt.Errorf("response_mode %s needs at least one entry in responses", mode)
+	}
+	for i, resp := range rule.Responses {
+		code, err := strconv.Atoi(resp.ResponseCode)
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("response %d: response_code must be a valid HTTP status code", i+1)
+		}
+		if _, ok := resp.ResponseHeader["Content-Type"]; !ok {
+			return fmt.Errorf("response %d: response_header must include Content-Type", i+1)
+		}
+		if mode == model.ResponseModeWeighted && resp.Weight <= 0 {
+			return fmt.Errorf("response %d: weight must be positive", i+1)
+		}
+		if rule.Template {
+			if err := ValidateResponseTemplate(resp.ResponseBody, resp.ResponseHeader); err != nil {
+				return fmt.Errorf("response %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// responseSelector picks the response of rules that return a sequence or weighted set
+// of responses. Sequence positions are kept per rule ID until the rule changes, its stub
+// is replaced or deleted, or its scenario is reset.
+type responseSelector struct {
+	mu        sync.Mutex
+	positions map[int64]*rulePosition
+}
+
+// rulePosition is how far a rule is into its response sequence
+type rulePosition struct {
+	interfaceID int64
+	scenario    string
+	next        int
+}
+
+func newResponseSelector() *responseSelector {
+	return &responseSelector{positions: make(map[int64]*rulePosition)}
+}
+
+// pick returns the response a matched rule of an interface should send
+func (s *responseSelector) pick(interfaceID int64, rule *model.Rule) model.RuleResponse {
+	if len(rule.Responses) == 0 {
+		return model.RuleResponse{
+			ResponseCode:   rule.ResponseCode,
+			ResponseHeader: rule.ResponseHeader,
+			ResponseBody:   rule.ResponseBody,
+		}
+	}
+
+	switch rule.ResponseMode {
+	case model.ResponseModeCycle:
+		return rule.Responses[s.next(interfaceID, rule)%len(rule.Responses)]
+	case model.ResponseModeLast:
+		i := s.next(interfaceID, rule)
+		if i >= len(rule.Responses) {
+			i = len(rule.Responses) - 1
+		}
+		return rule.Responses[i]
+	case model.ResponseModeWeighted:
+		return pickWeighted(rule.Responses)
+	default:
+		return model.RuleResponse{
+			ResponseCode:   rule.ResponseCode,
+			ResponseHeader: rule.ResponseHeader,
+			ResponseBody:   rule.ResponseBody,
+		}
+	}
+}
+
+// next returns the number of times a rule was picked before, and counts this one
+func (s *responseSelector) next(interfaceID int64, rule *model.Rule) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, ok := s.positions[rule.ID]
+	if !ok {
+		pos = &rulePosition{interfaceID: interfaceID}
+		s.positions[rule.ID] = pos
+	}
+	pos.scenario = rule.Scenario
+	i := pos.next
+	pos.next++
+	return i
+}
+
+// forgetRule rewinds the response sequence of a rule that was changed or deleted
+func (s *responseSelector) forgetRule(ruleID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.positions, ruleID)
+}
+
+// forgetStub rewinds the response sequences of every rule of an interface whose rules
+// were replaced or which was deleted
+func (s *responseSelector) forgetStub(interfaceID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ruleID, pos := range s.positions {
+		if pos.interfaceID == interfaceID {
+			delete(s.positions, ruleID)
+		}
+	}
+}
+
+// reset rewinds the response sequences of the rules in the named scenario, or of every
+// rule when no name is given
+func (s *responseSelector) reset(scenario string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ruleID, pos := range s.positions {
+		if scenario == "" || pos.scenario == scenario {
+			delete(s.positions, ruleID)
+		}
+	}
+}
+
+func pickWeighted(responses []model.RuleResponse) model.RuleResponse {
+	total := 0
+	for _, resp := range responses {
+		if resp.Weight > 0 {
+			total += int(resp.Weight)
+		}
+	}
+	if total == 0 {
+		return responses[rand.Intn(len(responses))]
+	}
+
+	n := rand.Intn(total)
+	for _, resp := range responses {
+		if resp.Weight <= 0 {
+			continue
+		}
+		if n < int(resp.Weight) {
+			return resp
+		}
+		n -= int(resp.Weight)
+	}
+	return responses[len(responses)-1]
+}
+
+// ValidateFault checks a rule's fault and, for the drip fault, its bandwidth
+func ValidateFault(fault string, bandwidth int32) error {
+	switch fault {
+	case "", model.FaultConnectionReset, model.FaultEmptyResponse, model.FaultMalformedBody,
+		model.FaultTruncatedBody, model.FaultHang:
+		return nil
+	case model.FaultDrip:
+		if bandwidth <= 0 {
+			return fmt.Errorf("fault %s needs a positive fault_bandwidth in bytes per second", fault)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown fault %q, must be one of %s, %s, %s, %s, %s or %s", fault,
+			model.FaultConnectionReset, model.FaultEmptyResponse, model.FaultMalformedBody,
+			model.FaultTruncatedBody, model.FaultHang, model.FaultDrip)
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+)
+
+func TestResponseSelectorRewind(t *testing.T) {
+	sequence := func(id, interfaceID int64, scenario string) *model.Rule {
+		return &model.Rule{
+			ID:           id,
+			InterfaceID:  interfaceID,
+			Scenario:     scenario,
+			ResponseMode: model.ResponseModeCycle,
+			Responses:    []model.RuleResponse{{ResponseBody: "first"}, {ResponseBody: "second"}},
+		}
+	}
+	login, checkout, other := sequence(1, 10, "login"), sequence(2, 10, "checkout"), sequence(3, 20, "")
+
+	tests := []struct {
+		name   string
+		rewind func(s *responseSelector)
+		want   map[*model.Rule]string // next body of each rule after the rewind
+	}{
+		{"nothing", func(s *responseSelector) {}, map[*model.Rule]string{login: "second", checkout: "second", other: "second"}},
+		{"changed rule", func(s *responseSelector) { s.forgetRule(1) }, map[*model.Rule]string{login: "first", checkout: "second", other: "second"}},
+		{"replaced stub", func(s *responseSelector) { s.forgetStub(10) }, map[*model.Rule]string{login: "first", checkout: "first", other: "second"}},
+		{"scenario reset", func(s *responseSelector) { s.reset("checkout") }, map[*model.Rule]string{login: "second", checkout: "first", other: "second"}},
+		{"every scenario reset", func(s *responseSelector) { s.reset("") }, map[*model.Rule]string{login: "first", checkout: "first", other: "first"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newResponseSelector()
+			for _, rule := range []*model.Rule{login, checkout, other} {
+				s.pick(rule.InterfaceID, rule)
+			}
+
+			tt.rewind(s)
+			for rule, want := range tt.want {
+				if got := s.pick(rule.InterfaceID, rule).ResponseBody; got != want {
+					t.Errorf("rule %d answered %q, want %q", rule.ID, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrRevisionNotFound is returned when a stub has no revision with the given version
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrInvalidRollback is returned when a stub cannot be rolled back to a revision
+	ErrInvalidRollback = errors.New("invalid rollback")
+)
+
+// recordRevision stores the current state of a stub as a new revision. A failure is
+// logged but not returned, since the change it records has already been saved.
+func (s *MockService) recordRevision(ctx context.Context, interfaceID int64, action, comment string) *model.Revision {
+	snapshot, err := s.getMockUrlPb(ctx, interfaceID)
+	if err != nil {
+		logger.Error("Failed to load stub for revision",
+			zap.Int64("interface_id", interfaceID),
+			zap.String("action", action),
+			zap.Error(err))
+		return nil
+	}
+	return s.saveRevision(ctx, snapshot, action, comment)
+}
+
+// saveRevision stores snapshot as a new revision of its stub, with the stub's owner as
+// author. Like recordRevision, it only logs a failure.
+func (s *MockService) saveRevision(ctx context.Context, snapshot *pb.MockUrl, action, comment string) *model.Revision {
+	// The version changes with every revision, so it is left out of the snapshot
+	snapshot = proto.Clone(snapshot).(*pb.MockUrl)
+	snapshot.Version = 0
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		logger.Error("Failed to marshal revision snapshot",
+			zap.Int64("interface_id", snapshot.Id),
+			zap.Error(err))
+		return nil
+	}
+
+	rev := &model.Revision{
+		InterfaceID: snapshot.Id,
+		Action:      action,
+		Author:      snapshot.Owner,
+		Comment:     comment,
+		Snapshot:    string(snapshotJSON),
+	}
+	if err := s.storage.SaveRevision(ctx, rev); err != nil {
+		logger.Error("Failed to save revision",
+			zap.Int64("interface_id", snapshot.Id),
+			zap.String("action", action),
+			zap.Error(err))
+		return nil
+	}
+
+	logger.Debug("Saved revision",
+		zap.Int64("interface_id", rev.InterfaceID),
+		zap.Int32("version", rev.Version),
+		zap.String("action", action))
+	return rev
+}
+
+// recordRuleRevision records a change to a rule as a revision of the rule's stub
+func (s *MockService) recordRuleRevision(ctx context.Context, ruleID int64, action string) {
+	rule, err := s.storage.GetRuleByID(ctx, ruleID)
+	if err != nil {
+		logger.Error("Failed to load rule for revision",
+			zap.Int64("rule_id", ruleID),
+			zap.Error(err))
+		return
+	}
+	s.recordRevision(ctx, rule.InterfaceID, action, fmt.Sprintf("rule %d", ruleID))
+}
+
+// GetRevisions lists the revisions of a stub, newest first, without their snapshots
+func (s *MockService) GetRevisions(ctx context.Context, req *pb.GetRevisionsRequest) (*pb.GetRevisionsResponse, error) {
+	logger.Info("Getting revisions",
+		zap.Int64("interface_id", req.InterfaceId))
+
+	revisions, err := s.storage.GetRevisions(ctx, req.InterfaceId)
+	if err != nil {
+		logger.Error("Failed to get revisions",
+			zap.Int64("interface_id", req.InterfaceId),
+			zap.Error(err))
+		return nil, err
+	}
+
+	pbRevisions := make([]*pb.Revision, 0, len(revisions))
+	for _, rev := range revisions {
+		pbRevisions = append(pbRevisions, revisionToPb(rev, nil))
+	}
+
+	return &pb.GetRevisionsResponse{
+		Success:   true,
+		Message:   "Revisions retrieved successfully",
+		Revisions: pbRevisions,
+	}, nil
+}
+
+// GetRevision returns one revision of a stub with its snapshot, the latest when no
+// version is given
+func (s *MockService) GetRevision(ctx context.Context, req *pb.GetRevisionRequest) (*pb.GetRevisionResponse, error) {
+	logger.Info("Getting revision",
+		zap.Int64("interface_id", req.InterfaceId),
+		zap.Int32("version", req.Version))
+
+	rev, snapshot, err := s.loadRevision(ctx, req.InterfaceId, req.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetRevisionResponse{
+		Success:  true,
+		Message:  "Revision retrieved successfully",
+		Revision: revisionToPb(rev, snapshot),
+	}, nil
+}
+
+// DiffRevisions lists the fields that changed between two revisions of a stub. To
+// defaults to the latest revision and From to the one before To.
+func (s *MockService) DiffRevisions(ctx context.Context, req *pb.DiffRevisionsRequest) (*pb.DiffRevisionsResponse, error) {
+	logger.Info("Diffing revisions",
+		zap.Int64("interface_id", req.InterfaceId),
+		zap.Int32("from", req.From),
+		zap.Int32("to", req.To))
+
+	to, toSnapshot, err := s.loadRevision(ctx, req.InterfaceId, req.To)
+	if err != nil {
+		return nil, err
+	}
+	fromVersion := req.From
+	if fromVersion == 0 {
+		fromVersion = to.Version - 1
+	}
+	if fromVersion < 1 {
+		return nil, fmt.Errorf("%w: version %d is the first revision of stub %d", ErrRevisionNotFound, to.Version, req.InterfaceId)
+	}
+	from, fromSnapshot, err := s.loadRevision(ctx, req.InterfaceId, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diffSnapshots(fromSnapshot, toSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	pbChanges := make([]*pb.FieldChange, 0, len(changes))
+	for _, change := range changes {
+		pbChanges = append(pbChanges, &pb.FieldChange{
+			Path: change.Path,
+			Old:  change.Old,
+			New:  change.New,
+		})
+	}
+
+	return &pb.DiffRevisionsResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d fields changed", len(changes)),
+		From:    from.Version,
+		To:      to.Version,
+		Changes: pbChanges,
+	}, nil
+}
+
+// RollbackStub puts a stub and its rules back the way they were at a revision, restoring
+// the stub first if it has been deleted. Rules deleted since are created again with new
+// IDs. The rollback is itself recorded as a new revision.
+func (s *MockService) RollbackStub(ctx context.Context, req *pb.RollbackStubRequest) (*pb.RollbackStubResponse, error) {
+	defer s.invalidateRoutes(req.InterfaceId)
+
+	logger.Info("Rolling back stub",
+		zap.Int64("interface_id", req.InterfaceId),
+		zap.Int32("version", req.Version))
+
+	if req.Version < 1 {
+		return nil, fmt.Errorf("%w: version is required", ErrInvalidRollback)
+	}
+	rev, snapshot, err := s.loadRevision(ctx, req.InterfaceId, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Status == string(model.StatusDeleted) {
+		return nil, fmt.Errorf("%w: version %d deleted the stub, delete it instead", ErrInvalidRollback, rev.Version)
+	}
+
+	if err := s.storage.RestoreMockUrl(ctx, req.InterfaceId); err != nil && err != sql.ErrNoRows {
+		logger.Error("Failed to restore stub for rollback",
+			zap.Int64("interface_id", req.InterfaceId),
+			zap.Error(err))
+		return nil, err
+	}
+
+	current, err := s.storage.GetRulesByInterfaceID(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[int64]bool, len(current))
+	for _, rule := range current {
+		owned[rule.ID] = true
+	}
+	for _, pbRule := range snapshot.Rules {
+		if !owned[pbRule.Id] {
+			pbRule.Id = 0
+		}
+	}
+
+	rules, err := s.updateMockUrl(ctx, &pb.UpdateMockUrlRequest{
+		Id: req.InterfaceId,
+		Stub: &pb.SetMockUrlRequest{
+			Url:            snapshot.Url,
+			Method:         snapshot.Method,
+			UrlType:        snapshot.UrlType,
+			ResponseCode:   snapshot.ResponseCode,
+			ResponseHeader: snapshot.ResponseHeader,
+			ResponseBody:   snapshot.ResponseBody,
+			Template:       snapshot.Template,
+			DelaySpec:      snapshot.DelaySpec,
+			ProxyUrl:       snapshot.ProxyUrl,
+			Owner:          snapshot.Owner,
+			Description:    snapshot.Description,
+			Meta:           snapshot.Meta,
+			Rules:          snapshot.Rules,
+		},
+		ReplaceRules: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Statuses are not part of an update, so put them back one by one
+	for i, rule := range rules {
+		if err := s.storage.SetRuleStatus(ctx, rule.ID, snapshotStatus(snapshot.Rules[i].Status)); err != nil {
+			logger.Error("Failed to roll back rule status",
+				zap.Int64("rule_id", rule.ID),
+				zap.Error(err))
+			return nil, err
+		}
+	}
+	if err := s.storage.SetMockUrlStatus(ctx, req.InterfaceId, snapshotStatus(snapshot.Status)); err != nil {
+		logger.Error("Failed to roll back stub status",
+			zap.Int64("interface_id", req.InterfaceId),
+			zap.Error(err))
+		return nil, err
+	}
+
+	pbUrl, err := s.getMockUrlPb(ctx, req.InterfaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.RollbackStubResponse{
+		Success: true,
+		Message: fmt.Sprintf("Stub rolled back to version %d", rev.Version),
+		Url:     pbUrl,
+	}
+	if saved := s.saveRevision(ctx, pbUrl, model.RevisionRollback, fmt.Sprintf("rolled back to version %d", rev.Version)); saved != nil {
+		resp.Version = saved.Version
+	}
+	return resp, nil
+}
+
+// snapshotStatus is the status a stub or rule had in a snapshot, where an empty status
+// means active
+func snapshotStatus(status string) model.Status {
+	if status == string(model.StatusInactive) {
+		return model.StatusInactive
+	}
+	return model.StatusActive
+}
+
+// loadRevision returns a revision of a stub with its decoded snapshot
+func (s *MockService) loadRevision(ctx context.Context, interfaceID int64, version int32) (*model.Revision, *pb.MockUrl, error) {
+	rev, err := s.storage.GetRevision(ctx, interfaceID, version)
+	if err == sql.ErrNoRows {
+		if version == 0 {
+			return nil, nil, fmt.Errorf("%w: stub %d has no revisions", ErrRevisionNotFound, interfaceID)
+		}
+		return nil, nil, fmt.Errorf("%w: stub %d has no version %d", ErrRevisionNotFound, interfaceID, version)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snapshot pb.MockUrl
+	if err := json.Unmarshal([]byte(rev.Snapshot), &snapshot); err != nil {
+		logger.Error("Failed to unmarshal revision snapshot",
+			zap.Int64("interface_id", interfaceID),
+			zap.Int32("version", rev.Version),
+			zap.Error(err))
+		return nil, nil, err
+	}
+	return rev, &snapshot, nil
+}
+
+func revisionToPb(rev *model.Revision, snapshot *pb.MockUrl) *pb.Revision {
+	return &pb.Revision{
+		Id:          rev.ID,
+		InterfaceId: rev.InterfaceID,
+		Version:     rev.Version,
+		Action:      rev.Action,
+		Author:      rev.Author,
+		Comment:     rev.Comment,
+		CreateTime:  rev.CreatedAt.Format(time.RFC3339),
+		Stub:        snapshot,
+	}
+}
+
+// diffSnapshots compares two snapshots of a stub field by field. Rules are paired by ID,
+// so reordering them shows up as priority changes only.
+func diffSnapshots(from, to *pb.MockUrl) ([]model.FieldChange, error) {
+	a, err := toJSONValue(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toJSONValue(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []model.FieldChange
+	diffValues("", a, b, &changes)
+	return changes, nil
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func diffValues(path string, a, b interface{}, changes *[]model.FieldChange) {
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := make(map[string]bool, len(aMap)+len(bMap))
+		for k := range aMap {
+			keys[k] = true
+		}
+		for k := range bMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(joinPath(path, k), aMap[k], bMap[k], changes)
+		}
+		return
+	}
+
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	if (aIsList || a == nil) && (bIsList || b == nil) {
+		aByID, aOK := elementsByID(aList)
+		bByID, bOK := elementsByID(bList)
+		if aOK && bOK {
+			for _, id := range unionIDs(aList, bList) {
+				diffValues(fmt.Sprintf("%s[id=%s]", path, id), aByID[id], bByID[id], changes)
+			}
+			return
+		}
+		if aIsList && bIsList {
+			for i := 0; i < len(aList) || i < len(bList); i++ {
+				var x, y interface{}
+				if i < len(aList) {
+					x = aList[i]
+				}
+				if i < len(bList) {
+					y = bList[i]
+				}
+				diffValues(fmt.Sprintf("%s[%d]", path, i), x, y, changes)
+			}
+			return
+		}
+	}
+
+	*changes = append(*changes, model.FieldChange{
+		Path: path,
+		Old:  jsonText(a),
+		New:  jsonText(b),
+	})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// elementsByID indexes a list of objects by their id field. It reports false when an
+// element is not an object with an id.
+func elementsByID(list []interface{}) (map[string]interface{}, bool) {
+	byID := make(map[string]interface{}, len(list))
+	for _, elem := range list {
+		id, ok := elementID(elem)
+		if !ok {
+			return nil, false
+		}
+		byID[id] = elem
+	}
+	return byID, true
+}
+
+func elementID(elem interface{}) (string, bool) {
+	obj, ok := elem.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	id, ok := obj["id"]
+	if !ok {
+		return "", false
+	}
+	return jsonText(id), true
+}
+
+// unionIDs lists the IDs of a's elements in order, then those only in b
+func unionIDs(a, b []interface{}) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var ids []string
+	for _, elem := range append(append([]interface{}{}, a...), b...) {
+		id, _ := elementID(elem)
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// jsonText encodes a decoded JSON value, or returns an empty string for a missing one
+func jsonText(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,454 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/urlmatch"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+	"go.uber.org/zap"
+)
+
+// routeCache keeps a compiled routing table of the active stubs so that the mock path
+// does not query storage on every request. The table is built from
+// storage.Storage.GetMockUrlRoutes, the route set unmatched requests are compared
+// against. Writes through the service invalidate the stub they change, and the next
+// lookup reloads just those stubs into a new table. A stub's responses and rules are
+// loaded the first time it is hit.
+type routeCache struct {
+	storage storage.Storage
+
+	mu      sync.RWMutex
+	table   *routeTable
+	stale   map[int64]bool // interfaces changed since table was built
+	version uint64
+
+	// rebuild lets one lookup at a time rebuild an invalidated table
+	rebuild sync.Mutex
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	invalidations atomic.Int64
+	refreshes     atomic.Int64
+}
+
+// routeTable is the routing table built from the active interfaces at one point in time
+type routeTable struct {
+	routes   []*route
+	exact    map[string]*route
+	patterns []*route
+	builtAt  time.Time
+}
+
+// route is an active interface in the routing table with its responses and rules once
+// loaded
+type route struct {
+	iface   *model.Interface
+	pattern *urlmatch.Pattern
+
+	mu     sync.Mutex
+	stub   *model.Interface
+	rules  []model.Rule
+	loaded bool
+}
+
+func newRouteCache(storage storage.Storage) *routeCache {
+	return &routeCache{storage: storage}
+}
+
+// invalidate marks an interface as changed so the next lookup reloads it from storage
+func (c *routeCache) invalidate(interfaceID int64) {
+	c.mu.Lock()
+	if c.table != nil {
+		if c.stale == nil {
+			c.stale = make(map[int64]bool)
+		}
+		c.stale[interfaceID] = true
+	}
+	c.version++
+	c.mu.Unlock()
+	c.invalidations.Add(1)
+}
+
+// invalidateAll drops the routing table so the next lookup rebuilds it from storage
+func (c *routeCache) invalidateAll() {
+	c.mu.Lock()
+	c.table, c.stale = nil, nil
+	c.version++
+	c.mu.Unlock()
+	c.invalidations.Add(1)
+}
+
+// lookup returns the interface that serves a request and its active rules, or
+// sql.ErrNoRows when no active interface matches, with the precedence of
+// storage.Storage.GetMockResponse
+func (c *routeCache) lookup(ctx context.Context, method, url string) (*model.MockResponse, []model.Rule, error) {
+	hit := true
+	table, err := c.current(ctx, &hit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, params := table.match(method, url)
+	if r == nil {
+		c.count(hit)
+		return nil, nil, sql.ErrNoRows
+	}
+
+	iface, rules, err := c.load(ctx, r, &hit)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.count(hit)
+
+	return &model.MockResponse{
+		InterfaceID:    iface.ID,
+		ResponseCode:   iface.ResponseCode,
+		ResponseHeader: iface.ResponseHeader,
+		ResponseBody:   iface.ResponseBody,
+		Template:       iface.Template,
+		DelaySpec:      iface.DelaySpec,
+		ProxyURL:       iface.ProxyURL,
+		PathParams:     params,
+	}, rules, nil
+}
+
+func (c *routeCache) count(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// current returns the routing table, rebuilding it when it was dropped and reloading the
+// interfaces changed since it was built. hit is cleared when storage had to be read.
+func (c *routeCache) current(ctx context.Context, hit *bool) (*routeTable, error) {
+	c.mu.RLock()
+	table, stale := c.table, len(c.stale)
+	c.mu.RUnlock()
+	if table != nil && stale == 0 {
+		return table, nil
+	}
+
+	c.rebuild.Lock()
+	defer c.rebuild.Unlock()
+
+	c.mu.RLock()
+	table, version := c.table, c.version
+	changed := make([]int64, 0, len(c.stale))
+	for id := range c.stale {
+		changed = append(changed, id)
+	}
+	c.mu.RUnlock()
+	if table != nil && len(changed) == 0 {
+		return table, nil
+	}
+
+	*hit = false
+	var err error
+	if table == nil {
+		table, err = c.build(ctx, false)
+	} else {
+		table, err = c.reload(ctx, table, changed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.install(table, version)
+	return table, nil
+}
+
+// load returns the interface of a route with its responses and its active rules, loading
+// them on first use. It returns sql.ErrNoRows when the interface has been deleted since
+// the table was built. hit is cleared when storage had to be read.
+func (c *routeCache) load(ctx context.Context, r *route, hit *bool) (*model.Interface, []model.Rule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.loaded {
+		return r.stub, r.rules, nil
+	}
+
+	*hit = false
+	interfaces, err := c.storage.GetMockUrl(ctx, r.iface.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(interfaces) == 0 {
+		return nil, nil, sql.ErrNoRows
+	}
+	rules, err := c.storage.GetRules(ctx, r.iface.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.stub, r.rules, r.loaded = interfaces[0], rules, true
+	return r.stub, r.rules, nil
+}
+
+// refresh rebuilds the routing table with the responses and rules of every route, to
+// pick up changes made by other instances sharing the storage. It reads them all with
+// storage.Storage.GetActiveMockUrls rather than stub by stub.
+func (c *routeCache) refresh(ctx context.Context) error {
+	c.mu.RLock()
+	version := c.version
+	c.mu.RUnlock()
+
+	table, err := c.build(ctx, true)
+	if err != nil {
+		return err
+	}
+	c.install(table, version)
+	return nil
+}
+
+// install makes table the current routing table unless the cache was invalidated since
+// version, in which case the table may miss the change and is dropped
+func (c *routeCache) install(table *routeTable, version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.version == version {
+		c.table, c.stale = table, nil
+	}
+}
+
+// build reads the active interfaces from storage and compiles them into a routing table,
+// loading the responses and rules of every route when withRules is set
+func (c *routeCache) build(ctx context.Context, withRules bool) (*routeTable, error) {
+	start := time.Now()
+
+	var routes []*route
+	if withRules {
+		interfaces, rules, err := c.storage.GetActiveMockUrls(ctx)
+		if err != nil {
+			logger.Error("Failed to load routes with their rules",
+				zap.Error(err))
+			return nil, err
+		}
+		for _, iface := range interfaces {
+			routes = append(routes, &route{iface: iface, stub: iface, rules: rules[iface.ID], loaded: true})
+		}
+	} else {
+		interfaces, err := c.storage.GetMockUrlRoutes(ctx)
+		if err != nil {
+			logger.Error("Failed to load routes",
+				zap.Error(err))
+			return nil, err
+		}
+		for _, iface := range interfaces {
+			if iface.Status == model.StatusActive {
+				routes = append(routes, &route{iface: iface})
+			}
+		}
+	}
+
+	table := newRouteTable(routes)
+	c.refreshes.Add(1)
+	logger.Debug("Built routing table",
+		zap.Int("routes", len(table.exact)+len(table.patterns)),
+		zap.Bool("with_rules", withRules),
+		zap.Duration("duration", time.Since(start)))
+	return table, nil
+}
+
+// reload returns a routing table with the routes of the changed interfaces read again
+// from storage, keeping the other routes of table with anything they have loaded
+func (c *routeCache) reload(ctx context.Context, table *routeTable, changed []int64) (*routeTable, error) {
+	stale := make(map[int64]bool, len(changed))
+	for _, id := range changed {
+		stale[id] = true
+	}
+
+	routes := make([]*route, 0, len(table.routes)+len(changed))
+	for _, r := range table.routes {
+		if !stale[r.iface.ID] {
+			routes = append(routes, r)
+		}
+	}
+	for _, id := range changed {
+		interfaces, err := c.storage.GetMockUrl(ctx, id)
+		if err != nil {
+			logger.Error("Failed to reload route",
+				zap.Int64("interface_id", id),
+				zap.Error(err))
+			return nil, err
+		}
+		if len(interfaces) == 1 && interfaces[0].Status == model.StatusActive {
+			routes = append(routes, &route{iface: interfaces[0]})
+		}
+	}
+
+	logger.Debug("Reloaded changed routes",
+		zap.Int("changed", len(changed)))
+	return newRouteTable(routes), nil
+}
+
+// newRouteTable compiles routes into a routing table, skipping those whose URL pattern
+// does not compile
+func newRouteTable(routes []*route) *routeTable {
+	table := &routeTable{
+		exact:   make(map[string]*route),
+		builtAt: time.Now(),
+	}
+	for _, r := range routes {
+		iface := r.iface
+		if iface.URLType == model.URLTypeExact {
+			table.exact[iface.Method+" "+iface.URL] = r
+			table.routes = append(table.routes, r)
+			continue
+		}
+
+		// Routes kept from an older table are already compiled and may be in use
+		if r.pattern == nil {
+			p, err := storage.CompilePattern(iface.URLType, iface.URL)
+			if err != nil {
+				logger.Warn("Skipping interface with invalid URL pattern",
+					zap.Int64("interfaceID", iface.ID),
+					zap.String("url", iface.URL),
+					zap.Error(err))
+				continue
+			}
+			r.pattern = p
+		}
+		table.patterns = append(table.patterns, r)
+		table.routes = append(table.routes, r)
+	}
+
+	// Patterns are tried in precedence order: the more specific pattern, then the exact
+	// method over ANY, then the interface created first
+	sort.SliceStable(table.patterns, func(i, j int) bool {
+		a, b := table.patterns[i], table.patterns[j]
+		if cmp := a.pattern.Compare(b.pattern); cmp != 0 {
+			return cmp < 0
+		}
+		if (a.iface.Method == model.MethodAny) != (b.iface.Method == model.MethodAny) {
+			return b.iface.Method == model.MethodAny
+		}
+		return a.iface.ID < b.iface.ID
+	})
+	return table
+}
+
+// match finds the route for a request. Exact URLs are tried before patterns and, for the
+// same URL, a route for the exact method before one for ANY method.
+func (t *routeTable) match(method, url string) (*route, map[string]string) {
+	if r, ok := t.exact[method+" "+url]; ok {
+		return r, nil
+	}
+	if r, ok := t.exact[model.MethodAny+" "+url]; ok {
+		return r, nil
+	}
+
+	for _, r := range t.patterns {
+		if r.iface.Method != method && r.iface.Method != model.MethodAny {
+			continue
+		}
+		if params, ok := r.pattern.Match(url); ok {
+			return r, params
+		}
+	}
+	return nil, nil
+}
+
+// EnableRouteCache makes the mock path look stubs up in a compiled routing table instead
+// of storage. Writes through the service invalidate the stubs they change; with a positive
+// refreshInterval it is also rebuilt periodically, until ctx is done, to pick up changes
+// made by other instances. It must be called before the service handles requests.
+func (s *MockService) EnableRouteCache(ctx context.Context, refreshInterval time.Duration) {
+	s.routes = newRouteCache(s.storage)
+	if refreshInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.routes.refresh(ctx); err != nil {
+					logger.Warn("Failed to refresh routing table",
+						zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// invalidateRoutes marks a stub as changed after a write, when the route cache is enabled
+func (s *MockService) invalidateRoutes(interfaceID int64) {
+	if s.routes != nil {
+		s.routes.invalidate(interfaceID)
+	}
+}
+
+// invalidateRuleRoutes marks the stub of a rule as changed after a write, when the route
+// cache is enabled. If the rule cannot be read the whole routing table is dropped.
+func (s *MockService) invalidateRuleRoutes(ctx context.Context, ruleID int64) {
+	if s.routes == nil {
+		return
+	}
+	rule, err := s.storage.GetRuleByID(ctx, ruleID)
+	if err != nil {
+		s.routes.invalidateAll()
+		return
+	}
+	s.routes.invalidate(rule.InterfaceID)
+}
+
+// findStub returns the interface that serves a request and its active rules, from the
+// route cache when it is enabled
+func (s *MockService) findStub(ctx context.Context, method, url string) (*model.MockResponse, []model.Rule, error) {
+	if s.routes != nil {
+		return s.routes.lookup(ctx, method, url)
+	}
+
+	mockResp, err := s.storage.GetMockResponse(ctx, method, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, err := s.storage.GetRules(ctx, mockResp.InterfaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mockResp, rules, nil
+}
+
+// GetRouteCacheStats reports how often the mock path was served by the route cache
+func (s *MockService) GetRouteCacheStats(ctx context.Context, req *pb.GetRouteCacheStatsRequest) (*pb.GetRouteCacheStatsResponse, error) {
+	c := s.routes
+	if c == nil {
+		return &pb.GetRouteCacheStatsResponse{Success: true}, nil
+	}
+
+	resp := &pb.GetRouteCacheStatsResponse{
+		Success:       true,
+		Enabled:       true,
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+		Refreshes:     c.refreshes.Load(),
+	}
+	if total := resp.Hits + resp.Misses; total > 0 {
+		resp.HitRatio = float64(resp.Hits) / float64(total)
+	}
+
+	c.mu.RLock()
+	table := c.table
+	c.mu.RUnlock()
+	if table != nil {
+		resp.Routes = int32(len(table.exact) + len(table.patterns))
+		resp.RefreshedAt = table.builtAt.Format(time.RFC3339)
+	}
+	return resp, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("release")
+	os.Exit(m.Run())
+}
+
+func TestRouteCache(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	c := newRouteCache(store)
+
+	save := func(urlType, url, body string) int64 {
+		t.Helper()
+		id, err := store.SaveMockUrl(ctx, &model.Interface{URL: url, Method: "GET", URLType: urlType, ResponseCode: "200", ResponseBody: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	// lookup returns the body served for a URL, empty when no stub matches, and whether
+	// the cache served it without reading storage
+	lookup := func(url string) (string, bool) {
+		t.Helper()
+		misses := c.misses.Load()
+		resp, _, err := c.lookup(ctx, "GET", url)
+		hit := c.misses.Load() == misses
+		if err == sql.ErrNoRows {
+			return "", hit
+		}
+		if err != nil {
+			t.Fatalf("lookup(%s): %v", url, err)
+		}
+		return resp.ResponseBody, hit
+	}
+
+	a := save(model.URLTypeExact, "/a", "a")
+	b := save(model.URLTypeTemplate, "/b/{id}", "b")
+	if body, _ := lookup("/a"); body != "a" {
+		t.Fatalf("/a served %q, want a", body)
+	}
+	if body, _ := lookup("/b/1"); body != "b" {
+		t.Fatalf("/b/1 served %q, want b", body)
+	}
+	if body, hit := lookup("/b/2"); body != "b" || !hit {
+		t.Errorf("/b/2 served %q, hit %v, want b from the cache", body, hit)
+	}
+
+	// Invalidating a reloads it alone: b stays loaded
+	save(model.URLTypeExact, "/a", "a changed")
+	c.invalidate(a)
+	if body, hit := lookup("/a"); body != "a changed" || hit {
+		t.Errorf("after invalidating a, /a served %q, hit %v, want a changed from storage", body, hit)
+	}
+	if body, hit := lookup("/b/1"); body != "b" || !hit {
+		t.Errorf("after invalidating a, /b/1 served %q, hit %v, want b from the cache", body, hit)
+	}
+
+	// A new stub and a deactivated one are picked up by invalidating them
+	d := save(model.URLTypeTemplate, "/b/{id}/d", "d")
+	c.invalidate(d)
+	if body, _ := lookup("/b/1/d"); body != "d" {
+		t.Errorf("after adding d, /b/1/d served %q, want d", body)
+	}
+	if err := store.SetMockUrlStatus(ctx, b, model.StatusInactive); err != nil {
+		t.Fatal(err)
+	}
+	c.invalidate(b)
+	if body, _ := lookup("/b/1"); body != "" {
+		t.Errorf("after deactivating b, /b/1 served %q, want nothing", body)
+	}
+
+	// Refreshing loads every route with its rules
+	save(model.URLTypeExact, "/a", "a refreshed")
+	if err := c.refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if body, hit := lookup("/a"); body != "a refreshed" || !hit {
+		t.Errorf("after refreshing, /a served %q, hit %v, want a refreshed from the cache", body, hit)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"sort"
+	"sync"
+)
+
+// ScenarioStarted is the state every scenario is in until a rule moves it on
+const ScenarioStarted = "Started"
+
+// scenarioStore holds the current state of each scenario in memory
+type scenarioStore struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func newScenarioStore() *scenarioStore {
+	return &scenarioStore{states: make(map[string]string)}
+}
+
+// state returns the current state of a scenario
+func (s *scenarioStore) state(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stateLocked(name)
+}
+
+func (s *scenarioStore) stateLocked(name string) string {
+	if state, ok := s.states[name]; ok {
+		return state
+	}
+	return ScenarioStarted
+}
+
+// transition moves a scenario from required to next in one step. An empty required
+// state accepts any current state and an empty next state keeps the current one.
+// It reports false when the scenario is not in the required state, e.g. because a
+// concurrent request moved it on first.
+func (s *scenarioStore) transition(name, required, next string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if required != "" && s.stateLocked(name) != required {
+		return false
+	}
+	if next != "" {
+		s.states[name] = next
+	}
+	return true
+}
+
+// snapshot returns the state of the named scenarios and of any other scenario that has
+// left its initial state
+func (s *scenarioStore) snapshot(names []string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]string, len(names)+len(s.states))
+	for _, name := range names {
+		states[name] = s.stateLocked(name)
+	}
+	for name, state := range s.states {
+		states[name] = state
+	}
+	return states
+}
+
+// reset returns a scenario, or every scenario when name is empty, to its initial state
+func (s *scenarioStore) reset(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "" {
+		s.states = make(map[string]string)
+		return
+	}
+	delete(s.states, name)
+}
+
+func sortedScenarioNames(states map[string]string) []string {
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/jsonmatch"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/lru"
+	pb "github.com/xiaobailjlj/mocksvr_grpc/proto/mockserver"
+)
+
+// templateFuncs are the functions available to response templates:
+//
+//	now [layout]        current time, RFC 3339 unless a Go time layout is given
+//	unixMilli           current time in milliseconds since the epoch
+//	uuid                a random version 4 UUID
+//	counter "name"      a counter incremented on every call, starting at 1
+//	randomInt min max   a random integer in [min, max)
+//	toJSON value        value encoded as JSON
+var templateFuncs = template.FuncMap{
+	"now":       templateNow,
+	"unixMilli": func() int64 { return time.Now().UnixMilli() },
+	"uuid":      newUUID,
+	"counter":   nextCounter,
+	"randomInt": randomInt,
+	"toJSON":    toJSON,
+}
+
+// templateCache holds parsed response templates keyed by their source
+var templateCache = lru.New(4096)
+
+// templateCounters holds the counters used by the counter template function
+var templateCounters sync.Map
+
+// templateData is the request view available to response templates, e.g.
+// {{.Method}}, {{.Path.id}}, {{.Query "region"}}, {{.Header "X-Tenant"}} and
+// {{.JSONPath "$.order.id"}}
+type templateData struct {
+	Method      string
+	URL         string
+	Path        map[string]string
+	QueryParams url.Values
+	Headers     map[string]string
+	Body        string
+
+	req *matchRequest
+}
+
+func newTemplateData(m *matchRequest) *templateData {
+	query, _ := url.ParseQuery(m.query)
+	return &templateData{
+		Method:      m.method,
+		URL:         m.url,
+		Path:        m.pathParams,
+		QueryParams: query,
+		Headers:     m.headers,
+		Body:        m.body,
+		req:         m,
+	}
+}
+
+// Query returns the first value of a query parameter
+func (d *templateData) Query(key string) string {
+	return d.QueryParams.Get(key)
+}
+
+// Header returns a request header, looked up case-insensitively
+func (d *templateData) Header(name string) string {
+	return d.Headers[http.CanonicalHeaderKey(name)]
+}
+
+// JSONPath returns the first value selected by a JSONPath in the JSON request body.
+// Strings are returned as is, other values are encoded as JSON.
+func (d *templateData) JSONPath(path string) (string, error) {
+	p, err := jsonmatch.CompilePath(path)
+	if err != nil {
+		return "", err
+	}
+	body, err := d.req.decodedBody()
+	if err != nil {
+		return "", nil
+	}
+	values := p.Select(body)
+	if len(values) == 0 {
+		return "", nil
+	}
+	if s, ok := values[0].(string); ok {
+		return s, nil
+	}
+	return toJSON(values[0])
+}
+
+// ParseTemplate parses a response body or header value as a template, returning an error
+// that points at the offending line when it is invalid
+func ParseTemplate(src string) (*template.Template, error) {
+	if t, ok := templateCache.Get(src); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("response").Funcs(templateFuncs).Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.Add(src, t)
+	return t, nil
+}
+
+// ValidateResponseTemplate checks that a response body and its header values are valid
+// templates
+func ValidateResponseTemplate(body string, headers map[string]string) error {
+	if _, err := ParseTemplate(body); err != nil {
+		return fmt.Errorf("invalid response_body template: %v", err)
+	}
+	for k, v := range headers {
+		if _, err := ParseTemplate(v); err != nil {
+			return fmt.Errorf("invalid template in response_header %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+func renderTemplate(src string, data *templateData) (string, error) {
+	t, err := ParseTemplate(src)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// renderResponse renders a templated response body and header values for a request
+func renderResponse(body string, headers map[string]string, data *templateData) (string, map[string]string, error) {
+	renderedBody, err := renderTemplate(body, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to render response_body template: %v", err)
+	}
+
+	renderedHeaders := make(map[string]string, len(headers))
+	for k, v := range headers {
+		rendered, err := renderTemplate(v, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to render response_header %s template: %v", k, err)
+		}
+		renderedHeaders[k] = rendered
+	}
+	return renderedBody, renderedHeaders, nil
+}
+
+// buildMockResponse renders a response against the request when it is a template, then
+// expands its path parameter placeholders. Placeholders are expanded after rendering so
+// that captured path segments are never parsed as template code.
+func buildMockResponse(code string, headers map[string]string, body string, isTemplate bool, m *matchRequest) (*pb.MockResponse, error) {
+	if isTemplate {
+		var err error
+		body, headers, err = renderResponse(body, headers, newTemplateData(m))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body = expandPathParams(body, m.pathParams)
+	headers = expandHeaderPathParams(headers, m.pathParams)
+
+	headerJSON, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.MockResponse{
+		ResponseCode:   code,
+		ResponseHeader: string(headerJSON),
+		ResponseBody:   body,
+	}, nil
+}
+
+func templateNow(layout ...string) string {
+	if len(layout) > 0 {
+		return time.Now().Format(layout[0])
+	}
+	return time.Now().Format(time.RFC3339)
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func nextCounter(name string) int64 {
+	c, _ := templateCounters.LoadOrStore(name, new(int64))
+	return atomic.AddInt64(c.(*int64), 1)
+}
+
+func randomInt(min, max int) (int, error) {
+	if max <= min {
+		return 0, fmt.Errorf("randomInt: max must be greater than min")
+	}
+	return min + mathrand.Intn(max-min), nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
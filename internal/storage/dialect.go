@@ -0,0 +1,52 @@
+package storage
+
+import "strings"
+
+// dialect holds the SQL that differs between the databases MySQLStorage runs on
+type dialect struct {
+	// name is the storage driver, which names the directory of the dialect's migrations
+	name string
+	// multiStatements is set when a single Exec may run several statements
+	multiStatements bool
+	// forUpdate ends a SELECT that locks the rows it reads until the transaction ends
+	forUpdate string
+	// unixTime converts a timestamp column to Unix seconds
+	unixTime func(column string) string
+	// upsert ends an INSERT so that a row clashing on the unique key columns is updated
+	// with the inserted values of columns instead, then with the extra assignments
+	upsert func(key, columns []string, extra ...string) string
+}
+
+var mysqlDialect = dialect{
+	name:            DriverMySQL,
+	multiStatements: false,
+	forUpdate:       " FOR UPDATE",
+	unixTime: func(column string) string {
+		return "UNIX_TIMESTAMP(" + column + ")"
+	},
+	upsert: func(key, columns []string, extra ...string) string {
+		set := make([]string, 0, len(columns)+len(extra))
+		for _, c := range columns {
+			set = append(set, c+" = VALUES("+c+")")
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(append(set, extra...), ", ")
+	},
+}
+
+// sqliteDialect relies on transactions taking the write lock when they begin, which
+// serializes them without row locks
+var sqliteDialect = dialect{
+	name:            DriverSQLite,
+	multiStatements: true,
+	forUpdate:       "",
+	unixTime: func(column string) string {
+		return "CAST(strftime('%s', " + column + ") AS INTEGER)"
+	},
+	upsert: func(key, columns []string, extra ...string) string {
+		set := make([]string, 0, len(columns)+len(extra))
+		for _, c := range columns {
+			set = append(set, c+" = excluded."+c)
+		}
+		return "ON CONFLICT(" + strings.Join(key, ", ") + ") DO UPDATE SET " + strings.Join(append(set, extra...), ", ")
+	},
+}
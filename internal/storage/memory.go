@@ -0,0 +1,741 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/urlmatch"
+	"go.uber.org/zap"
+)
+
+// MemoryStorage keeps stubs in process memory. It behaves like MySQLStorage but loses
+// everything on restart, which suits tests and throwaway servers. It is safe for
+// concurrent use; values are copied in and out so callers never share its state.
+type MemoryStorage struct {
+	mu         sync.RWMutex
+	interfaces map[int64]*model.Interface
+	rules      map[int64]*memoryRule
+	revisions  map[int64][]*model.Revision
+	lastID     struct{ iface, rule, revision, deleteBatch int64 }
+
+	// deleteBatches holds the delete batch of each deleted interface, which its rules
+	// deleted with it share
+	deleteBatches map[int64]int64
+}
+
+// memoryRule is a stored rule with the bookkeeping MySQL keeps in columns
+type memoryRule struct {
+	rule        model.Rule
+	deletedAt   time.Time
+	deleteBatch int64
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		interfaces:    make(map[int64]*model.Interface),
+		rules:         make(map[int64]*memoryRule),
+		revisions:     make(map[int64][]*model.Revision),
+		deleteBatches: make(map[int64]int64),
+	}
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// SaveMockUrl creates the interface for its URL and method, or overwrites and reactivates
+// the existing one
+func (s *MemoryStorage) SaveMockUrl(ctx context.Context, iface *model.Interface) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := copyInterface(iface)
+	saved.Status = model.StatusActive
+	saved.DeletedAt = time.Time{}
+	saved.UpdatedAt = time.Now()
+
+	if existing := s.findInterface(iface.URL, iface.Method); existing != nil {
+		saved.ID = existing.ID
+		saved.CreatedAt = existing.CreatedAt
+		saved.Version = existing.Version + 1
+		delete(s.deleteBatches, saved.ID)
+	} else {
+		s.lastID.iface++
+		saved.ID = s.lastID.iface
+		saved.CreatedAt = saved.UpdatedAt
+		saved.Version = 1
+	}
+	s.interfaces[saved.ID] = saved
+
+	logger.Debug("Saved mock URL in memory",
+		zap.Int64("id", saved.ID),
+		zap.String("url", saved.URL),
+		zap.String("method", saved.Method))
+	return saved.ID, nil
+}
+
+// findInterface returns the interface with a URL and method in any status
+func (s *MemoryStorage) findInterface(url, method string) *model.Interface {
+	for _, iface := range s.interfaces {
+		if iface.URL == url && iface.Method == method {
+			return iface
+		}
+	}
+	return nil
+}
+
+// UpdateMockUrl overwrites an interface that has not been deleted, keeping its status.
+// It returns sql.ErrNoRows when there is no such interface, and ErrVersionConflict when
+// iface.Version is set and the interface is no longer at that version.
+func (s *MemoryStorage) UpdateMockUrl(ctx context.Context, iface *model.Interface) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.interfaces[iface.ID]
+	if !ok || current.Status == model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+	if iface.Version != 0 && iface.Version != current.Version {
+		return ErrVersionConflict
+	}
+	if other := s.findInterface(iface.URL, iface.Method); other != nil && other.ID != iface.ID {
+		return fmt.Errorf("failed to update stub interface: %s %s is already used by interface %d", iface.Method, iface.URL, other.ID)
+	}
+
+	updated := copyInterface(iface)
+	updated.Status = current.Status
+	updated.Source = current.Source
+	updated.CreatedAt = current.CreatedAt
+	updated.UpdatedAt = time.Now()
+	updated.Version = current.Version + 1
+	s.interfaces[iface.ID] = updated
+	return nil
+}
+
+// GetMockResponse looks up the active interface for a request with the same precedence
+// as MySQLStorage.GetMockResponse
+func (s *MemoryStorage) GetMockResponse(ctx context.Context, method, url string) (*model.MockResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var best *model.Interface
+	var bestPattern *urlmatch.Pattern
+	var bestParams map[string]string
+	for _, iface := range s.sortedInterfaces() {
+		if iface.Status != model.StatusActive || (iface.Method != method && iface.Method != model.MethodAny) {
+			continue
+		}
+
+		if iface.URLType == model.URLTypeExact {
+			if iface.URL != url {
+				continue
+			}
+			// Exact URLs beat patterns, and the exact method beats ANY
+			if bestPattern == nil && best != nil && (iface.Method == model.MethodAny || best.Method != model.MethodAny) {
+				continue
+			}
+			best, bestPattern, bestParams = iface, nil, nil
+			continue
+		}
+		if best != nil && bestPattern == nil {
+			continue
+		}
+
+		p, err := CompilePattern(iface.URLType, iface.URL)
+		if err != nil {
+			logger.Warn("Skipping interface with invalid URL pattern",
+				zap.Int64("interfaceID", iface.ID),
+				zap.String("url", iface.URL),
+				zap.Error(err))
+			continue
+		}
+		params, ok := p.Match(url)
+		if !ok {
+			continue
+		}
+		if bestPattern != nil {
+			cmp := p.Compare(bestPattern)
+			if cmp > 0 || (cmp == 0 && (iface.Method == model.MethodAny || best.Method != model.MethodAny)) {
+				continue
+			}
+		}
+		best, bestPattern, bestParams = iface, p, params
+	}
+
+	if best == nil {
+		return nil, sql.ErrNoRows
+	}
+	return &model.MockResponse{
+		InterfaceID:    best.ID,
+		ResponseCode:   best.ResponseCode,
+		ResponseHeader: copyHeader(best.ResponseHeader),
+		ResponseBody:   best.ResponseBody,
+		Template:       best.Template,
+		DelaySpec:      copyDelaySpec(best.DelaySpec),
+		ProxyURL:       best.ProxyURL,
+		PathParams:     bestParams,
+	}, nil
+}
+
+// GetAllMockUrls lists interfaces with the given status, or every interface that has not
+// been deleted when status is model.StatusFilterAll, newest first
+func (s *MemoryStorage) GetAllMockUrls(ctx context.Context, keyword string, owner string, status string, page, pageSize int) ([]*model.Interface, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []*model.Interface
+	sorted := s.sortedInterfaces()
+	for i := len(sorted) - 1; i >= 0; i-- {
+		iface := sorted[i]
+		if status == model.StatusFilterAll {
+			if iface.Status == model.StatusDeleted {
+				continue
+			}
+		} else if string(iface.Status) != status {
+			continue
+		}
+		if keyword != "" && !strings.Contains(strings.ToLower(iface.URL), strings.ToLower(keyword)) {
+			continue
+		}
+		if owner != "" && iface.Owner != owner {
+			continue
+		}
+		matched = append(matched, iface)
+	}
+
+	total := len(matched)
+	offset := (page - 1) * pageSize
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + pageSize
+	if pageSize < 0 || end > total {
+		end = total
+	}
+
+	interfaces := make([]*model.Interface, 0, end-offset)
+	for _, iface := range matched[offset:end] {
+		interfaces = append(interfaces, copyInterface(iface))
+	}
+	return interfaces, total, nil
+}
+
+func (s *MemoryStorage) GetMockUrl(ctx context.Context, urlId int64) ([]*model.Interface, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	iface, ok := s.interfaces[urlId]
+	if !ok || iface.Status == model.StatusDeleted {
+		return nil, nil
+	}
+	return []*model.Interface{copyInterface(iface)}, nil
+}
+
+// GetMockUrlRoutes returns the ID, URL, URL type, method, status and source of every
+// interface that has not been deleted
+func (s *MemoryStorage) GetMockUrlRoutes(ctx context.Context) ([]*model.Interface, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var routes []*model.Interface
+	for _, iface := range s.sortedInterfaces() {
+		if iface.Status == model.StatusDeleted {
+			continue
+		}
+		routes = append(routes, &model.Interface{
+			ID:      iface.ID,
+			URL:     iface.URL,
+			URLType: iface.URLType,
+			Method:  iface.Method,
+			Status:  iface.Status,
+			Source:  iface.Source,
+		})
+	}
+	return routes, nil
+}
+
+// GetActiveMockUrls returns every active interface with its default response, and the
+// active rules of each in evaluation order keyed by interface ID
+func (s *MemoryStorage) GetActiveMockUrls(ctx context.Context) ([]*model.Interface, map[int64][]model.Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var interfaces []*model.Interface
+	rules := make(map[int64][]model.Rule)
+	for _, iface := range s.sortedInterfaces() {
+		if iface.Status != model.StatusActive {
+			continue
+		}
+		interfaces = append(interfaces, copyInterface(iface))
+		for _, r := range s.sortedRules(iface.ID) {
+			if r.rule.Status == model.StatusActive {
+				rule := copyRule(&r.rule)
+				rule.InterfaceID = 0
+				rule.Status = ""
+				rules[iface.ID] = append(rules[iface.ID], *rule)
+			}
+		}
+	}
+	return interfaces, rules, nil
+}
+
+// DeleteMockUrl marks an interface as deleted together with its active rules. It returns
+// sql.ErrNoRows when no interface that has not been deleted has the ID.
+func (s *MemoryStorage) DeleteMockUrl(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	iface, ok := s.interfaces[id]
+	if !ok || iface.Status == model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	s.lastID.deleteBatch++
+	iface.Status = model.StatusDeleted
+	iface.DeletedAt = now
+	iface.Version++
+	s.deleteBatches[id] = s.lastID.deleteBatch
+	for _, r := range s.rules {
+		if r.rule.InterfaceID == id && r.rule.Status == model.StatusActive {
+			r.rule.Status = model.StatusDeleted
+			r.deletedAt = now
+			r.deleteBatch = s.lastID.deleteBatch
+		}
+	}
+	return nil
+}
+
+// RestoreMockUrl makes a deleted interface active again, together with the rules that
+// were deleted with it. It returns sql.ErrNoRows when no deleted interface has the ID.
+func (s *MemoryStorage) RestoreMockUrl(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	iface, ok := s.interfaces[id]
+	if !ok || iface.Status != model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+
+	batch := s.deleteBatches[id]
+	for _, r := range s.rules {
+		if r.rule.InterfaceID == id && r.rule.Status == model.StatusDeleted && r.deleteBatch != 0 && r.deleteBatch == batch {
+			r.rule.Status = model.StatusActive
+			r.deletedAt = time.Time{}
+			r.deleteBatch = 0
+		}
+	}
+	iface.Status = model.StatusActive
+	iface.DeletedAt = time.Time{}
+	iface.Version++
+	delete(s.deleteBatches, id)
+	return nil
+}
+
+// PurgeMockUrl removes a deleted interface for good, together with its rules. Its
+// revisions are kept as its history. It returns sql.ErrNoRows when no deleted interface
+// has the ID.
+func (s *MemoryStorage) PurgeMockUrl(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	iface, ok := s.interfaces[id]
+	if !ok || iface.Status != model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+
+	for ruleID, r := range s.rules {
+		if r.rule.InterfaceID == id {
+			delete(s.rules, ruleID)
+		}
+	}
+	delete(s.interfaces, id)
+	delete(s.deleteBatches, id)
+	return nil
+}
+
+// SetMockUrlStatus moves an interface between active and inactive. It returns
+// sql.ErrNoRows when no interface with the ID exists or it has been deleted.
+func (s *MemoryStorage) SetMockUrlStatus(ctx context.Context, id int64, status model.Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	iface, ok := s.interfaces[id]
+	if !ok || iface.Status == model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+	iface.Status = status
+	iface.Version++
+	return nil
+}
+
+func (s *MemoryStorage) SaveRule(ctx context.Context, interfaceID int64, rule *model.Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.interfaces[interfaceID]; !ok {
+		return fmt.Errorf("failed to insert rule: no stub interface found with ID %d", interfaceID)
+	}
+
+	s.lastID.rule++
+	saved := copyRule(rule)
+	saved.ID = s.lastID.rule
+	saved.InterfaceID = interfaceID
+	saved.Status = model.StatusActive
+	s.rules[saved.ID] = &memoryRule{rule: *saved}
+	rule.ID = saved.ID
+	s.touch(interfaceID)
+	return nil
+}
+
+// UpdateRule overwrites a rule that has not been deleted, keeping its interface and
+// status. It returns sql.ErrNoRows when there is no such rule.
+func (s *MemoryStorage) UpdateRule(ctx context.Context, rule *model.Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.rules[rule.ID]
+	if !ok || current.rule.Status == model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+	updated := copyRule(rule)
+	updated.InterfaceID = current.rule.InterfaceID
+	updated.Status = current.rule.Status
+	current.rule = *updated
+	s.touch(updated.InterfaceID)
+	return nil
+}
+
+// ReplaceRules makes rules the rule set of an interface at once. Rules with an ID are
+// updated in place, the others are inserted and get their IDs set, and the interface's
+// rules left out are marked deleted. It returns sql.ErrNoRows when a rule ID is not one
+// of the interface's rules that have not been deleted.
+func (s *MemoryStorage) ReplaceRules(ctx context.Context, interfaceID int64, rules []*model.Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.interfaces[interfaceID]; !ok {
+		return fmt.Errorf("failed to insert rule: no stub interface found with ID %d", interfaceID)
+	}
+	left := make(map[int64]bool)
+	for id, r := range s.rules {
+		if r.rule.InterfaceID == interfaceID && r.rule.Status != model.StatusDeleted {
+			left[id] = true
+		}
+	}
+	for _, rule := range rules {
+		if rule.ID == 0 {
+			continue
+		}
+		if !left[rule.ID] {
+			return sql.ErrNoRows
+		}
+		delete(left, rule.ID)
+	}
+
+	for _, rule := range rules {
+		if rule.ID != 0 {
+			current := s.rules[rule.ID]
+			updated := copyRule(rule)
+			updated.InterfaceID = interfaceID
+			updated.Status = current.rule.Status
+			current.rule = *updated
+			continue
+		}
+		s.lastID.rule++
+		saved := copyRule(rule)
+		saved.ID = s.lastID.rule
+		saved.InterfaceID = interfaceID
+		saved.Status = model.StatusActive
+		s.rules[saved.ID] = &memoryRule{rule: *saved}
+		rule.ID = saved.ID
+	}
+
+	now := time.Now()
+	for id := range left {
+		s.rules[id].rule.Status = model.StatusDeleted
+		s.rules[id].deletedAt = now
+	}
+	s.touch(interfaceID)
+	return nil
+}
+
+// GetRules returns the active rules of an interface in evaluation order
+func (s *MemoryStorage) GetRules(ctx context.Context, interfaceID int64) ([]model.Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rules []model.Rule
+	for _, r := range s.sortedRules(interfaceID) {
+		if r.rule.Status == model.StatusActive {
+			rule := copyRule(&r.rule)
+			rule.InterfaceID = 0
+			rule.Status = ""
+			rules = append(rules, *rule)
+		}
+	}
+	return rules, nil
+}
+
+// GetRulesByInterfaceID returns the rules of an interface that have not been deleted, in
+// evaluation order
+func (s *MemoryStorage) GetRulesByInterfaceID(ctx context.Context, interfaceID int64) ([]*model.Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rules []*model.Rule
+	for _, r := range s.sortedRules(interfaceID) {
+		if r.rule.Status != model.StatusDeleted {
+			rule := copyRule(&r.rule)
+			rule.InterfaceID = 0
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// GetRuleByID returns a rule that has not been deleted, with its interface ID set. It
+// returns sql.ErrNoRows when there is no such rule.
+func (s *MemoryStorage) GetRuleByID(ctx context.Context, ruleID int64) (*model.Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.rules[ruleID]
+	if !ok || r.rule.Status == model.StatusDeleted {
+		return nil, sql.ErrNoRows
+	}
+	return copyRule(&r.rule), nil
+}
+
+// ReorderRules sets the priority of an interface's rules to their position in ruleIDs,
+// which must list every rule of the interface exactly once, or ErrInvalidReorder is
+// returned
+func (s *MemoryStorage) ReorderRules(ctx context.Context, interfaceID int64, ruleIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := make(map[int64]bool)
+	for id, r := range s.rules {
+		if r.rule.InterfaceID == interfaceID && r.rule.Status != model.StatusDeleted {
+			existing[id] = true
+		}
+	}
+
+	if len(ruleIDs) != len(existing) {
+		return fmt.Errorf("%w: rule_ids must list all %d rules of interface %d", ErrInvalidReorder, len(existing), interfaceID)
+	}
+	seen := make(map[int64]bool, len(ruleIDs))
+	for _, id := range ruleIDs {
+		if !existing[id] {
+			return fmt.Errorf("%w: rule %d does not belong to interface %d", ErrInvalidReorder, id, interfaceID)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: rule %d is listed more than once", ErrInvalidReorder, id)
+		}
+		seen[id] = true
+	}
+
+	for i, id := range ruleIDs {
+		s.rules[id].rule.Priority = int32(i + 1)
+	}
+	s.touch(interfaceID)
+	return nil
+}
+
+// DeleteRule marks a rule as deleted. It returns sql.ErrNoRows when there is no rule with
+// the ID that has not been deleted yet.
+func (s *MemoryStorage) DeleteRule(ctx context.Context, ruleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rules[ruleID]
+	if !ok || r.rule.Status == model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+	r.rule.Status = model.StatusDeleted
+	r.deletedAt = time.Now()
+	s.touch(r.rule.InterfaceID)
+	return nil
+}
+
+// DeleteRules removes every rule of an interface
+func (s *MemoryStorage) DeleteRules(ctx context.Context, interfaceID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, r := range s.rules {
+		if r.rule.InterfaceID == interfaceID {
+			delete(s.rules, id)
+		}
+	}
+	s.touch(interfaceID)
+	return nil
+}
+
+// SetRuleStatus moves a rule between active and inactive. It returns sql.ErrNoRows when
+// no rule with the ID exists or it has been deleted.
+func (s *MemoryStorage) SetRuleStatus(ctx context.Context, ruleID int64, status model.Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rules[ruleID]
+	if !ok || r.rule.Status == model.StatusDeleted {
+		return sql.ErrNoRows
+	}
+	r.rule.Status = status
+	s.touch(r.rule.InterfaceID)
+	return nil
+}
+
+// GetScenarios returns the names of the scenarios used by active rules
+func (s *MemoryStorage) GetScenarios(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range s.rules {
+		if r.rule.Scenario != "" && r.rule.Status == model.StatusActive && !seen[r.rule.Scenario] {
+			seen[r.rule.Scenario] = true
+			names = append(names, r.rule.Scenario)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SaveRevision stores a revision of an interface as its next version, which it sets
+func (s *MemoryStorage) SaveRevision(ctx context.Context, rev *model.Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID.revision++
+	saved := *rev
+	saved.ID = s.lastID.revision
+	saved.Version = int32(len(s.revisions[rev.InterfaceID]) + 1)
+	saved.CreatedAt = time.Now()
+	s.revisions[rev.InterfaceID] = append(s.revisions[rev.InterfaceID], &saved)
+
+	rev.ID = saved.ID
+	rev.Version = saved.Version
+	rev.CreatedAt = saved.CreatedAt
+	return nil
+}
+
+// GetRevisions returns the revisions of an interface, newest first
+func (s *MemoryStorage) GetRevisions(ctx context.Context, interfaceID int64) ([]*model.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.revisions[interfaceID]
+	revisions := make([]*model.Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		rev := *stored[i]
+		revisions = append(revisions, &rev)
+	}
+	return revisions, nil
+}
+
+// GetRevision returns one revision of an interface, the latest when version is 0. It
+// returns sql.ErrNoRows when there is no such revision.
+func (s *MemoryStorage) GetRevision(ctx context.Context, interfaceID int64, version int32) (*model.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.revisions[interfaceID]
+	if version == 0 {
+		version = int32(len(stored))
+	}
+	if version < 1 || int(version) > len(stored) {
+		return nil, sql.ErrNoRows
+	}
+	rev := *stored[version-1]
+	return &rev, nil
+}
+
+// touch counts a change to an interface or its rules in the interface's version
+func (s *MemoryStorage) touch(interfaceID int64) {
+	if iface, ok := s.interfaces[interfaceID]; ok {
+		iface.Version++
+	}
+}
+
+// sortedInterfaces returns the stored interfaces by ascending ID
+func (s *MemoryStorage) sortedInterfaces() []*model.Interface {
+	interfaces := make([]*model.Interface, 0, len(s.interfaces))
+	for _, iface := range s.interfaces {
+		interfaces = append(interfaces, iface)
+	}
+	sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].ID < interfaces[j].ID })
+	return interfaces
+}
+
+// sortedRules returns the stored rules of an interface in evaluation order
+func (s *MemoryStorage) sortedRules(interfaceID int64) []*memoryRule {
+	var rules []*memoryRule
+	for _, r := range s.rules {
+		if r.rule.InterfaceID == interfaceID {
+			rules = append(rules, r)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].rule.Priority != rules[j].rule.Priority {
+			return rules[i].rule.Priority < rules[j].rule.Priority
+		}
+		return rules[i].rule.ID < rules[j].rule.ID
+	})
+	return rules
+}
+
+func copyInterface(iface *model.Interface) *model.Interface {
+	c := *iface
+	c.ResponseHeader = copyHeader(iface.ResponseHeader)
+	c.DelaySpec = copyDelaySpec(iface.DelaySpec)
+	return &c
+}
+
+func copyRule(rule *model.Rule) *model.Rule {
+	c := *rule
+	c.ResponseHeader = copyHeader(rule.ResponseHeader)
+	c.DelaySpec = copyDelaySpec(rule.DelaySpec)
+	if rule.Conditions != nil {
+		c.Conditions = append([]model.Condition(nil), rule.Conditions...)
+	}
+	if rule.Responses != nil {
+		c.Responses = make([]model.RuleResponse, len(rule.Responses))
+		for i, resp := range rule.Responses {
+			resp.ResponseHeader = copyHeader(resp.ResponseHeader)
+			c.Responses[i] = resp
+		}
+	}
+	return &c
+}
+
+func copyHeader(header map[string]string) map[string]string {
+	if header == nil {
+		return nil
+	}
+	c := make(map[string]string, len(header))
+	for k, v := range header {
+		c[k] = v
+	}
+	return c
+}
+
+func copyDelaySpec(spec *model.DelaySpec) *model.DelaySpec {
+	if spec == nil {
+		return nil
+	}
+	c := *spec
+	return &c
+}
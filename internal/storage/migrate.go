@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// migrationFiles holds the migrations of each dialect under migrations/<driver>, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrNoSchema is returned by NewMigrator for storage that keeps no database schema
+var ErrNoSchema = errors.New("storage has no database schema to migrate")
+
+// Migration is a versioned change to the database schema
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus tells whether a migration has been applied to the database. Applied
+// migrations unknown to this build, from a newer one, have no up or down SQL.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and reverts the migrations embedded for a SQL database, recording the
+// applied versions in the schema_migrations table. MySQL commits schema changes as it
+// makes them, so a migration that fails there may be left half applied.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the database of a MySQL or SQLite storage, and
+// ErrNoSchema for any other storage
+func NewMigrator(store Storage) (*Migrator, error) {
+	var s *MySQLStorage
+	switch st := store.(type) {
+	case *MySQLStorage:
+		s = st
+	case *SQLiteStorage:
+		s = st.MySQLStorage
+	default:
+		return nil, ErrNoSchema
+	}
+
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		logger.Error("Failed to load migrations",
+			zap.String("driver", s.dialect.name),
+			zap.Error(err))
+		return nil, err
+	}
+	return &Migrator{db: s.db, dialect: s.dialect, migrations: migrations}, nil
+}
+
+// loadMigrations reads the embedded migrations of a dialect in version order
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Latest returns the version of the newest migration in this build
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the newest migration version applied to the database, 0 for none
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Status lists the migrations of this build and any newer ones applied to the database,
+// in version order
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if a, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, a := range applied {
+		statuses = append(statuses, a)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Up applies the migrations not yet applied, up to and including version target, or all
+// of them when target is 0. It returns the migrations it applied.
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		start := time.Now()
+		err := m.run(ctx, migration.up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+				migration.Version, migration.Name)
+			return err
+		})
+		if err != nil {
+			logger.Error("Failed to apply migration",
+				zap.Int("version", migration.Version),
+				zap.String("name", migration.Name),
+				zap.Error(err))
+			return done, fmt.Errorf("failed to apply migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+
+		logger.Info("Applied migration",
+			zap.Int("version", migration.Version),
+			zap.String("name", migration.Name),
+			zap.Duration("duration", time.Since(start)))
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the steps most recently applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	known := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	var done []Migration
+	for _, version := range versions {
+		migration, ok := known[version]
+		if !ok {
+			return done, fmt.Errorf("migration %d was applied by a newer build and cannot be reverted by this one", version)
+		}
+
+		start := time.Now()
+		err := m.run(ctx, migration.down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+			return err
+		})
+		if err != nil {
+			logger.Error("Failed to revert migration",
+				zap.Int("version", migration.Version),
+				zap.String("name", migration.Name),
+				zap.Error(err))
+			return done, fmt.Errorf("failed to revert migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+
+		logger.Info("Reverted migration",
+			zap.Int("version", migration.Version),
+			zap.String("name", migration.Name),
+			zap.Duration("duration", time.Since(start)))
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// applied returns the migrations recorded in schema_migrations by version, creating the
+// table if needed
+func (m *Migrator) applied(ctx context.Context) (map[int]MigrationStatus, error) {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(128) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		logger.Error("Failed to create schema_migrations table",
+			zap.Error(err))
+		return nil, err
+	}
+
+	query := `SELECT version, name, COALESCE(` + m.dialect.unixTime("applied_at") + `, 0) FROM schema_migrations`
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		logger.Error("Failed to query applied migrations",
+			zap.String("query", query),
+			zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt int64
+		if err := rows.Scan(&status.Version, &status.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		status.Applied = true
+		status.AppliedAt = time.Unix(appliedAt, 0)
+		applied[status.Version] = status
+	}
+	return applied, rows.Err()
+}
+
+// run executes a migration script and records it with record in one transaction
+func (m *Migrator) run(ctx context.Context, script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{script}
+	if !m.dialect.multiStatements {
+		statements = splitStatements(script)
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitStatements splits a script into statements that each end with a semicolon at the
+// end of a line
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if statement := strings.TrimSpace(current.String()); statement != ";" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
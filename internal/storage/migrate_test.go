@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestMigrationsMatch checks that both dialects have the same migrations
+func TestMigrationsMatch(t *testing.T) {
+	mysql, err := loadMigrations(DriverMySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := loadMigrations(DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(migrations []Migration) []string {
+		out := make([]string, 0, len(migrations))
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+			}
+			out = append(out, m.Name)
+		}
+		return out
+	}
+	if got, want := names(sqlite), names(mysql); !reflect.DeepEqual(got, want) {
+		t.Errorf("sqlite migrations = %v, want the mysql ones %v", got, want)
+	}
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewSQLiteStorage(SQLiteScheme + filepath.Join(t.TempDir(), "mocksvr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m, err := NewMigrator(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := m.Latest()
+	if latest < 4 {
+		t.Fatalf("Latest() = %d, want a few migrations to test with", latest)
+	}
+
+	// recorded lists the versions in schema_migrations
+	recorded := func() []int {
+		t.Helper()
+		rows, err := store.db.QueryContext(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		versions := []int{}
+		for rows.Next() {
+			var v int
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			versions = append(versions, v)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return versions
+	}
+	upTo := func(n int) []int {
+		versions := []int{}
+		for v := 1; v <= n; v++ {
+			versions = append(versions, v)
+		}
+		return versions
+	}
+	versions := func(migrations []Migration) []int {
+		out := []int{}
+		for _, migration := range migrations {
+			out = append(out, migration.Version)
+		}
+		return out
+	}
+
+	if v, err := m.Version(ctx); err != nil || v != 0 {
+		t.Fatalf("Version() of an empty database = %d, %v, want 0", v, err)
+	}
+
+	done, err := m.Up(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("Up(2) applied %v, want [1 2]", got)
+	}
+	if got := recorded(); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("after Up(2), schema_migrations = %v, want [1 2]", got)
+	}
+
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorded(); !reflect.DeepEqual(got, upTo(latest)) {
+		t.Errorf("after Up(0), schema_migrations = %v, want 1 to %d", got, latest)
+	}
+	if done, err := m.Up(ctx, 0); err != nil || len(done) != 0 {
+		t.Errorf("Up(0) of an up to date database applied %v, %v", versions(done), err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != latest {
+		t.Fatalf("Status() = %d migrations, want %d", len(statuses), latest)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt.IsZero() {
+			t.Errorf("migration %d_%s is not applied", status.Version, status.Name)
+		}
+	}
+
+	done, err = m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !reflect.DeepEqual(got, []int{latest, latest - 1}) {
+		t.Errorf("Down(2) reverted %v, want [%d %d]", got, latest, latest-1)
+	}
+	if v, err := m.Version(ctx); err != nil || v != latest-2 {
+		t.Errorf("after Down(2), Version() = %d, %v, want %d", v, err, latest-2)
+	}
+	statuses, err = m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[latest-1].Applied || !statuses[latest-3].Applied {
+		t.Error("Status() does not show the reverted migrations as pending")
+	}
+
+	// Every down migration reverts cleanly, and the schema comes back whole
+	if _, err := m.Down(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorded(); len(got) != 0 {
+		t.Errorf("after reverting everything, schema_migrations = %v", got)
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorded(); !reflect.DeepEqual(got, upTo(latest)) {
+		t.Errorf("after migrating up again, schema_migrations = %v, want 1 to %d", got, latest)
+	}
+	testSaveMockUrl(t, store)
+}
+
+func TestMigratorMemory(t *testing.T) {
+	if _, err := NewMigrator(NewMemoryStorage()); err != ErrNoSchema {
+		t.Errorf("NewMigrator(memory) = %v, want ErrNoSchema", err)
+	}
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `stub_rule`;
+DROP TABLE IF EXISTS `stub_interface`;
@@ -0,0 +1,4 @@
+ALTER TABLE `stub_interface`
+    DROP INDEX `url_method`,
+    ADD UNIQUE KEY `url`(`url`),
+    DROP COLUMN `method`;
@@ -0,0 +1,4 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `method` varchar(16) NOT NULL DEFAULT 'ANY' COMMENT 'HTTP method, ANY matches every method' AFTER `url`,
+    DROP INDEX `url`,
+    ADD UNIQUE KEY `url_method`(`url`, `method`);
@@ -0,0 +1,2 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `url_type` ENUM('exact', 'template', 'regex') NOT NULL DEFAULT 'exact' AFTER `method`;
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS `stub_rule_condition`;
+
+ALTER TABLE `stub_rule`
+    ADD UNIQUE KEY `unique_interface_rule` (`interface_id`, `match_type`);
+
+ALTER TABLE `stub_rule`
+    DROP INDEX `idx_interface`,
+    DROP COLUMN `logic`,
+    MODIFY COLUMN `match_type` int(32) NOT NULL COMMENT '1:match request query url, 2:match request body';
@@ -0,0 +1,18 @@
+ALTER TABLE `stub_rule`
+    MODIFY COLUMN `match_type` int(32) NOT NULL DEFAULT '0' COMMENT '0:conditions only, 1:match request query parameters, 2:match request body, 3:match request headers, 4:match path parameters, 5:match JSON body subset, 6:match JSONPath predicate',
+    ADD COLUMN `logic` ENUM('and', 'or') NOT NULL DEFAULT 'and' COMMENT 'how the rule conditions are combined' AFTER `match_rule`,
+    ADD KEY `idx_interface` (`interface_id`);
+
+ALTER TABLE `stub_rule`
+    DROP INDEX `unique_interface_rule`;
+
+CREATE TABLE IF NOT EXISTS `stub_rule_condition` (
+                             `id` int(32) NOT NULL AUTO_INCREMENT,
+                             `rule_id` int(32) NOT NULL,
+                             `match_type` int(32) NOT NULL COMMENT 'same values as stub_rule.match_type',
+                             `match_rule` varchar(512) DEFAULT NULL,
+                             `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             PRIMARY KEY (`id`),
+                             KEY `idx_rule` (`rule_id`),
+                             FOREIGN KEY (`rule_id`) REFERENCES `stub_rule` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='rule condition';
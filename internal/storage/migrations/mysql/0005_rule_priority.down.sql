@@ -0,0 +1,6 @@
+ALTER TABLE `stub_rule`
+    ADD KEY `idx_interface` (`interface_id`);
+
+ALTER TABLE `stub_rule`
+    DROP INDEX `idx_interface_priority`,
+    DROP COLUMN `priority`;
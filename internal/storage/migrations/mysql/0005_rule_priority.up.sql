@@ -0,0 +1,6 @@
+ALTER TABLE `stub_rule`
+    ADD COLUMN `priority` int(32) NOT NULL DEFAULT '0' COMMENT 'rules are evaluated by ascending priority, then id' AFTER `logic`,
+    ADD KEY `idx_interface_priority` (`interface_id`, `priority`);
+
+ALTER TABLE `stub_rule`
+    DROP INDEX `idx_interface`;
@@ -0,0 +1,5 @@
+ALTER TABLE `stub_rule`
+    DROP COLUMN `resp_template`;
+
+ALTER TABLE `stub_interface`
+    DROP COLUMN `def_resp_template`;
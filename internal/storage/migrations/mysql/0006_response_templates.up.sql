@@ -0,0 +1,5 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `def_resp_template` tinyint(1) NOT NULL DEFAULT '0' COMMENT 'render body and header values as Go templates' AFTER `def_resp_body`;
+
+ALTER TABLE `stub_rule`
+    ADD COLUMN `resp_template` tinyint(1) NOT NULL DEFAULT '0' COMMENT 'render body and header values as Go templates' AFTER `resp_body`;
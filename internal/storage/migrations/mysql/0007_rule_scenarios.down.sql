@@ -0,0 +1,4 @@
+ALTER TABLE `stub_rule`
+    DROP COLUMN `new_state`,
+    DROP COLUMN `required_state`,
+    DROP COLUMN `scenario`;
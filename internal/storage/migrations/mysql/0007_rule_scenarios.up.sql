@@ -0,0 +1,4 @@
+ALTER TABLE `stub_rule`
+    ADD COLUMN `scenario` varchar(128) NOT NULL DEFAULT '' COMMENT 'scenario the rule belongs to, empty for none' AFTER `delay_time`,
+    ADD COLUMN `required_state` varchar(128) NOT NULL DEFAULT '' COMMENT 'scenario state the rule requires, empty for any' AFTER `scenario`,
+    ADD COLUMN `new_state` varchar(128) NOT NULL DEFAULT '' COMMENT 'scenario state set when the rule matches, empty to keep it' AFTER `required_state`;
@@ -0,0 +1,15 @@
+ALTER TABLE `stub_rule`
+    ADD COLUMN `resp_mode` ENUM('single', 'cycle', 'last', 'weighted') NOT NULL DEFAULT 'single' COMMENT 'single: resp_* columns, cycle/last: stub_rule_response in order, weighted: stub_rule_response by weight' AFTER `resp_template`;
+
+CREATE TABLE IF NOT EXISTS `stub_rule_response` (
+                             `id` int(32) NOT NULL AUTO_INCREMENT,
+                             `rule_id` int(32) NOT NULL,
+                             `resp_code` varchar(16) DEFAULT NULL,
+                             `resp_header` mediumtext DEFAULT NULL,
+                             `resp_body` mediumtext,
+                             `weight` int(32) NOT NULL DEFAULT '1' COMMENT 'relative weight when resp_mode is weighted',
+                             `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             PRIMARY KEY (`id`),
+                             KEY `idx_rule` (`rule_id`),
+                             FOREIGN KEY (`rule_id`) REFERENCES `stub_rule` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='rule response in a sequence or weighted set';
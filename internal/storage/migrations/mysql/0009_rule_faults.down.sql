@@ -0,0 +1,3 @@
+ALTER TABLE `stub_rule`
+    DROP COLUMN `fault_bandwidth`,
+    DROP COLUMN `fault`;
@@ -0,0 +1,3 @@
+ALTER TABLE `stub_rule`
+    ADD COLUMN `fault` varchar(32) NOT NULL DEFAULT '' COMMENT 'connection_reset, empty_response, malformed_body, truncated_body, hang or drip, empty for none' AFTER `delay_time`,
+    ADD COLUMN `fault_bandwidth` int(32) NOT NULL DEFAULT '0' COMMENT 'bytes per second for the drip fault' AFTER `fault`;
@@ -0,0 +1,5 @@
+ALTER TABLE `stub_rule`
+    DROP COLUMN `delay_spec`;
+
+ALTER TABLE `stub_interface`
+    DROP COLUMN `def_delay_spec`;
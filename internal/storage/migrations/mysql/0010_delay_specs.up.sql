@@ -0,0 +1,5 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `def_delay_spec` varchar(512) NOT NULL DEFAULT '' COMMENT 'JSON delay distribution, empty for none' AFTER `def_resp_template`;
+
+ALTER TABLE `stub_rule`
+    ADD COLUMN `delay_spec` varchar(512) NOT NULL DEFAULT '' COMMENT 'JSON delay distribution, overrides delay_time when set' AFTER `delay_time`;
@@ -0,0 +1,2 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `proxy_url` varchar(512) NOT NULL DEFAULT '' COMMENT 'forward requests no rule matches to this upstream instead of the default response' AFTER `def_delay_spec`;
@@ -0,0 +1,5 @@
+ALTER TABLE `stub_rule_condition`
+    MODIFY COLUMN `match_rule` varchar(512) DEFAULT NULL;
+
+ALTER TABLE `stub_rule`
+    MODIFY COLUMN `match_rule` varchar(512) DEFAULT NULL;
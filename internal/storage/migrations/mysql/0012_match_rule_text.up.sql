@@ -0,0 +1,5 @@
+ALTER TABLE `stub_rule`
+    MODIFY COLUMN `match_rule` mediumtext DEFAULT NULL;
+
+ALTER TABLE `stub_rule_condition`
+    MODIFY COLUMN `match_rule` mediumtext DEFAULT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE `stub_rule`
+    DROP COLUMN `delete_time`;
+
+ALTER TABLE `stub_interface`
+    DROP COLUMN `delete_time`;
@@ -0,0 +1,5 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `delete_time` timestamp NULL DEFAULT NULL COMMENT 'when the interface was deleted' AFTER `status`;
+
+ALTER TABLE `stub_rule`
+    ADD COLUMN `delete_time` timestamp NULL DEFAULT NULL COMMENT 'when the rule, or the interface with it, was deleted' AFTER `status`;
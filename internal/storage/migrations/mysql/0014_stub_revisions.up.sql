@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `stub_revision` (
+                             `id` int(32) NOT NULL AUTO_INCREMENT,
+                             `interface_id` int(32) NOT NULL,
+                             `version` int(32) NOT NULL COMMENT 'counts up from 1 per interface',
+                             `action` varchar(32) NOT NULL COMMENT 'create, update, delete, restore, purge, rollback, activate, deactivate or rule_*',
+                             `author` varchar(64) DEFAULT NULL COMMENT 'owner of the interface',
+                             `comment` varchar(256) NOT NULL DEFAULT '',
+                             `snapshot` mediumtext NOT NULL COMMENT 'JSON of the interface with its rules after the change',
+                             `create_time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             PRIMARY KEY (`id`),
+                             UNIQUE KEY `interface_version` (`interface_id`, `version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT='interface revision, kept after the interface is purged';
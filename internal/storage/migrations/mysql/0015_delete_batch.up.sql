@@ -0,0 +1,5 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `delete_batch` bigint NOT NULL DEFAULT 0 COMMENT 'marks the rules deleted with the interface, 0 when not deleted' AFTER `delete_time`;
+
+ALTER TABLE `stub_rule`
+    ADD COLUMN `delete_batch` bigint NOT NULL DEFAULT 0 COMMENT 'delete_batch of the interface the rule was deleted with, 0 otherwise' AFTER `delete_time`;
@@ -0,0 +1,2 @@
+ALTER TABLE `stub_interface`
+    DROP COLUMN `version`;
@@ -0,0 +1,2 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `version` bigint NOT NULL DEFAULT 1 COMMENT 'counts the changes to the interface and its rules' AFTER `status`;
@@ -0,0 +1,2 @@
+ALTER TABLE `stub_interface`
+    ADD COLUMN `source` varchar(512) NOT NULL DEFAULT '' COMMENT 'where the interface is defined: empty for the API, file:<path> for a stub file' AFTER `meta`;
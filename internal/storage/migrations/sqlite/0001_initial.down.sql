@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS stub_rule_update_time;
+DROP TABLE IF EXISTS stub_rule;
+DROP TRIGGER IF EXISTS stub_interface_update_time;
+DROP TABLE IF EXISTS stub_interface;
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS stub_interface (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url VARCHAR(128) NOT NULL,
+    def_resp_code VARCHAR(16) DEFAULT NULL,
+    def_resp_header TEXT DEFAULT NULL,
+    def_resp_body TEXT,
+    owner VARCHAR(64) DEFAULT NULL,
+    description VARCHAR(1024) DEFAULT NULL,
+    meta VARCHAR(1024) DEFAULT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'deleted')),
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS stub_interface_url ON stub_interface (url);
+
+CREATE TRIGGER IF NOT EXISTS stub_interface_update_time AFTER UPDATE ON stub_interface
+BEGIN
+    UPDATE stub_interface SET update_time = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS stub_rule (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    interface_id INTEGER NOT NULL REFERENCES stub_interface (id),
+    match_type INTEGER NOT NULL,
+    match_rule VARCHAR(512) DEFAULT NULL,
+    resp_code VARCHAR(16) DEFAULT NULL,
+    resp_header TEXT DEFAULT NULL,
+    resp_body TEXT,
+    delay_time INTEGER DEFAULT 0,
+    description VARCHAR(1024) DEFAULT NULL,
+    meta VARCHAR(1024) DEFAULT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'deleted')),
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS stub_rule_interface_match_type ON stub_rule (interface_id, match_type);
+
+CREATE TRIGGER IF NOT EXISTS stub_rule_update_time AFTER UPDATE ON stub_rule
+BEGIN
+    UPDATE stub_rule SET update_time = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
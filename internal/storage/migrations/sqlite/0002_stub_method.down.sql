@@ -0,0 +1,4 @@
+DROP INDEX stub_interface_url_method;
+CREATE UNIQUE INDEX stub_interface_url ON stub_interface (url);
+
+ALTER TABLE stub_interface DROP COLUMN method;
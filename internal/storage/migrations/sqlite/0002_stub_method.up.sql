@@ -0,0 +1,4 @@
+ALTER TABLE stub_interface ADD COLUMN method VARCHAR(16) NOT NULL DEFAULT 'ANY';
+
+DROP INDEX stub_interface_url;
+CREATE UNIQUE INDEX stub_interface_url_method ON stub_interface (url, method);
@@ -0,0 +1 @@
+ALTER TABLE stub_interface DROP COLUMN url_type;
@@ -0,0 +1 @@
+ALTER TABLE stub_interface ADD COLUMN url_type VARCHAR(16) NOT NULL DEFAULT 'exact' CHECK (url_type IN ('exact', 'template', 'regex'));
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS stub_rule_condition;
+
+DROP INDEX idx_interface;
+CREATE UNIQUE INDEX stub_rule_interface_match_type ON stub_rule (interface_id, match_type);
+
+ALTER TABLE stub_rule DROP COLUMN logic;
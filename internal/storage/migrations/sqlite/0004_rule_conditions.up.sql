@@ -0,0 +1,16 @@
+-- SQLite cannot change a column default, so match_type stays without one and every
+-- insert sets it
+ALTER TABLE stub_rule ADD COLUMN logic VARCHAR(8) NOT NULL DEFAULT 'and' CHECK (logic IN ('and', 'or'));
+
+DROP INDEX stub_rule_interface_match_type;
+CREATE INDEX idx_interface ON stub_rule (interface_id);
+
+CREATE TABLE IF NOT EXISTS stub_rule_condition (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rule_id INTEGER NOT NULL REFERENCES stub_rule (id),
+    match_type INTEGER NOT NULL,
+    match_rule VARCHAR(512) DEFAULT NULL,
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_condition_rule ON stub_rule_condition (rule_id);
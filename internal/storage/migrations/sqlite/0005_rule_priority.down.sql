@@ -0,0 +1,4 @@
+DROP INDEX idx_interface_priority;
+CREATE INDEX idx_interface ON stub_rule (interface_id);
+
+ALTER TABLE stub_rule DROP COLUMN priority;
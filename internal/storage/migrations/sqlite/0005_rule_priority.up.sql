@@ -0,0 +1,4 @@
+ALTER TABLE stub_rule ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+
+DROP INDEX idx_interface;
+CREATE INDEX idx_interface_priority ON stub_rule (interface_id, priority);
@@ -0,0 +1,2 @@
+ALTER TABLE stub_interface ADD COLUMN def_resp_template INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE stub_rule ADD COLUMN resp_template INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE stub_rule DROP COLUMN new_state;
+ALTER TABLE stub_rule DROP COLUMN required_state;
+ALTER TABLE stub_rule DROP COLUMN scenario;
@@ -0,0 +1,3 @@
+ALTER TABLE stub_rule ADD COLUMN scenario VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE stub_rule ADD COLUMN required_state VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE stub_rule ADD COLUMN new_state VARCHAR(128) NOT NULL DEFAULT '';
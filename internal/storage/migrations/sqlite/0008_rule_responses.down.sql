@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stub_rule_response;
+
+ALTER TABLE stub_rule DROP COLUMN resp_mode;
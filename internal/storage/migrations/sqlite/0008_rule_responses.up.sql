@@ -0,0 +1,13 @@
+ALTER TABLE stub_rule ADD COLUMN resp_mode VARCHAR(16) NOT NULL DEFAULT 'single' CHECK (resp_mode IN ('single', 'cycle', 'last', 'weighted'));
+
+CREATE TABLE IF NOT EXISTS stub_rule_response (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rule_id INTEGER NOT NULL REFERENCES stub_rule (id),
+    resp_code VARCHAR(16) DEFAULT NULL,
+    resp_header TEXT DEFAULT NULL,
+    resp_body TEXT,
+    weight INTEGER NOT NULL DEFAULT 1,
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_response_rule ON stub_rule_response (rule_id);
@@ -0,0 +1,2 @@
+ALTER TABLE stub_rule DROP COLUMN fault_bandwidth;
+ALTER TABLE stub_rule DROP COLUMN fault;
@@ -0,0 +1,2 @@
+ALTER TABLE stub_rule ADD COLUMN fault VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE stub_rule ADD COLUMN fault_bandwidth INTEGER NOT NULL DEFAULT 0;
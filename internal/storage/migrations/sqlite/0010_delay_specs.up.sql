@@ -0,0 +1,2 @@
+ALTER TABLE stub_interface ADD COLUMN def_delay_spec VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE stub_rule ADD COLUMN delay_spec VARCHAR(512) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE stub_interface DROP COLUMN proxy_url;
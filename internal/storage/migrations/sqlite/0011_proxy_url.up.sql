@@ -0,0 +1 @@
+ALTER TABLE stub_interface ADD COLUMN proxy_url VARCHAR(512) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- MySQL widens stub_rule.match_rule and stub_rule_condition.match_rule to mediumtext
+-- here. SQLite does not enforce VARCHAR lengths, so the columns already hold rules of
+-- any length.
+SELECT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE stub_interface ADD COLUMN delete_time TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE stub_rule ADD COLUMN delete_time TIMESTAMP NULL DEFAULT NULL;
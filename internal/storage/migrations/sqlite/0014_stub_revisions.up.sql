@@ -0,0 +1,12 @@
+-- interface_id has no foreign key, since revisions are kept after the interface is purged
+CREATE TABLE IF NOT EXISTS stub_revision (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    interface_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    author VARCHAR(64) DEFAULT NULL,
+    comment VARCHAR(256) NOT NULL DEFAULT '',
+    snapshot TEXT NOT NULL,
+    create_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (interface_id, version)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE stub_rule DROP COLUMN delete_batch;
+ALTER TABLE stub_interface DROP COLUMN delete_batch;
@@ -0,0 +1,2 @@
+ALTER TABLE stub_interface ADD COLUMN delete_batch INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE stub_rule ADD COLUMN delete_batch INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE stub_interface ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1 @@
+ALTER TABLE stub_interface ADD COLUMN source TEXT NOT NULL DEFAULT '';
@@ -8,12 +8,14 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
 	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/urlmatch"
 	"go.uber.org/zap"
 	"time"
 )
 
 type MySQLStorage struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
 }
 
 func NewMySQLStorage(dsn string) (*MySQLStorage, error) {
@@ -33,7 +35,7 @@ func NewMySQLStorage(dsn string) (*MySQLStorage, error) {
 		return nil, err
 	}
 
-	return &MySQLStorage{db: db}, nil
+	return &MySQLStorage{db: db, dialect: mysqlDialect}, nil
 }
 
 func (s *MySQLStorage) Close() error {
@@ -45,18 +47,25 @@ func (s *MySQLStorage) Close() error {
 	return nil
 }
 
-func (s *MySQLStorage) SaveMockUrl(ctx context.Context, url, respCode string, respHeader map[string]string, respBody, owner, description, meta string) (int64, error) {
+func (s *MySQLStorage) SaveMockUrl(ctx context.Context, iface *model.Interface) (int64, error) {
 	start := time.Now()
 
 	// Convert header map to JSON string
-	headerJSON, err := json.Marshal(respHeader)
+	headerJSON, err := json.Marshal(iface.ResponseHeader)
 	if err != nil {
 		logger.Error("Failed to marshal response header",
-			zap.Any("header", respHeader),
+			zap.Any("header", iface.ResponseHeader),
 			zap.Error(err))
 		return 0, fmt.Errorf("failed to marshal response header: %v", err)
 	}
 
+	delaySpecJSON, err := encodeDelaySpec(iface.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to marshal delay spec",
+			zap.Error(err))
+		return 0, err
+	}
+
 	// Start transaction
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -68,45 +77,47 @@ func (s *MySQLStorage) SaveMockUrl(ctx context.Context, url, respCode string, re
 
 	// First, try to get existing ID
 	var existingID int64
-	err = tx.QueryRowContext(ctx, "SELECT id FROM stub_interface WHERE url = ?", url).Scan(&existingID)
+	err = tx.QueryRowContext(ctx, "SELECT id FROM stub_interface WHERE url = ? AND method = ?", iface.URL, iface.Method).Scan(&existingID)
 	if err != nil && err != sql.ErrNoRows {
 		logger.Error("Failed to query existing interface",
-			zap.String("url", url),
+			zap.String("url", iface.URL),
+			zap.String("method", iface.Method),
 			zap.Error(err))
 		return 0, fmt.Errorf("failed to query existing interface: %v", err)
 	}
 
 	query := `INSERT INTO stub_interface (
-        url, def_resp_code, def_resp_header, def_resp_body, 
-        owner, description, meta, status
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-    ON DUPLICATE KEY UPDATE
-        def_resp_code = VALUES(def_resp_code),
-        def_resp_header = VALUES(def_resp_header),
-        def_resp_body = VALUES(def_resp_body),
-        owner = VALUES(owner),
-        description = VALUES(description),
-        meta = VALUES(meta),
-        status = VALUES(status)`
+        url, method, url_type, def_resp_code, def_resp_header, def_resp_body, def_resp_template, def_delay_spec, proxy_url,
+        owner, description, meta, source, status
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    ` + s.dialect.upsert([]string{"url", "method"}, []string{
+		"url_type", "def_resp_code", "def_resp_header", "def_resp_body", "def_resp_template", "def_delay_spec",
+		"proxy_url", "owner", "description", "meta", "source", "status",
+	}, "delete_time = NULL", "delete_batch = 0", "version = version + 1")
 
 	// Insert or update stub_interface
 	result, err := tx.ExecContext(ctx, query,
-		url, respCode, string(headerJSON), respBody,
-		owner, description, meta, model.StatusActive)
+		iface.URL, iface.Method, iface.URLType, iface.ResponseCode, string(headerJSON), iface.ResponseBody, iface.Template, delaySpecJSON, iface.ProxyURL,
+		iface.Owner, iface.Description, iface.Meta, iface.Source, model.StatusActive)
 	if err != nil {
 		logger.Error("Failed to insert stub interface",
 			zap.String("query", query),
-			zap.String("url", url),
-			zap.String("respCode", respCode),
-			zap.String("owner", owner),
+			zap.String("url", iface.URL),
+			zap.String("method", iface.Method),
+			zap.String("respCode", iface.ResponseCode),
+			zap.String("owner", iface.Owner),
 			zap.Error(err))
 		return 0, fmt.Errorf("failed to insert stub interface: %v", err)
 	}
 
-	// Get the ID - use existing ID if it was an update
-	id, err := result.LastInsertId()
-	if err != nil || id == 0 {
-		id = existingID // Use the existing ID if this was an update
+	// Get the ID - use existing ID if it was an update, as not every driver reports it
+	id := existingID
+	if id == 0 {
+		if id, err = result.LastInsertId(); err != nil {
+			logger.Error("Failed to get interface ID",
+				zap.Error(err))
+			return 0, fmt.Errorf("failed to get interface ID: %v", err)
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -117,7 +128,8 @@ func (s *MySQLStorage) SaveMockUrl(ctx context.Context, url, respCode string, re
 
 	logger.Info("Successfully saved mock URL",
 		zap.Int64("id", id),
-		zap.String("url", url),
+		zap.String("url", iface.URL),
+		zap.String("method", iface.Method),
 		zap.Bool("isUpdate", existingID > 0),
 		zap.Duration("duration", time.Since(start)))
 
@@ -127,77 +139,220 @@ func (s *MySQLStorage) SaveMockUrl(ctx context.Context, url, respCode string, re
 func (s *MySQLStorage) SaveRule(ctx context.Context, interfaceID int64, rule *model.Rule) error {
 	start := time.Now()
 
+	logger.Debug("SaveRule",
+		zap.Int64("interfaceID", interfaceID),
+		zap.Int32("matchType", rule.MatchType),
+		zap.Int("conditions", len(rule.Conditions)))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	ruleID, err := insertRule(ctx, tx, interfaceID, rule)
+	if err != nil {
+		return err
+	}
+	if err := touchInterface(ctx, tx, interfaceID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+	rule.ID = ruleID
+
+	logger.Info("Successfully saved rule",
+		zap.Int64("interfaceID", interfaceID),
+		zap.Int64("ruleID", ruleID),
+		zap.Int32("matchType", rule.MatchType),
+		zap.Int("conditions", len(rule.Conditions)),
+		zap.Int("responses", len(rule.Responses)),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// insertRule inserts an active rule of an interface with its conditions and responses
+// and returns its ID
+func insertRule(ctx context.Context, tx *sql.Tx, interfaceID int64, rule *model.Rule) (int64, error) {
 	headerJSON, err := json.Marshal(rule.ResponseHeader)
 	if err != nil {
 		logger.Error("Failed to marshal rule response header",
 			zap.Any("header", rule.ResponseHeader),
 			zap.Error(err))
-		return fmt.Errorf("failed to marshal rule response header: %v", err)
+		return 0, fmt.Errorf("failed to marshal rule response header: %v", err)
 	}
 
-	logger.Debug("SaveRule",
-		zap.Int64("interfaceID", interfaceID),
-		zap.Int32("matchType", rule.MatchType),
-		zap.Error(err))
+	delaySpecJSON, err := encodeDelaySpec(rule.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to marshal rule delay spec",
+			zap.Error(err))
+		return 0, err
+	}
 
-	// SaveRule query
 	query := `INSERT INTO stub_rule (
-    interface_id, match_type, match_rule, 
-    resp_code, resp_header, resp_body,
-    delay_time, description, meta, status
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-ON DUPLICATE KEY UPDATE
-    match_rule = VALUES(match_rule),
-    resp_code = VALUES(resp_code),
-    resp_header = VALUES(resp_header),
-    resp_body = VALUES(resp_body),
-    delay_time = VALUES(delay_time),
-    description = VALUES(description),
-    meta = VALUES(meta),
-    status = VALUES(status)`
-
-	_, err = s.db.ExecContext(ctx, query,
-		interfaceID, rule.MatchType, rule.MatchRule,
-		rule.ResponseCode, string(headerJSON), rule.ResponseBody,
-		rule.DelayTime, rule.Description, rule.Meta, model.StatusActive)
+    interface_id, match_type, match_rule, logic, priority,
+    resp_code, resp_header, resp_body, resp_template, resp_mode,
+    delay_time, delay_spec, fault, fault_bandwidth, scenario, required_state, new_state, description, meta, status
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
+	result, err := tx.ExecContext(ctx, query,
+		interfaceID, rule.MatchType, rule.MatchRule, rule.Logic, rule.Priority,
+		rule.ResponseCode, string(headerJSON), rule.ResponseBody, rule.Template, rule.ResponseMode,
+		rule.DelayTime, delaySpecJSON, rule.Fault, rule.FaultBandwidth, rule.Scenario, rule.RequiredState, rule.NewState, rule.Description, rule.Meta, model.StatusActive)
 	if err != nil {
 		logger.Error("Failed to insert rule",
 			zap.String("query", query),
 			zap.Int64("interfaceID", interfaceID),
 			zap.Int32("matchType", rule.MatchType),
 			zap.Error(err))
-		return fmt.Errorf("failed to insert rule: %v", err)
+		return 0, fmt.Errorf("failed to insert rule: %v", err)
 	}
 
-	logger.Info("Successfully saved rule",
+	ruleID, err := result.LastInsertId()
+	if err != nil {
+		logger.Error("Failed to get rule ID",
+			zap.Error(err))
+		return 0, fmt.Errorf("failed to get rule ID: %v", err)
+	}
+
+	if err := insertRuleChildren(ctx, tx, ruleID, rule); err != nil {
+		return 0, err
+	}
+	return ruleID, nil
+}
+
+// insertRuleChildren inserts the conditions and responses of a rule
+func insertRuleChildren(ctx context.Context, tx *sql.Tx, ruleID int64, rule *model.Rule) error {
+	conditionQuery := `INSERT INTO stub_rule_condition (rule_id, match_type, match_rule) VALUES (?, ?, ?)`
+	for i, cond := range rule.Conditions {
+		if _, err := tx.ExecContext(ctx, conditionQuery, ruleID, cond.MatchType, cond.MatchRule); err != nil {
+			logger.Error("Failed to insert rule condition",
+				zap.String("query", conditionQuery),
+				zap.Int64("ruleID", ruleID),
+				zap.Int("conditionIndex", i),
+				zap.Error(err))
+			return fmt.Errorf("failed to insert rule condition: %v", err)
+		}
+	}
+
+	responseQuery := `INSERT INTO stub_rule_response (rule_id, resp_code, resp_header, resp_body, weight) VALUES (?, ?, ?, ?, ?)`
+	for i, resp := range rule.Responses {
+		respHeaderJSON, err := json.Marshal(resp.ResponseHeader)
+		if err != nil {
+			logger.Error("Failed to marshal rule response header",
+				zap.Int("responseIndex", i),
+				zap.Error(err))
+			return fmt.Errorf("failed to marshal rule response header: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, responseQuery, ruleID, resp.ResponseCode, string(respHeaderJSON), resp.ResponseBody, resp.Weight); err != nil {
+			logger.Error("Failed to insert rule response",
+				zap.String("query", responseQuery),
+				zap.Int64("ruleID", ruleID),
+				zap.Int("responseIndex", i),
+				zap.Error(err))
+			return fmt.Errorf("failed to insert rule response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteRules removes every rule of an interface for good, together with their conditions
+// and responses.
+func (s *MySQLStorage) DeleteRules(ctx context.Context, interfaceID int64) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	conditionQuery := `DELETE FROM stub_rule_condition WHERE rule_id IN (SELECT id FROM stub_rule WHERE interface_id = ?)`
+	if _, err := tx.ExecContext(ctx, conditionQuery, interfaceID); err != nil {
+		logger.Error("Failed to delete rule conditions",
+			zap.String("query", conditionQuery),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Error(err))
+		return fmt.Errorf("failed to delete rule conditions: %v", err)
+	}
+
+	responseQuery := `DELETE FROM stub_rule_response WHERE rule_id IN (SELECT id FROM stub_rule WHERE interface_id = ?)`
+	if _, err := tx.ExecContext(ctx, responseQuery, interfaceID); err != nil {
+		logger.Error("Failed to delete rule responses",
+			zap.String("query", responseQuery),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Error(err))
+		return fmt.Errorf("failed to delete rule responses: %v", err)
+	}
+
+	ruleQuery := `DELETE FROM stub_rule WHERE interface_id = ?`
+	result, err := tx.ExecContext(ctx, ruleQuery, interfaceID)
+	if err != nil {
+		logger.Error("Failed to delete rules",
+			zap.String("query", ruleQuery),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Error(err))
+		return fmt.Errorf("failed to delete rules: %v", err)
+	}
+	if err := touchInterface(ctx, tx, interfaceID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	logger.Info("Successfully deleted rules",
 		zap.Int64("interfaceID", interfaceID),
-		zap.Int32("matchType", rule.MatchType),
+		zap.Int64("count", rowsAffected),
 		zap.Duration("duration", time.Since(start)))
 
 	return nil
 }
 
-func (s *MySQLStorage) GetMockResponse(ctx context.Context, url string) (*model.MockResponse, error) {
+// GetMockResponse looks up the active interface for a request. Exact URLs are tried first,
+// then URL templates and regexes in the precedence order defined by urlmatch.Compare.
+// Within the same URL, a stub registered for the exact method takes precedence over one
+// registered for ANY method.
+func (s *MySQLStorage) GetMockResponse(ctx context.Context, method, url string) (*model.MockResponse, error) {
 	start := time.Now()
 
 	var resp model.MockResponse
-	var headerJSON string
+	var headerJSON, delaySpecJSON string
 
-	query := `SELECT id, def_resp_code, def_resp_header, def_resp_body 
+	query := `SELECT id, def_resp_code, def_resp_header, def_resp_body, def_resp_template, def_delay_spec, proxy_url 
 		FROM stub_interface 
-		WHERE url = ? AND status = ?`
+		WHERE url = ? AND url_type = ? AND method IN (?, ?) AND status = ?
+		ORDER BY method = ? LIMIT 1`
 
 	err := s.db.QueryRowContext(ctx, query,
-		url, model.StatusActive).Scan(&resp.InterfaceID, &resp.ResponseCode, &headerJSON, &resp.ResponseBody)
+		url, model.URLTypeExact, method, model.MethodAny, model.StatusActive, model.MethodAny).Scan(&resp.InterfaceID, &resp.ResponseCode, &headerJSON, &resp.ResponseBody, &resp.Template, &delaySpecJSON, &resp.ProxyURL)
+	if err == sql.ErrNoRows {
+		err = s.findPatternMockResponse(ctx, method, url, &resp, &headerJSON, &delaySpecJSON)
+	}
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Debug("No mock response found",
+				zap.String("method", method),
 				zap.String("url", url))
 		} else {
 			logger.Error("Failed to get mock response",
 				zap.String("query", query),
+				zap.String("method", method),
 				zap.String("url", url),
 				zap.Error(err))
 		}
@@ -213,41 +368,161 @@ func (s *MySQLStorage) GetMockResponse(ctx context.Context, url string) (*model.
 			return nil, fmt.Errorf("failed to unmarshal header JSON: %v", err)
 		}
 	}
+	if resp.DelaySpec, err = decodeDelaySpec(delaySpecJSON); err != nil {
+		logger.Error("Failed to unmarshal delay spec",
+			zap.String("delaySpec", delaySpecJSON),
+			zap.Error(err))
+		return nil, err
+	}
 
 	logger.Debug("Successfully retrieved mock response",
+		zap.String("method", method),
 		zap.String("url", url),
 		zap.Int64("interfaceID", resp.InterfaceID),
+		zap.Any("pathParams", resp.PathParams),
 		zap.Duration("duration", time.Since(start)))
 
 	return &resp, nil
 }
 
+// findPatternMockResponse matches the request path against every active template and
+// regex interface and fills resp with the one that takes precedence. It returns
+// sql.ErrNoRows when none matches.
+func (s *MySQLStorage) findPatternMockResponse(ctx context.Context, method, url string, resp *model.MockResponse, headerJSON, delaySpecJSON *string) error {
+	query := `SELECT id, url, url_type, method, def_resp_code, def_resp_header, def_resp_body, def_resp_template, def_delay_spec, proxy_url 
+		FROM stub_interface 
+		WHERE url_type <> ? AND method IN (?, ?) AND status = ?
+		ORDER BY id ASC`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		model.URLTypeExact, method, model.MethodAny, model.StatusActive)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var best *urlmatch.Pattern
+	var bestMethod string
+	for rows.Next() {
+		var candidate model.MockResponse
+		var pattern, urlType, candidateMethod, candidateHeader, candidateDelaySpec string
+		if err := rows.Scan(&candidate.InterfaceID, &pattern, &urlType, &candidateMethod,
+			&candidate.ResponseCode, &candidateHeader, &candidate.ResponseBody, &candidate.Template, &candidateDelaySpec, &candidate.ProxyURL); err != nil {
+			return err
+		}
+
+		p, err := CompilePattern(urlType, pattern)
+		if err != nil {
+			logger.Warn("Skipping interface with invalid URL pattern",
+				zap.Int64("interfaceID", candidate.InterfaceID),
+				zap.String("url", pattern),
+				zap.Error(err))
+			continue
+		}
+
+		params, ok := p.Match(url)
+		if !ok {
+			continue
+		}
+
+		if best != nil {
+			cmp := p.Compare(best)
+			if cmp > 0 || (cmp == 0 && (candidateMethod == model.MethodAny || bestMethod != model.MethodAny)) {
+				continue
+			}
+		}
+
+		candidate.PathParams = params
+		*resp = candidate
+		*headerJSON = candidateHeader
+		*delaySpecJSON = candidateDelaySpec
+		best = p
+		bestMethod = candidateMethod
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if best == nil {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (s *MySQLStorage) GetRules(ctx context.Context, interfaceID int64) ([]model.Rule, error) {
 	start := time.Now()
 
-	query := `SELECT match_type, match_rule, resp_code, resp_header, resp_body, delay_time, description, meta 
-		FROM stub_rule 
-		WHERE interface_id = ? AND status = ?`
+	rules, err := s.queryRules(ctx, "r.interface_id = ?", interfaceID)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := s.db.QueryContext(ctx, query,
-		interfaceID, model.StatusActive)
+	logger.Debug("Successfully retrieved rules",
+		zap.Int64("interfaceID", interfaceID),
+		zap.Int("count", len(rules[interfaceID])),
+		zap.Duration("duration", time.Since(start)))
+
+	return rules[interfaceID], nil
+}
+
+// GetActiveMockUrls returns every active interface with its default response, and the
+// active rules of each in evaluation order keyed by interface ID. It takes the same few
+// queries however many interfaces there are.
+func (s *MySQLStorage) GetActiveMockUrls(ctx context.Context) ([]*model.Interface, map[int64][]model.Rule, error) {
+	start := time.Now()
+
+	interfaces, err := s.queryInterfaces(ctx, "status = ?", model.StatusActive)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, err := s.queryRules(ctx, "r.interface_id IN (SELECT id FROM stub_interface WHERE status = ?)", model.StatusActive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Debug("Successfully retrieved active mock URLs",
+		zap.Int("count", len(interfaces)),
+		zap.Duration("duration", time.Since(start)))
+
+	return interfaces, rules, nil
+}
+
+// queryRules loads the active rules of the interfaces selected by filter, a condition on
+// the stub_rule table aliased r, in evaluation order keyed by interface ID
+func (s *MySQLStorage) queryRules(ctx context.Context, filter string, args ...interface{}) (map[int64][]model.Rule, error) {
+	query := `SELECT r.interface_id, r.id, r.priority, r.match_type, r.match_rule, r.logic, r.resp_code, r.resp_header, r.resp_body, r.resp_template, r.resp_mode, r.delay_time, r.delay_spec, r.fault, r.fault_bandwidth, r.scenario, r.required_state, r.new_state, r.description, r.meta 
+		FROM stub_rule r 
+		WHERE ` + filter + ` AND r.status = ?
+		ORDER BY r.interface_id ASC, r.priority ASC, r.id ASC`
+
+	conditions, err := s.getConditions(ctx, filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := s.getResponses(ctx, filter, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, append(args, model.StatusActive)...)
 	if err != nil {
 		logger.Error("Failed to query rules",
 			zap.String("query", query),
-			zap.Int64("interfaceID", interfaceID),
 			zap.Error(err))
 		return nil, err
 	}
 	defer rows.Close()
 
-	var rules []model.Rule
+	rules := make(map[int64][]model.Rule)
 	for rows.Next() {
+		var interfaceID int64
 		var rule model.Rule
-		var headerJSON string
+		var headerJSON, delaySpecJSON string
 		if err := rows.Scan(
-			&rule.MatchType, &rule.MatchRule, &rule.ResponseCode,
-			&headerJSON, &rule.ResponseBody, &rule.DelayTime,
-			&rule.Description, &rule.Meta,
+			&interfaceID, &rule.ID, &rule.Priority, &rule.MatchType, &rule.MatchRule, &rule.Logic, &rule.ResponseCode,
+			&headerJSON, &rule.ResponseBody, &rule.Template, &rule.ResponseMode, &rule.DelayTime,
+			&delaySpecJSON, &rule.Fault, &rule.FaultBandwidth,
+			&rule.Scenario, &rule.RequiredState, &rule.NewState, &rule.Description, &rule.Meta,
 		); err != nil {
 			logger.Error("Failed to scan rule row",
 				zap.Error(err))
@@ -263,8 +538,16 @@ func (s *MySQLStorage) GetRules(ctx context.Context, interfaceID int64) ([]model
 				return nil, fmt.Errorf("failed to unmarshal rule header JSON: %v", err)
 			}
 		}
+		if rule.DelaySpec, err = decodeDelaySpec(delaySpecJSON); err != nil {
+			logger.Error("Failed to unmarshal rule delay spec",
+				zap.String("delaySpec", delaySpecJSON),
+				zap.Error(err))
+			return nil, err
+		}
+		rule.Conditions = conditions[rule.ID]
+		rule.Responses = responses[rule.ID]
 
-		rules = append(rules, rule)
+		rules[interfaceID] = append(rules[interfaceID], rule)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -273,104 +556,292 @@ func (s *MySQLStorage) GetRules(ctx context.Context, interfaceID int64) ([]model
 		return nil, err
 	}
 
-	logger.Debug("Successfully retrieved rules",
-		zap.Int64("interfaceID", interfaceID),
-		zap.Int("count", len(rules)),
-		zap.Duration("duration", time.Since(start)))
-
 	return rules, nil
 }
 
-func (s *MySQLStorage) GetAllMockUrls(ctx context.Context, keyword string, owner string, page, pageSize int) ([]*model.Interface, int, error) {
-	start := time.Now()
-
-	// Calculate offset
-	offset := (page - 1) * pageSize
-
-	// Base query
-	baseQuery := `SELECT 
-        id, url, def_resp_code, def_resp_header, def_resp_body, 
-        owner, description, meta
-    FROM stub_interface 
-    WHERE status = ?`
-	countQuery := `SELECT COUNT(*) FROM stub_interface WHERE status = ?`
-
-	args := []interface{}{model.StatusActive}
+// getConditions loads the conditions of the rules selected by filter, a condition on the
+// stub_rule table aliased r, keyed by rule ID
+func (s *MySQLStorage) getConditions(ctx context.Context, filter string, args ...interface{}) (map[int64][]model.Condition, error) {
+	query := `SELECT c.rule_id, c.match_type, c.match_rule
+		FROM stub_rule_condition c
+		JOIN stub_rule r ON r.id = c.rule_id
+		WHERE ` + filter + `
+		ORDER BY c.id ASC`
 
-	// Add keyword filter if provided
-	if keyword != "" {
-		baseQuery += " AND url LIKE ?"
-		countQuery += " AND url LIKE ?"
-		args = append(args, "%"+keyword+"%")
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("Failed to query rule conditions",
+			zap.String("query", query),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query rule conditions: %v", err)
 	}
+	defer rows.Close()
 
-	// Add owner filter if provided
-	if owner != "" {
-		baseQuery += " AND owner = ?"
-		countQuery += " AND owner = ?"
-		args = append(args, owner)
+	conditions := make(map[int64][]model.Condition)
+	for rows.Next() {
+		var ruleID int64
+		var cond model.Condition
+		if err := rows.Scan(&ruleID, &cond.MatchType, &cond.MatchRule); err != nil {
+			logger.Error("Failed to scan rule condition row",
+				zap.Error(err))
+			return nil, fmt.Errorf("failed to scan rule condition row: %v", err)
+		}
+		conditions[ruleID] = append(conditions[ruleID], cond)
 	}
 
-	// Add pagination
-	baseQuery += " ORDER BY id DESC LIMIT ? OFFSET ?"
-	args = append(args, pageSize, offset)
-
-	// Get total count
-	var total int
-	err := s.db.QueryRowContext(ctx, countQuery, args[:len(args)-2]...).Scan(&total)
-	if err != nil {
-		logger.Error("Failed to get total count",
-			zap.String("query", countQuery),
+	if err := rows.Err(); err != nil {
+		logger.Error("Error after iterating rule condition rows",
 			zap.Error(err))
-		return nil, 0, fmt.Errorf("failed to get total count: %v", err)
+		return nil, err
 	}
 
-	// Execute main query
-	rows, err := s.db.QueryContext(ctx, baseQuery, args...)
+	return conditions, nil
+}
+
+// getResponses loads the response sequences of the rules selected by filter, a condition
+// on the stub_rule table aliased r, keyed by rule ID
+func (s *MySQLStorage) getResponses(ctx context.Context, filter string, args ...interface{}) (map[int64][]model.RuleResponse, error) {
+	query := `SELECT p.rule_id, p.resp_code, p.resp_header, p.resp_body, p.weight
+		FROM stub_rule_response p
+		JOIN stub_rule r ON r.id = p.rule_id
+		WHERE ` + filter + `
+		ORDER BY p.id ASC`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		logger.Error("Failed to query mock URLs",
-			zap.String("query", baseQuery),
+		logger.Error("Failed to query rule responses",
+			zap.String("query", query),
 			zap.Error(err))
-		return nil, 0, fmt.Errorf("failed to query mock URLs: %v", err)
+		return nil, fmt.Errorf("failed to query rule responses: %v", err)
 	}
 	defer rows.Close()
 
-	var interfaces []*model.Interface
+	responses := make(map[int64][]model.RuleResponse)
 	for rows.Next() {
-		var iface model.Interface
+		var ruleID int64
+		var resp model.RuleResponse
 		var headerJSON string
-
-		err := rows.Scan(
-			&iface.ID,
-			&iface.URL,
-			&iface.ResponseCode,
-			&headerJSON,
-			&iface.ResponseBody,
-			&iface.Owner,
-			&iface.Description,
-			&iface.Meta,
-		)
-		if err != nil {
-			logger.Error("Failed to scan mock URL row",
+		if err := rows.Scan(&ruleID, &resp.ResponseCode, &headerJSON, &resp.ResponseBody, &resp.Weight); err != nil {
+			logger.Error("Failed to scan rule response row",
 				zap.Error(err))
-			return nil, 0, fmt.Errorf("failed to scan mock URL row: %v", err)
+			return nil, fmt.Errorf("failed to scan rule response row: %v", err)
 		}
-
-		// Parse header JSON
 		if headerJSON != "" {
-			if err := json.Unmarshal([]byte(headerJSON), &iface.ResponseHeader); err != nil {
-				logger.Error("Failed to unmarshal response header",
+			if err := json.Unmarshal([]byte(headerJSON), &resp.ResponseHeader); err != nil {
+				logger.Error("Failed to unmarshal rule response header",
 					zap.String("header", headerJSON),
 					zap.Error(err))
-				return nil, 0, fmt.Errorf("failed to unmarshal response header: %v", err)
+				return nil, fmt.Errorf("failed to unmarshal rule response header: %v", err)
 			}
 		}
+		responses[ruleID] = append(responses[ruleID], resp)
+	}
 
-		interfaces = append(interfaces, &iface)
+	if err := rows.Err(); err != nil {
+		logger.Error("Error after iterating rule response rows",
+			zap.Error(err))
+		return nil, err
 	}
 
-	logger.Info("Successfully retrieved mock URLs",
-		zap.Int("count", len(interfaces)),
+	return responses, nil
+}
+
+// ReorderRules sets the priority of an interface's rules to their position in ruleIDs,
+// which must list every rule of the interface exactly once, or ErrInvalidReorder is
+// returned
+func (s *MySQLStorage) ReorderRules(ctx context.Context, interfaceID int64, ruleIDs []int64) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id FROM stub_rule WHERE interface_id = ? AND status <> ?` + s.dialect.forUpdate
+	rows, err := tx.QueryContext(ctx, query, interfaceID, model.StatusDeleted)
+	if err != nil {
+		logger.Error("Failed to query rules",
+			zap.String("query", query),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Error(err))
+		return fmt.Errorf("failed to query rules: %v", err)
+	}
+
+	existing := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan rule row: %v", err)
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(ruleIDs) != len(existing) {
+		return fmt.Errorf("%w: rule_ids must list all %d rules of interface %d", ErrInvalidReorder, len(existing), interfaceID)
+	}
+	seen := make(map[int64]bool, len(ruleIDs))
+	for _, id := range ruleIDs {
+		if !existing[id] {
+			return fmt.Errorf("%w: rule %d does not belong to interface %d", ErrInvalidReorder, id, interfaceID)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: rule %d is listed more than once", ErrInvalidReorder, id)
+		}
+		seen[id] = true
+	}
+
+	updateQuery := `UPDATE stub_rule SET priority = ? WHERE id = ?`
+	for i, id := range ruleIDs {
+		if _, err := tx.ExecContext(ctx, updateQuery, i+1, id); err != nil {
+			logger.Error("Failed to update rule priority",
+				zap.String("query", updateQuery),
+				zap.Int64("ruleID", id),
+				zap.Error(err))
+			return fmt.Errorf("failed to update rule priority: %v", err)
+		}
+	}
+	if err := touchInterface(ctx, tx, interfaceID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	logger.Info("Successfully reordered rules",
+		zap.Int64("interfaceID", interfaceID),
+		zap.Int64s("ruleIDs", ruleIDs),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// GetAllMockUrls lists interfaces with the given status, or every interface that has not
+// been deleted when status is model.StatusFilterAll
+func (s *MySQLStorage) GetAllMockUrls(ctx context.Context, keyword string, owner string, status string, page, pageSize int) ([]*model.Interface, int, error) {
+	start := time.Now()
+
+	// Calculate offset
+	offset := (page - 1) * pageSize
+
+	statusCond := "status = ?"
+	args := []interface{}{status}
+	if status == model.StatusFilterAll {
+		statusCond = "status <> ?"
+		args = []interface{}{model.StatusDeleted}
+	}
+
+	// Base query
+	baseQuery := `SELECT 
+        id, url, method, url_type, def_resp_code, def_resp_header, def_resp_body, def_resp_template, def_delay_spec, proxy_url,
+        owner, description, meta, source, status, version, COALESCE(` + s.dialect.unixTime("delete_time") + `, 0)
+    FROM stub_interface 
+    WHERE ` + statusCond
+	countQuery := `SELECT COUNT(*) FROM stub_interface WHERE ` + statusCond
+
+	// Add keyword filter if provided
+	if keyword != "" {
+		baseQuery += " AND url LIKE ?"
+		countQuery += " AND url LIKE ?"
+		args = append(args, "%"+keyword+"%")
+	}
+
+	// Add owner filter if provided
+	if owner != "" {
+		baseQuery += " AND owner = ?"
+		countQuery += " AND owner = ?"
+		args = append(args, owner)
+	}
+
+	// Add pagination
+	baseQuery += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, pageSize, offset)
+
+	// Get total count
+	var total int
+	err := s.db.QueryRowContext(ctx, countQuery, args[:len(args)-2]...).Scan(&total)
+	if err != nil {
+		logger.Error("Failed to get total count",
+			zap.String("query", countQuery),
+			zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to get total count: %v", err)
+	}
+
+	// Execute main query
+	rows, err := s.db.QueryContext(ctx, baseQuery, args...)
+	if err != nil {
+		logger.Error("Failed to query mock URLs",
+			zap.String("query", baseQuery),
+			zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to query mock URLs: %v", err)
+	}
+	defer rows.Close()
+
+	var interfaces []*model.Interface
+	for rows.Next() {
+		var iface model.Interface
+		var headerJSON, delaySpecJSON string
+		var deleteTime int64
+
+		err := rows.Scan(
+			&iface.ID,
+			&iface.URL,
+			&iface.Method,
+			&iface.URLType,
+			&iface.ResponseCode,
+			&headerJSON,
+			&iface.ResponseBody,
+			&iface.Template,
+			&delaySpecJSON,
+			&iface.ProxyURL,
+			&iface.Owner,
+			&iface.Description,
+			&iface.Meta,
+			&iface.Source,
+			&iface.Status,
+			&iface.Version,
+			&deleteTime,
+		)
+		if err != nil {
+			logger.Error("Failed to scan mock URL row",
+				zap.Error(err))
+			return nil, 0, fmt.Errorf("failed to scan mock URL row: %v", err)
+		}
+
+		// Parse header JSON
+		if headerJSON != "" {
+			if err := json.Unmarshal([]byte(headerJSON), &iface.ResponseHeader); err != nil {
+				logger.Error("Failed to unmarshal response header",
+					zap.String("header", headerJSON),
+					zap.Error(err))
+				return nil, 0, fmt.Errorf("failed to unmarshal response header: %v", err)
+			}
+		}
+		if iface.DelaySpec, err = decodeDelaySpec(delaySpecJSON); err != nil {
+			logger.Error("Failed to unmarshal delay spec",
+				zap.String("delaySpec", delaySpecJSON),
+				zap.Error(err))
+			return nil, 0, err
+		}
+		if deleteTime > 0 {
+			iface.DeletedAt = time.Unix(deleteTime, 0)
+		}
+
+		interfaces = append(interfaces, &iface)
+	}
+
+	logger.Info("Successfully retrieved mock URLs",
+		zap.Int("count", len(interfaces)),
 		zap.Int("total", total),
 		zap.Int("page", page),
 		zap.Int("pageSize", pageSize),
@@ -380,14 +851,27 @@ func (s *MySQLStorage) GetAllMockUrls(ctx context.Context, keyword string, owner
 }
 
 func (s *MySQLStorage) GetMockUrl(ctx context.Context, urlId int64) ([]*model.Interface, error) {
+	interfaces, err := s.queryInterfaces(ctx, "status <> ? AND id = ?", model.StatusDeleted, urlId)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Successfully retrieved mock URLs",
+		zap.Int("count", len(interfaces)))
+
+	return interfaces, nil
+}
+
+// queryInterfaces loads the interfaces selected by filter, a condition on stub_interface,
+// in ID order
+func (s *MySQLStorage) queryInterfaces(ctx context.Context, filter string, args ...interface{}) ([]*model.Interface, error) {
 	// Base query
 	baseQuery := `SELECT 
-        id, url, def_resp_code, def_resp_header, def_resp_body, 
-        owner, description, meta
+        id, url, method, url_type, def_resp_code, def_resp_header, def_resp_body, def_resp_template, def_delay_spec, proxy_url,
+        owner, description, meta, source, status, version, COALESCE(` + s.dialect.unixTime("delete_time") + `, 0)
     FROM stub_interface 
-    WHERE status = ? AND id = ?`
-
-	args := []interface{}{model.StatusActive, urlId}
+    WHERE ` + filter + `
+    ORDER BY id ASC`
 
 	// Execute main query
 	rows, err := s.db.QueryContext(ctx, baseQuery, args...)
@@ -402,17 +886,27 @@ func (s *MySQLStorage) GetMockUrl(ctx context.Context, urlId int64) ([]*model.In
 	var interfaces []*model.Interface
 	for rows.Next() {
 		var iface model.Interface
-		var headerJSON string
+		var headerJSON, delaySpecJSON string
+		var deleteTime int64
 
 		err := rows.Scan(
 			&iface.ID,
 			&iface.URL,
+			&iface.Method,
+			&iface.URLType,
 			&iface.ResponseCode,
 			&headerJSON,
 			&iface.ResponseBody,
+			&iface.Template,
+			&delaySpecJSON,
+			&iface.ProxyURL,
 			&iface.Owner,
 			&iface.Description,
 			&iface.Meta,
+			&iface.Source,
+			&iface.Status,
+			&iface.Version,
+			&deleteTime,
 		)
 		if err != nil {
 			logger.Error("Failed to scan mock URL row",
@@ -429,28 +923,42 @@ func (s *MySQLStorage) GetMockUrl(ctx context.Context, urlId int64) ([]*model.In
 				return nil, fmt.Errorf("failed to unmarshal response header: %v", err)
 			}
 		}
+		if iface.DelaySpec, err = decodeDelaySpec(delaySpecJSON); err != nil {
+			logger.Error("Failed to unmarshal delay spec",
+				zap.String("delaySpec", delaySpecJSON),
+				zap.Error(err))
+			return nil, err
+		}
+		if deleteTime > 0 {
+			iface.DeletedAt = time.Unix(deleteTime, 0)
+		}
 
 		interfaces = append(interfaces, &iface)
 	}
-
-	logger.Info("Successfully retrieved mock URLs",
-		zap.Int("count", len(interfaces)))
-
-	return interfaces, nil
+	return interfaces, rows.Err()
 }
 
 func (s *MySQLStorage) GetRulesByInterfaceID(ctx context.Context, interfaceID int64) ([]*model.Rule, error) {
 	start := time.Now()
 
 	query := `SELECT 
-        match_type, match_rule, 
-        resp_code, resp_header, resp_body,
-        delay_time, description, meta
+        id, priority, match_type, match_rule, logic,
+        resp_code, resp_header, resp_body, resp_template, resp_mode,
+        delay_time, delay_spec, fault, fault_bandwidth, scenario, required_state, new_state, description, meta, status
     FROM stub_rule 
-    WHERE interface_id = ? AND status = ?
-    ORDER BY id ASC`
+    WHERE interface_id = ? AND status <> ?
+    ORDER BY priority ASC, id ASC`
+
+	conditions, err := s.getConditions(ctx, "r.interface_id = ?", interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := s.getResponses(ctx, "r.interface_id = ?", interfaceID)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := s.db.QueryContext(ctx, query, interfaceID, model.StatusActive)
+	rows, err := s.db.QueryContext(ctx, query, interfaceID, model.StatusDeleted)
 	if err != nil {
 		logger.Error("Failed to query rules",
 			zap.String("query", query),
@@ -463,19 +971,29 @@ func (s *MySQLStorage) GetRulesByInterfaceID(ctx context.Context, interfaceID in
 	var rules []*model.Rule
 	for rows.Next() {
 		var rule model.Rule
-		var headerJSON string
+		var headerJSON, delaySpecJSON string
 
 		err := rows.Scan(
-			//&rule.ID,
-			//&rule.interfaceID,
+			&rule.ID,
+			&rule.Priority,
 			&rule.MatchType,
 			&rule.MatchRule,
+			&rule.Logic,
 			&rule.ResponseCode,
 			&headerJSON,
 			&rule.ResponseBody,
+			&rule.Template,
+			&rule.ResponseMode,
 			&rule.DelayTime,
+			&delaySpecJSON,
+			&rule.Fault,
+			&rule.FaultBandwidth,
+			&rule.Scenario,
+			&rule.RequiredState,
+			&rule.NewState,
 			&rule.Description,
 			&rule.Meta,
+			&rule.Status,
 		)
 		if err != nil {
 			logger.Error("Failed to scan rule row",
@@ -492,10 +1010,24 @@ func (s *MySQLStorage) GetRulesByInterfaceID(ctx context.Context, interfaceID in
 				return nil, fmt.Errorf("failed to unmarshal rule response header: %v", err)
 			}
 		}
+		if rule.DelaySpec, err = decodeDelaySpec(delaySpecJSON); err != nil {
+			logger.Error("Failed to unmarshal rule delay spec",
+				zap.String("delaySpec", delaySpecJSON),
+				zap.Error(err))
+			return nil, err
+		}
+		rule.Conditions = conditions[rule.ID]
+		rule.Responses = responses[rule.ID]
 
 		rules = append(rules, &rule)
 	}
 
+	if err := rows.Err(); err != nil {
+		logger.Error("Error after iterating rules rows",
+			zap.Error(err))
+		return nil, err
+	}
+
 	logger.Info("Successfully retrieved rules",
 		zap.Int64("interfaceID", interfaceID),
 		zap.Int("count", len(rules)),
@@ -504,12 +1036,26 @@ func (s *MySQLStorage) GetRulesByInterfaceID(ctx context.Context, interfaceID in
 	return rules, nil
 }
 
+// DeleteMockUrl marks an interface as deleted together with its active rules, which
+// come back when the interface is restored. The interface and those rules share a delete
+// batch that tells them apart from rules deleted on their own. It returns sql.ErrNoRows
+// when no interface that has not been deleted has the ID.
 func (s *MySQLStorage) DeleteMockUrl(ctx context.Context, id int64) error {
 	start := time.Now()
+	batch := start.UnixNano()
 
-	query := `UPDATE stub_interface SET status = ? WHERE id = ?`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE stub_interface SET status = ?, delete_time = CURRENT_TIMESTAMP, delete_batch = ?, version = version + 1
+		WHERE id = ? AND status <> ?`
 
-	result, err := s.db.ExecContext(ctx, query, model.StatusDeleted, id)
+	result, err := tx.ExecContext(ctx, query, model.StatusDeleted, batch, id, model.StatusDeleted)
 	if err != nil {
 		logger.Error("Failed to delete stub interface",
 			zap.String("query", query),
@@ -526,14 +1072,813 @@ func (s *MySQLStorage) DeleteMockUrl(ctx context.Context, id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		logger.Warn("No stub interface found with the given ID",
-			zap.Int64("id", id))
-		return fmt.Errorf("no stub interface found with ID %d", id)
+		return sql.ErrNoRows
+	}
+
+	ruleQuery := `UPDATE stub_rule SET status = ?, delete_time = CURRENT_TIMESTAMP, delete_batch = ? WHERE interface_id = ? AND status = ?`
+	ruleResult, err := tx.ExecContext(ctx, ruleQuery, model.StatusDeleted, batch, id, model.StatusActive)
+	if err != nil {
+		logger.Error("Failed to delete rules",
+			zap.String("query", ruleQuery),
+			zap.Int64("id", id),
+			zap.Error(err))
+		return fmt.Errorf("failed to delete rules: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
 	}
 
+	rules, _ := ruleResult.RowsAffected()
 	logger.Info("Successfully deleted mock URL",
 		zap.Int64("id", id),
+		zap.Int64("rules", rules),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// RestoreMockUrl makes a deleted interface active again, together with the rules that
+// were deleted with it. Rules deleted on their own before stay deleted. It returns
+// sql.ErrNoRows when no deleted interface has the ID.
+func (s *MySQLStorage) RestoreMockUrl(ctx context.Context, id int64) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM stub_interface WHERE id = ? AND status = ?"+s.dialect.forUpdate,
+		id, model.StatusDeleted).Scan(&found)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to query deleted interface",
+				zap.Int64("id", id),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	// Rules deleted with the interface carry its delete batch
+	ruleQuery := `UPDATE stub_rule SET status = ?, delete_time = NULL, delete_batch = 0
+		WHERE interface_id = ? AND status = ? AND delete_batch <> 0
+		AND delete_batch = (SELECT delete_batch FROM stub_interface WHERE id = ?)`
+	ruleResult, err := tx.ExecContext(ctx, ruleQuery, model.StatusActive, id, model.StatusDeleted, id)
+	if err != nil {
+		logger.Error("Failed to restore rules",
+			zap.String("query", ruleQuery),
+			zap.Int64("id", id),
+			zap.Error(err))
+		return fmt.Errorf("failed to restore rules: %v", err)
+	}
+
+	query := `UPDATE stub_interface SET status = ?, delete_time = NULL, delete_batch = 0, version = version + 1 WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, model.StatusActive, id); err != nil {
+		logger.Error("Failed to restore stub interface",
+			zap.String("query", query),
+			zap.Int64("id", id),
+			zap.Error(err))
+		return fmt.Errorf("failed to restore stub interface: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	rules, _ := ruleResult.RowsAffected()
+	logger.Info("Successfully restored mock URL",
+		zap.Int64("id", id),
+		zap.Int64("rules", rules),
 		zap.Duration("duration", time.Since(start)))
 
 	return nil
 }
+
+// PurgeMockUrl removes a deleted interface for good, together with all of its rules and
+// their conditions and responses. Its revisions are kept as its history. It returns
+// sql.ErrNoRows when no deleted interface has the ID.
+func (s *MySQLStorage) PurgeMockUrl(ctx context.Context, id int64) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM stub_interface WHERE id = ? AND status = ?"+s.dialect.forUpdate,
+		id, model.StatusDeleted).Scan(&found)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to query deleted interface",
+				zap.Int64("id", id),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM stub_rule_condition WHERE rule_id IN (SELECT id FROM stub_rule WHERE interface_id = ?)`,
+		`DELETE FROM stub_rule_response WHERE rule_id IN (SELECT id FROM stub_rule WHERE interface_id = ?)`,
+		`DELETE FROM stub_rule WHERE interface_id = ?`,
+		`DELETE FROM stub_interface WHERE id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			logger.Error("Failed to purge stub interface",
+				zap.String("query", query),
+				zap.Int64("id", id),
+				zap.Error(err))
+			return fmt.Errorf("failed to purge stub interface: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	logger.Info("Successfully purged mock URL",
+		zap.Int64("id", id),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// UpdateMockUrl overwrites every field of an existing interface, including its URL and
+// method. It returns sql.ErrNoRows when no interface has the ID, and ErrVersionConflict
+// when iface.Version is set and the interface is no longer at that version.
+func (s *MySQLStorage) UpdateMockUrl(ctx context.Context, iface *model.Interface) error {
+	start := time.Now()
+
+	headerJSON, err := json.Marshal(iface.ResponseHeader)
+	if err != nil {
+		logger.Error("Failed to marshal response header",
+			zap.Any("header", iface.ResponseHeader),
+			zap.Error(err))
+		return fmt.Errorf("failed to marshal response header: %v", err)
+	}
+
+	delaySpecJSON, err := encodeDelaySpec(iface.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to marshal delay spec",
+			zap.Error(err))
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the interface while its version is checked, so no other change comes in between
+	var version int64
+	err = tx.QueryRowContext(ctx, "SELECT version FROM stub_interface WHERE id = ? AND status <> ?"+s.dialect.forUpdate,
+		iface.ID, model.StatusDeleted).Scan(&version)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to query interface",
+				zap.Int64("id", iface.ID),
+				zap.Error(err))
+		}
+		return err
+	}
+	if iface.Version != 0 && iface.Version != version {
+		logger.Info("Refused update of a changed interface",
+			zap.Int64("id", iface.ID),
+			zap.Int64("expected", iface.Version),
+			zap.Int64("version", version))
+		return ErrVersionConflict
+	}
+
+	query := `UPDATE stub_interface SET
+        url = ?, method = ?, url_type = ?, def_resp_code = ?, def_resp_header = ?, def_resp_body = ?,
+        def_resp_template = ?, def_delay_spec = ?, proxy_url = ?, owner = ?, description = ?, meta = ?,
+        version = version + 1
+    WHERE id = ?`
+
+	if _, err := tx.ExecContext(ctx, query,
+		iface.URL, iface.Method, iface.URLType, iface.ResponseCode, string(headerJSON), iface.ResponseBody,
+		iface.Template, delaySpecJSON, iface.ProxyURL, iface.Owner, iface.Description, iface.Meta,
+		iface.ID); err != nil {
+		logger.Error("Failed to update stub interface",
+			zap.String("query", query),
+			zap.Int64("id", iface.ID),
+			zap.String("url", iface.URL),
+			zap.String("method", iface.Method),
+			zap.Error(err))
+		return fmt.Errorf("failed to update stub interface: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	logger.Info("Successfully updated mock URL",
+		zap.Int64("id", iface.ID),
+		zap.String("url", iface.URL),
+		zap.String("method", iface.Method),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// GetRuleByID returns a rule that has not been deleted, with its interface ID set.
+// It returns sql.ErrNoRows when there is no such rule.
+func (s *MySQLStorage) GetRuleByID(ctx context.Context, ruleID int64) (*model.Rule, error) {
+	query := `SELECT 
+        id, interface_id, priority, match_type, match_rule, logic,
+        resp_code, resp_header, resp_body, resp_template, resp_mode,
+        delay_time, delay_spec, fault, fault_bandwidth, scenario, required_state, new_state, description, meta, status
+    FROM stub_rule 
+    WHERE id = ? AND status <> ?`
+
+	var rule model.Rule
+	var headerJSON, delaySpecJSON string
+	err := s.db.QueryRowContext(ctx, query, ruleID, model.StatusDeleted).Scan(
+		&rule.ID, &rule.InterfaceID, &rule.Priority, &rule.MatchType, &rule.MatchRule, &rule.Logic,
+		&rule.ResponseCode, &headerJSON, &rule.ResponseBody, &rule.Template, &rule.ResponseMode,
+		&rule.DelayTime, &delaySpecJSON, &rule.Fault, &rule.FaultBandwidth,
+		&rule.Scenario, &rule.RequiredState, &rule.NewState, &rule.Description, &rule.Meta, &rule.Status,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to query rule",
+				zap.String("query", query),
+				zap.Int64("ruleID", ruleID),
+				zap.Error(err))
+		}
+		return nil, err
+	}
+
+	if headerJSON != "" {
+		if err := json.Unmarshal([]byte(headerJSON), &rule.ResponseHeader); err != nil {
+			logger.Error("Failed to unmarshal rule response header",
+				zap.String("header", headerJSON),
+				zap.Error(err))
+			return nil, fmt.Errorf("failed to unmarshal rule response header: %v", err)
+		}
+	}
+	if rule.DelaySpec, err = decodeDelaySpec(delaySpecJSON); err != nil {
+		logger.Error("Failed to unmarshal rule delay spec",
+			zap.String("delaySpec", delaySpecJSON),
+			zap.Error(err))
+		return nil, err
+	}
+
+	conditions, err := s.getConditions(ctx, "r.interface_id = ?", rule.InterfaceID)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := s.getResponses(ctx, "r.interface_id = ?", rule.InterfaceID)
+	if err != nil {
+		return nil, err
+	}
+	rule.Conditions = conditions[rule.ID]
+	rule.Responses = responses[rule.ID]
+
+	return &rule, nil
+}
+
+// UpdateRule overwrites every field of an existing rule and replaces its conditions and
+// responses. The rule keeps its interface. It returns sql.ErrNoRows when there is no rule
+// with the ID.
+func (s *MySQLStorage) UpdateRule(ctx context.Context, rule *model.Rule) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM stub_rule WHERE id = ? AND status <> ?"+s.dialect.forUpdate,
+		rule.ID, model.StatusDeleted).Scan(&id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to query rule",
+				zap.Int64("ruleID", rule.ID),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	if err := updateRule(ctx, tx, rule); err != nil {
+		return err
+	}
+	if err := touchRuleInterface(ctx, tx, rule.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	logger.Info("Successfully updated rule",
+		zap.Int64("ruleID", rule.ID),
+		zap.Int("conditions", len(rule.Conditions)),
+		zap.Int("responses", len(rule.Responses)),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// updateRule overwrites every field of an existing rule and replaces its conditions and
+// responses
+func updateRule(ctx context.Context, tx *sql.Tx, rule *model.Rule) error {
+	headerJSON, err := json.Marshal(rule.ResponseHeader)
+	if err != nil {
+		logger.Error("Failed to marshal rule response header",
+			zap.Any("header", rule.ResponseHeader),
+			zap.Error(err))
+		return fmt.Errorf("failed to marshal rule response header: %v", err)
+	}
+
+	delaySpecJSON, err := encodeDelaySpec(rule.DelaySpec)
+	if err != nil {
+		logger.Error("Failed to marshal rule delay spec",
+			zap.Error(err))
+		return err
+	}
+
+	query := `UPDATE stub_rule SET
+        match_type = ?, match_rule = ?, logic = ?, priority = ?,
+        resp_code = ?, resp_header = ?, resp_body = ?, resp_template = ?, resp_mode = ?,
+        delay_time = ?, delay_spec = ?, fault = ?, fault_bandwidth = ?,
+        scenario = ?, required_state = ?, new_state = ?, description = ?, meta = ?
+    WHERE id = ?`
+
+	if _, err := tx.ExecContext(ctx, query,
+		rule.MatchType, rule.MatchRule, rule.Logic, rule.Priority,
+		rule.ResponseCode, string(headerJSON), rule.ResponseBody, rule.Template, rule.ResponseMode,
+		rule.DelayTime, delaySpecJSON, rule.Fault, rule.FaultBandwidth,
+		rule.Scenario, rule.RequiredState, rule.NewState, rule.Description, rule.Meta,
+		rule.ID); err != nil {
+		logger.Error("Failed to update rule",
+			zap.String("query", query),
+			zap.Int64("ruleID", rule.ID),
+			zap.Error(err))
+		return fmt.Errorf("failed to update rule: %v", err)
+	}
+
+	for _, query := range []string{
+		`DELETE FROM stub_rule_condition WHERE rule_id = ?`,
+		`DELETE FROM stub_rule_response WHERE rule_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, rule.ID); err != nil {
+			logger.Error("Failed to delete previous rule conditions or responses",
+				zap.String("query", query),
+				zap.Int64("ruleID", rule.ID),
+				zap.Error(err))
+			return fmt.Errorf("failed to delete previous rule conditions or responses: %v", err)
+		}
+	}
+
+	return insertRuleChildren(ctx, tx, rule.ID, rule)
+}
+
+// touchInterface counts a change to an interface or its rules in the interface's version
+func touchInterface(ctx context.Context, tx *sql.Tx, interfaceID int64) error {
+	query := `UPDATE stub_interface SET version = version + 1 WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, interfaceID); err != nil {
+		logger.Error("Failed to update interface version",
+			zap.String("query", query),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Error(err))
+		return fmt.Errorf("failed to update interface version: %v", err)
+	}
+	return nil
+}
+
+// touchRuleInterface counts a change to a rule in the version of the rule's interface
+func touchRuleInterface(ctx context.Context, tx *sql.Tx, ruleID int64) error {
+	query := `UPDATE stub_interface SET version = version + 1 WHERE id = (SELECT interface_id FROM stub_rule WHERE id = ?)`
+	if _, err := tx.ExecContext(ctx, query, ruleID); err != nil {
+		logger.Error("Failed to update interface version",
+			zap.String("query", query),
+			zap.Int64("ruleID", ruleID),
+			zap.Error(err))
+		return fmt.Errorf("failed to update interface version: %v", err)
+	}
+	return nil
+}
+
+// ReplaceRules makes rules the rule set of an interface in one transaction. Rules with an
+// ID are updated in place, the others are inserted and get their IDs set, and the
+// interface's rules left out are marked deleted. It returns sql.ErrNoRows when a rule ID
+// is not one of the interface's rules that have not been deleted.
+func (s *MySQLStorage) ReplaceRules(ctx context.Context, interfaceID int64, rules []*model.Rule) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "SELECT id FROM stub_rule WHERE interface_id = ? AND status <> ?" + s.dialect.forUpdate
+	rows, err := tx.QueryContext(ctx, query, interfaceID, model.StatusDeleted)
+	if err != nil {
+		logger.Error("Failed to query rules",
+			zap.String("query", query),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Error(err))
+		return err
+	}
+	current := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ids := make([]int64, len(rules))
+	for i, rule := range rules {
+		if rule.ID == 0 {
+			if ids[i], err = insertRule(ctx, tx, interfaceID, rule); err != nil {
+				return err
+			}
+			continue
+		}
+		if !current[rule.ID] {
+			return sql.ErrNoRows
+		}
+		if err := updateRule(ctx, tx, rule); err != nil {
+			return err
+		}
+		delete(current, rule.ID)
+		ids[i] = rule.ID
+	}
+
+	deleteQuery := `UPDATE stub_rule SET status = ?, delete_time = CURRENT_TIMESTAMP WHERE id = ?`
+	for id := range current {
+		if _, err := tx.ExecContext(ctx, deleteQuery, model.StatusDeleted, id); err != nil {
+			logger.Error("Failed to delete rule",
+				zap.String("query", deleteQuery),
+				zap.Int64("ruleID", id),
+				zap.Error(err))
+			return fmt.Errorf("failed to delete rule: %v", err)
+		}
+	}
+	if err := touchInterface(ctx, tx, interfaceID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+	for i, rule := range rules {
+		rule.ID = ids[i]
+	}
+
+	logger.Info("Successfully replaced rules",
+		zap.Int64("interfaceID", interfaceID),
+		zap.Int("rules", len(rules)),
+		zap.Int("deleted", len(current)),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// DeleteRule marks a rule as deleted. It returns sql.ErrNoRows when there is no rule with
+// the ID that has not been deleted yet.
+func (s *MySQLStorage) DeleteRule(ctx context.Context, ruleID int64) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE stub_rule SET status = ?, delete_time = CURRENT_TIMESTAMP WHERE id = ? AND status <> ?`
+
+	result, err := tx.ExecContext(ctx, query, model.StatusDeleted, ruleID, model.StatusDeleted)
+	if err != nil {
+		logger.Error("Failed to delete rule",
+			zap.String("query", query),
+			zap.Int64("ruleID", ruleID),
+			zap.Error(err))
+		return fmt.Errorf("failed to delete rule: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logger.Error("Failed to get rows affected",
+			zap.Error(err))
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	if err := touchRuleInterface(ctx, tx, ruleID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	logger.Info("Successfully deleted rule",
+		zap.Int64("ruleID", ruleID),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// SetMockUrlStatus moves an interface between active and inactive. It returns
+// sql.ErrNoRows when no interface with the ID exists or it has been deleted.
+func (s *MySQLStorage) SetMockUrlStatus(ctx context.Context, id int64, status model.Status) error {
+	return s.setStatus(ctx, "stub_interface", id, status)
+}
+
+// SetRuleStatus moves a rule between active and inactive. It returns sql.ErrNoRows when
+// no rule with the ID exists or it has been deleted.
+func (s *MySQLStorage) SetRuleStatus(ctx context.Context, ruleID int64, status model.Status) error {
+	return s.setStatus(ctx, "stub_rule", ruleID, status)
+}
+
+func (s *MySQLStorage) setStatus(ctx context.Context, table string, id int64, status model.Status) error {
+	start := time.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	// MySQL reports unchanged rows as unaffected, so check that the row exists first
+	var current model.Status
+	err = tx.QueryRowContext(ctx, "SELECT status FROM "+table+" WHERE id = ? AND status <> ?"+s.dialect.forUpdate,
+		id, model.StatusDeleted).Scan(&current)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Failed to query status",
+				zap.String("table", table),
+				zap.Int64("id", id),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	query := "UPDATE " + table + " SET status = ? WHERE id = ?"
+	if _, err := tx.ExecContext(ctx, query, status, id); err != nil {
+		logger.Error("Failed to update status",
+			zap.String("query", query),
+			zap.Int64("id", id),
+			zap.Error(err))
+		return fmt.Errorf("failed to update status: %v", err)
+	}
+	if table == "stub_interface" {
+		err = touchInterface(ctx, tx, id)
+	} else {
+		err = touchRuleInterface(ctx, tx, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+
+	logger.Info("Successfully updated status",
+		zap.String("table", table),
+		zap.Int64("id", id),
+		zap.String("from", string(current)),
+		zap.String("to", string(status)),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// GetScenarios returns the names of the scenarios used by active rules
+func (s *MySQLStorage) GetScenarios(ctx context.Context) ([]string, error) {
+	query := `SELECT DISTINCT scenario FROM stub_rule WHERE scenario != '' AND status = ?`
+
+	rows, err := s.db.QueryContext(ctx, query, model.StatusActive)
+	if err != nil {
+		logger.Error("Failed to query scenarios",
+			zap.String("query", query),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query scenarios: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			logger.Error("Failed to scan scenario row",
+				zap.Error(err))
+			return nil, fmt.Errorf("failed to scan scenario row: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// GetMockUrlRoutes returns the ID, URL, URL type, method, status and source of every
+// interface that has not been deleted
+func (s *MySQLStorage) GetMockUrlRoutes(ctx context.Context) ([]*model.Interface, error) {
+	query := `SELECT id, url, url_type, method, status, source FROM stub_interface WHERE status <> ? ORDER BY id ASC`
+
+	rows, err := s.db.QueryContext(ctx, query, model.StatusDeleted)
+	if err != nil {
+		logger.Error("Failed to query mock URL routes",
+			zap.String("query", query),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query mock URL routes: %v", err)
+	}
+	defer rows.Close()
+
+	var interfaces []*model.Interface
+	for rows.Next() {
+		var iface model.Interface
+		if err := rows.Scan(&iface.ID, &iface.URL, &iface.URLType, &iface.Method, &iface.Status, &iface.Source); err != nil {
+			logger.Error("Failed to scan mock URL route row",
+				zap.Error(err))
+			return nil, fmt.Errorf("failed to scan mock URL route row: %v", err)
+		}
+		interfaces = append(interfaces, &iface)
+	}
+	return interfaces, rows.Err()
+}
+
+// SaveRevision stores a revision of an interface as its next version, which it sets
+func (s *MySQLStorage) SaveRevision(ctx context.Context, rev *model.Revision) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Failed to begin transaction",
+			zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int32
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM stub_revision WHERE interface_id = ?"+s.dialect.forUpdate,
+		rev.InterfaceID).Scan(&version)
+	if err != nil {
+		logger.Error("Failed to query latest revision",
+			zap.Int64("interfaceID", rev.InterfaceID),
+			zap.Error(err))
+		return fmt.Errorf("failed to query latest revision: %v", err)
+	}
+
+	query := `INSERT INTO stub_revision (interface_id, version, action, author, comment, snapshot) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query,
+		rev.InterfaceID, version+1, rev.Action, rev.Author, rev.Comment, rev.Snapshot)
+	if err != nil {
+		logger.Error("Failed to insert revision",
+			zap.String("query", query),
+			zap.Int64("interfaceID", rev.InterfaceID),
+			zap.Error(err))
+		return fmt.Errorf("failed to insert revision: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		logger.Error("Failed to get revision ID",
+			zap.Error(err))
+		return fmt.Errorf("failed to get revision ID: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("Failed to commit transaction",
+			zap.Error(err))
+		return err
+	}
+	rev.ID = id
+	rev.Version = version + 1
+	rev.CreatedAt = time.Now()
+
+	return nil
+}
+
+func (s *MySQLStorage) revisionColumns() string {
+	return `id, interface_id, version, action, COALESCE(author, ''), comment, snapshot, ` + s.dialect.unixTime("create_time")
+}
+
+// GetRevisions returns the revisions of an interface, newest first
+func (s *MySQLStorage) GetRevisions(ctx context.Context, interfaceID int64) ([]*model.Revision, error) {
+	query := `SELECT ` + s.revisionColumns() + ` FROM stub_revision WHERE interface_id = ? ORDER BY version DESC`
+
+	rows, err := s.db.QueryContext(ctx, query, interfaceID)
+	if err != nil {
+		logger.Error("Failed to query revisions",
+			zap.String("query", query),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to query revisions: %v", err)
+	}
+	defer rows.Close()
+
+	var revisions []*model.Revision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			logger.Error("Failed to scan revision row",
+				zap.Error(err))
+			return nil, fmt.Errorf("failed to scan revision row: %v", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// GetRevision returns one revision of an interface, the latest when version is 0. It
+// returns sql.ErrNoRows when there is no such revision.
+func (s *MySQLStorage) GetRevision(ctx context.Context, interfaceID int64, version int32) (*model.Revision, error) {
+	query := `SELECT ` + s.revisionColumns() + ` FROM stub_revision WHERE interface_id = ?`
+	args := []interface{}{interfaceID}
+	if version > 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+	query += ` ORDER BY version DESC LIMIT 1`
+
+	rev, err := scanRevision(s.db.QueryRowContext(ctx, query, args...))
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("Failed to query revision",
+			zap.String("query", query),
+			zap.Int64("interfaceID", interfaceID),
+			zap.Int32("version", version),
+			zap.Error(err))
+	}
+	return rev, err
+}
+
+func scanRevision(row interface{ Scan(...interface{}) error }) (*model.Revision, error) {
+	var rev model.Revision
+	var createTime int64
+	if err := row.Scan(&rev.ID, &rev.InterfaceID, &rev.Version, &rev.Action, &rev.Author,
+		&rev.Comment, &rev.Snapshot, &createTime); err != nil {
+		return nil, err
+	}
+	rev.CreatedAt = time.Unix(createTime, 0)
+	return &rev, nil
+}
+
+// encodeDelaySpec stores a delay spec as JSON, or as an empty string when there is none
+func encodeDelaySpec(spec *model.DelaySpec) (string, error) {
+	if spec == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal delay spec: %v", err)
+	}
+	return string(b), nil
+}
+
+func decodeDelaySpec(s string) (*model.DelaySpec, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var spec model.DelaySpec
+	if err := json.Unmarshal([]byte(s), &spec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal delay spec: %v", err)
+	}
+	return &spec, nil
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/lru"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/urlmatch"
+)
+
+// patternCache holds compiled URL patterns keyed by url_type and url, so that
+// the mock path does not recompile them on every request
+var patternCache = lru.New(4096)
+
+// CompilePattern compiles the URL of a template or regex interface, caching the result
+func CompilePattern(urlType, url string) (*urlmatch.Pattern, error) {
+	key := urlType + "\x00" + url
+	if p, ok := patternCache.Get(key); ok {
+		return p.(*urlmatch.Pattern), nil
+	}
+
+	var p *urlmatch.Pattern
+	var err error
+	switch urlType {
+	case model.URLTypeTemplate:
+		p, err = urlmatch.CompileTemplate(url)
+	case model.URLTypeRegex:
+		p, err = urlmatch.CompileRegex(url)
+	default:
+		return nil, fmt.Errorf("url_type %q is not a pattern type", urlType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	patternCache.Add(key, p)
+	return p, nil
+}
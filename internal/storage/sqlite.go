@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// SQLiteScheme prefixes the DSN of a SQLite database file, as in sqlite://data/mocksvr.db
+const SQLiteScheme = "sqlite://"
+
+// SQLiteStorage stores stubs in a SQLite database file, which suits local development
+// and CI. It runs the MySQLStorage queries through a SQLite dialect.
+type SQLiteStorage struct {
+	*MySQLStorage
+}
+
+// NewSQLiteStorage opens the SQLite database named by a sqlite:// DSN, creating the file
+// if needed, but not its tables, which the migrations run by Migrator create. Options of
+// the go-sqlite3 driver may follow the path, as in sqlite://mocksvr.db?cache=shared.
+func NewSQLiteStorage(dsn string) (*SQLiteStorage, error) {
+	path := strings.TrimPrefix(dsn, SQLiteScheme)
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	// Enforce foreign keys, which SQLite leaves off, and take the write lock when a
+	// transaction begins so concurrent writers wait for each other instead of failing
+	path += sep + "_foreign_keys=on&_txlock=immediate&_busy_timeout=5000"
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		logger.Error("Failed to open SQLite database",
+			zap.String("dsn", dsn),
+			zap.Error(err))
+		return nil, err
+	}
+	if strings.Contains(path, ":memory:") {
+		// Every connection to :memory: would get a database of its own
+		db.SetMaxOpenConns(1)
+	}
+
+	return &SQLiteStorage{MySQLStorage: &MySQLStorage{db: db, dialect: sqliteDialect}}, nil
+}
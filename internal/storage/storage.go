@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/config"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+)
+
+// Storage drivers selectable with config.DatabaseConfig.Driver
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+	DriverMemory = "memory"
+)
+
+var (
+	// ErrVersionConflict is returned by UpdateMockUrl when the interface has moved past the
+	// version the update expects
+	ErrVersionConflict = errors.New("interface version has changed")
+	// ErrInvalidReorder is returned by ReorderRules when the rule IDs are not the
+	// interface's rules, each listed once
+	ErrInvalidReorder = errors.New("invalid rule order")
+)
+
+// Storage keeps stubs, their rules and revisions. Lookups of a single interface, rule or
+// revision that find nothing return sql.ErrNoRows, as documented on MySQLStorage.
+type Storage interface {
+	SaveMockUrl(ctx context.Context, iface *model.Interface) (int64, error)
+	UpdateMockUrl(ctx context.Context, iface *model.Interface) error
+	GetMockResponse(ctx context.Context, method, url string) (*model.MockResponse, error)
+	GetAllMockUrls(ctx context.Context, keyword string, owner string, status string, page, pageSize int) ([]*model.Interface, int, error)
+	GetMockUrl(ctx context.Context, urlId int64) ([]*model.Interface, error)
+	GetMockUrlRoutes(ctx context.Context) ([]*model.Interface, error)
+	GetActiveMockUrls(ctx context.Context) ([]*model.Interface, map[int64][]model.Rule, error)
+	DeleteMockUrl(ctx context.Context, id int64) error
+	RestoreMockUrl(ctx context.Context, id int64) error
+	PurgeMockUrl(ctx context.Context, id int64) error
+	SetMockUrlStatus(ctx context.Context, id int64, status model.Status) error
+
+	SaveRule(ctx context.Context, interfaceID int64, rule *model.Rule) error
+	UpdateRule(ctx context.Context, rule *model.Rule) error
+	ReplaceRules(ctx context.Context, interfaceID int64, rules []*model.Rule) error
+	GetRules(ctx context.Context, interfaceID int64) ([]model.Rule, error)
+	GetRulesByInterfaceID(ctx context.Context, interfaceID int64) ([]*model.Rule, error)
+	GetRuleByID(ctx context.Context, ruleID int64) (*model.Rule, error)
+	ReorderRules(ctx context.Context, interfaceID int64, ruleIDs []int64) error
+	DeleteRule(ctx context.Context, ruleID int64) error
+	DeleteRules(ctx context.Context, interfaceID int64) error
+	SetRuleStatus(ctx context.Context, ruleID int64, status model.Status) error
+	GetScenarios(ctx context.Context) ([]string, error)
+
+	SaveRevision(ctx context.Context, rev *model.Revision) error
+	GetRevisions(ctx context.Context, interfaceID int64) ([]*model.Revision, error)
+	GetRevision(ctx context.Context, interfaceID int64, version int32) (*model.Revision, error)
+
+	Close() error
+}
+
+var (
+	_ Storage = (*MySQLStorage)(nil)
+	_ Storage = (*SQLiteStorage)(nil)
+	_ Storage = (*MemoryStorage)(nil)
+)
+
+// New opens the storage backend chosen by the database config. Without a driver, a DSN
+// with the sqlite:// scheme opens SQLite and any other DSN opens MySQL.
+func New(cfg config.DatabaseConfig) (Storage, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = DriverMySQL
+		if strings.HasPrefix(cfg.DSN, SQLiteScheme) {
+			driver = DriverSQLite
+		}
+	}
+
+	switch driver {
+	case DriverMySQL:
+		return NewMySQLStorage(cfg.DSN)
+	case DriverSQLite:
+		return NewSQLiteStorage(cfg.DSN)
+	case DriverMemory:
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q, must be %s, %s or %s", cfg.Driver, DriverMySQL, DriverSQLite, DriverMemory)
+	}
+}
@@ -0,0 +1,661 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/model"
+	"github.com/xiaobailjlj/mocksvr_grpc/internal/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("release")
+	os.Exit(m.Run())
+}
+
+// backends opens an empty store of each backend that runs in process
+var backends = []struct {
+	name string
+	open func(t *testing.T) Storage
+}{
+	{"memory", func(t *testing.T) Storage { return NewMemoryStorage() }},
+	{"sqlite", openSQLite},
+}
+
+// openSQLite opens a migrated SQLite database in a temporary file. Running the checks on
+// it covers the SQLite dialect: the upsert of SaveMockUrl, the locking reads of updates,
+// the delete times and the migrations run statement by statement.
+func openSQLite(t *testing.T) Storage {
+	t.Helper()
+	store, err := NewSQLiteStorage(SQLiteScheme + filepath.Join(t.TempDir(), "mocksvr.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage: %v", err)
+	}
+	migrator, err := NewMigrator(store)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return store
+}
+
+// TestStorageConformance runs the same checks against every backend, so that they keep
+// behaving alike
+func TestStorageConformance(t *testing.T) {
+	checks := []struct {
+		name string
+		run  func(t *testing.T, s Storage)
+	}{
+		{"save stub", testSaveMockUrl},
+		{"mock response precedence", testGetMockResponse},
+		{"replace rules", testReplaceRules},
+		{"reorder rules", testReorderRules},
+		{"delete restore purge", testDeleteRestorePurge},
+		{"status", testStatus},
+		{"list stubs", testGetAllMockUrls},
+		{"active stubs", testGetActiveMockUrls},
+		{"revisions", testRevisions},
+		{"version", testVersion},
+	}
+	for _, b := range backends {
+		for _, c := range checks {
+			t.Run(b.name+"/"+c.name, func(t *testing.T) {
+				s := b.open(t)
+				defer s.Close()
+				c.run(t, s)
+			})
+		}
+	}
+}
+
+func testInterface(method, urlType, url, body string) *model.Interface {
+	return &model.Interface{
+		URL:            url,
+		Method:         method,
+		URLType:        urlType,
+		ResponseCode:   "200",
+		ResponseHeader: map[string]string{"Content-Type": "text/plain"},
+		ResponseBody:   body,
+		Owner:          "alice",
+	}
+}
+
+func testRule(priority int32, matchRule string) *model.Rule {
+	return &model.Rule{
+		Priority:       priority,
+		MatchType:      model.MatchTypeQuery,
+		MatchRule:      matchRule,
+		Logic:          model.LogicAnd,
+		Conditions:     []model.Condition{{MatchType: model.MatchTypeHeader, MatchRule: `{"X-Test": "1"}`}},
+		ResponseCode:   "200",
+		ResponseHeader: map[string]string{"Content-Type": "text/plain"},
+		ResponseBody:   matchRule,
+		ResponseMode:   model.ResponseModeSingle,
+	}
+}
+
+func mustSave(t *testing.T, s Storage, iface *model.Interface, rules ...*model.Rule) int64 {
+	t.Helper()
+	ctx := context.Background()
+	id, err := s.SaveMockUrl(ctx, iface)
+	if err != nil {
+		t.Fatalf("SaveMockUrl %s %s: %v", iface.Method, iface.URL, err)
+	}
+	if err := s.ReplaceRules(ctx, id, rules); err != nil {
+		t.Fatalf("ReplaceRules: %v", err)
+	}
+	return id
+}
+
+func mustGet(t *testing.T, s Storage, id int64) *model.Interface {
+	t.Helper()
+	interfaces, err := s.GetMockUrl(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetMockUrl(%d): %v", id, err)
+	}
+	if len(interfaces) != 1 {
+		t.Fatalf("GetMockUrl(%d) = %d interfaces, want 1", id, len(interfaces))
+	}
+	return interfaces[0]
+}
+
+// ruleBodies lists the response bodies of rules, which the tests set to tell rules apart
+func ruleBodies(rules []model.Rule) []string {
+	bodies := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		bodies = append(bodies, rule.ResponseBody)
+	}
+	return bodies
+}
+
+func mustRules(t *testing.T, s Storage, id int64) []model.Rule {
+	t.Helper()
+	rules, err := s.GetRules(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetRules(%d): %v", id, err)
+	}
+	return rules
+}
+
+func testSaveMockUrl(t *testing.T, s Storage) {
+	ctx := context.Background()
+	iface := testInterface("GET", model.URLTypeExact, "/users", "first")
+	iface.DelaySpec = &model.DelaySpec{Type: model.DelayFixed, Value: 10}
+	iface.Description = "users"
+	iface.Meta = `{"team": "a"}`
+	iface.Source = model.SourceFilePrefix + "users.yaml"
+	id := mustSave(t, s, iface)
+
+	got := mustGet(t, s, id)
+	if got.URL != "/users" || got.Method != "GET" || got.URLType != model.URLTypeExact ||
+		got.ResponseCode != "200" || got.ResponseBody != "first" || got.Owner != "alice" ||
+		got.Description != "users" || got.Meta != `{"team": "a"}` || got.Source != iface.Source ||
+		got.Status != model.StatusActive {
+		t.Errorf("GetMockUrl = %+v, want the saved interface", got)
+	}
+	if !reflect.DeepEqual(got.ResponseHeader, iface.ResponseHeader) {
+		t.Errorf("ResponseHeader = %v, want %v", got.ResponseHeader, iface.ResponseHeader)
+	}
+	if !reflect.DeepEqual(got.DelaySpec, iface.DelaySpec) {
+		t.Errorf("DelaySpec = %+v, want %+v", got.DelaySpec, iface.DelaySpec)
+	}
+	routes, err := s.GetMockUrlRoutes(ctx)
+	if err != nil || len(routes) != 1 || routes[0].ID != id || routes[0].Source != iface.Source {
+		t.Errorf("GetMockUrlRoutes = %v, %v, want the interface with its source", routes, err)
+	}
+
+	// The same URL and method is saved over the interface
+	again, err := s.SaveMockUrl(ctx, testInterface("GET", model.URLTypeExact, "/users", "second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id {
+		t.Errorf("saving the same URL and method gave ID %d, want %d", again, id)
+	}
+	if got := mustGet(t, s, id); got.ResponseBody != "second" || got.DelaySpec != nil || got.Source != "" {
+		t.Errorf("after saving over it, body = %q, delay spec = %+v and source = %q", got.ResponseBody, got.DelaySpec, got.Source)
+	}
+
+	other, err := s.SaveMockUrl(ctx, testInterface("POST", model.URLTypeExact, "/users", "post"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == id {
+		t.Error("another method of the same URL got the same ID")
+	}
+
+	if interfaces, err := s.GetMockUrl(ctx, id+100); err != nil || len(interfaces) != 0 {
+		t.Errorf("GetMockUrl of a missing ID = %v, %v, want nothing", interfaces, err)
+	}
+}
+
+func testGetMockResponse(t *testing.T, s Storage) {
+	ctx := context.Background()
+	mustSave(t, s, testInterface("GET", model.URLTypeExact, "/users/me", "exact get"))
+	mustSave(t, s, testInterface(model.MethodAny, model.URLTypeExact, "/users/me", "exact any"))
+	mustSave(t, s, testInterface(model.MethodAny, model.URLTypeTemplate, "/users/{id}", "template any"))
+	mustSave(t, s, testInterface("GET", model.URLTypeTemplate, "/users/{id}", "template get"))
+	mustSave(t, s, testInterface("GET", model.URLTypeTemplate, "/users/**", "double wildcard"))
+	mustSave(t, s, testInterface(model.MethodAny, model.URLTypeRegex, `/items/(?P<id>\d+)`, "regex"))
+	off := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/off", "inactive"))
+	if err := s.SetMockUrlStatus(ctx, off, model.StatusInactive); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, url string
+		wantBody    string // empty when nothing matches
+		wantParams  map[string]string
+	}{
+		{"GET", "/users/me", "exact get", nil},
+		{"POST", "/users/me", "exact any", nil},
+		{"GET", "/users/42", "template get", map[string]string{"id": "42"}},
+		{"POST", "/users/42", "template any", map[string]string{"id": "42"}},
+		{"GET", "/users/42/orders", "double wildcard", nil},
+		{"POST", "/users/42/orders", "", nil},
+		{"DELETE", "/items/7", "regex", map[string]string{"id": "7"}},
+		{"GET", "/items/x", "", nil},
+		{"GET", "/off", "", nil},
+	}
+	for _, tt := range tests {
+		resp, err := s.GetMockResponse(ctx, tt.method, tt.url)
+		if tt.wantBody == "" {
+			if err != sql.ErrNoRows {
+				t.Errorf("GetMockResponse(%s %s) = %+v, %v, want sql.ErrNoRows", tt.method, tt.url, resp, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GetMockResponse(%s %s): %v", tt.method, tt.url, err)
+			continue
+		}
+		if resp.ResponseBody != tt.wantBody {
+			t.Errorf("GetMockResponse(%s %s) answered with %q, want %q", tt.method, tt.url, resp.ResponseBody, tt.wantBody)
+		}
+		if (len(resp.PathParams) > 0 || len(tt.wantParams) > 0) && !reflect.DeepEqual(resp.PathParams, tt.wantParams) {
+			t.Errorf("GetMockResponse(%s %s) params = %v, want %v", tt.method, tt.url, resp.PathParams, tt.wantParams)
+		}
+	}
+}
+
+func testReplaceRules(t *testing.T, s Storage) {
+	ctx := context.Background()
+	r1, r2 := testRule(1, "a=1"), testRule(2, "a=2")
+	id := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/rules", "default"), r1, r2)
+	if r1.ID == 0 || r2.ID == 0 {
+		t.Fatalf("ReplaceRules left rule IDs unset: %d, %d", r1.ID, r2.ID)
+	}
+
+	rules := mustRules(t, s, id)
+	if got := ruleBodies(rules); !reflect.DeepEqual(got, []string{"a=1", "a=2"}) {
+		t.Fatalf("rules = %v, want [a=1 a=2]", got)
+	}
+	if !reflect.DeepEqual(rules[0].Conditions, r1.Conditions) || !reflect.DeepEqual(rules[0].ResponseHeader, r1.ResponseHeader) {
+		t.Errorf("rule = %+v, want the conditions and header saved", rules[0])
+	}
+
+	// Update r2 in place, add r3 with a response sequence and leave r1 out
+	r2.ResponseBody = "a=2 updated"
+	r3 := testRule(3, "a=3")
+	r3.ResponseMode = model.ResponseModeCycle
+	r3.Responses = []model.RuleResponse{
+		{ResponseCode: "200", ResponseHeader: map[string]string{"Content-Type": "text/plain"}, ResponseBody: "one", Weight: 1},
+		{ResponseCode: "503", ResponseBody: "two", Weight: 1},
+	}
+	r2ID := r2.ID
+	if err := s.ReplaceRules(ctx, id, []*model.Rule{r2, r3}); err != nil {
+		t.Fatal(err)
+	}
+	if r2.ID != r2ID {
+		t.Errorf("updated rule got ID %d, want %d", r2.ID, r2ID)
+	}
+	rules = mustRules(t, s, id)
+	if got := ruleBodies(rules); !reflect.DeepEqual(got, []string{"a=2 updated", "a=3"}) {
+		t.Fatalf("rules = %v, want [a=2 updated, a=3]", got)
+	}
+	if len(rules[1].Responses) != 2 || rules[1].Responses[1].ResponseCode != "503" || rules[1].Responses[1].ResponseBody != "two" {
+		t.Errorf("responses = %+v, want the sequence saved", rules[1].Responses)
+	}
+	if _, err := s.GetRuleByID(ctx, r1.ID); err != sql.ErrNoRows {
+		t.Errorf("GetRuleByID of the rule left out = %v, want sql.ErrNoRows", err)
+	}
+
+	// A rule ID that is not one of the interface's rules changes nothing
+	bad := testRule(4, "a=4")
+	bad.ID = r1.ID
+	if err := s.ReplaceRules(ctx, id, []*model.Rule{testRule(5, "a=5"), bad}); err != sql.ErrNoRows {
+		t.Fatalf("ReplaceRules with a deleted rule ID = %v, want sql.ErrNoRows", err)
+	}
+	if got := ruleBodies(mustRules(t, s, id)); !reflect.DeepEqual(got, []string{"a=2 updated", "a=3"}) {
+		t.Errorf("after a failed replace, rules = %v, want them unchanged", got)
+	}
+
+	rule, err := s.GetRuleByID(ctx, r3.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.InterfaceID != id || rule.Status != model.StatusActive {
+		t.Errorf("GetRuleByID = interface %d, status %q, want %d, active", rule.InterfaceID, rule.Status, id)
+	}
+
+	if err := s.ReplaceRules(ctx, id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rules := mustRules(t, s, id); len(rules) != 0 {
+		t.Errorf("after replacing with no rules, rules = %v", ruleBodies(rules))
+	}
+}
+
+func testReorderRules(t *testing.T, s Storage) {
+	ctx := context.Background()
+	r1, r2, r3 := testRule(1, "a=1"), testRule(2, "a=2"), testRule(3, "a=3")
+	id := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/order", "default"), r1, r2, r3)
+	foreign := testRule(1, "b=1")
+	mustSave(t, s, testInterface("GET", model.URLTypeExact, "/other", "default"), foreign)
+
+	if err := s.ReorderRules(ctx, id, []int64{r3.ID, r1.ID, r2.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ruleBodies(mustRules(t, s, id)); !reflect.DeepEqual(got, []string{"a=3", "a=1", "a=2"}) {
+		t.Errorf("after reordering, rules = %v, want [a=3 a=1 a=2]", got)
+	}
+
+	for name, ids := range map[string][]int64{
+		"missing rule":  {r3.ID, r1.ID},
+		"repeated rule": {r3.ID, r1.ID, r1.ID},
+		"foreign rule":  {r3.ID, r1.ID, foreign.ID},
+	} {
+		if err := s.ReorderRules(ctx, id, ids); !errors.Is(err, ErrInvalidReorder) {
+			t.Errorf("ReorderRules with a %s = %v, want ErrInvalidReorder", name, err)
+		}
+	}
+	if got := ruleBodies(mustRules(t, s, id)); !reflect.DeepEqual(got, []string{"a=3", "a=1", "a=2"}) {
+		t.Errorf("after failed reorders, rules = %v, want them unchanged", got)
+	}
+}
+
+func testDeleteRestorePurge(t *testing.T, s Storage) {
+	ctx := context.Background()
+	r1, r2 := testRule(1, "a=1"), testRule(2, "a=2")
+	id := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/gone", "default"), r1, r2)
+	if err := s.SaveRevision(ctx, &model.Revision{InterfaceID: id, Action: model.RevisionCreate, Snapshot: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// r2 is deleted on its own, so it does not come back with the interface
+	if err := s.DeleteRule(ctx, r2.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteRule(ctx, r2.ID); err != sql.ErrNoRows {
+		t.Errorf("DeleteRule of a deleted rule = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := s.DeleteMockUrl(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteMockUrl(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("DeleteMockUrl of a deleted interface = %v, want sql.ErrNoRows", err)
+	}
+	if err := s.DeleteMockUrl(ctx, id+100); err != sql.ErrNoRows {
+		t.Errorf("DeleteMockUrl of a missing interface = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetMockResponse(ctx, "GET", "/gone"); err != sql.ErrNoRows {
+		t.Errorf("GetMockResponse of a deleted interface = %v, want sql.ErrNoRows", err)
+	}
+	if interfaces, _ := s.GetMockUrl(ctx, id); len(interfaces) != 0 {
+		t.Error("GetMockUrl returned a deleted interface")
+	}
+	deleted, total, err := s.GetAllMockUrls(ctx, "", "", string(model.StatusDeleted), 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(deleted) != 1 || deleted[0].ID != id || deleted[0].DeletedAt.IsZero() {
+		t.Errorf("deleted interfaces = %+v (total %d), want %d with its delete time", deleted, total, id)
+	}
+	if _, err := s.GetRuleByID(ctx, r1.ID); err != sql.ErrNoRows {
+		t.Errorf("GetRuleByID of a rule deleted with its interface = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := s.PurgeMockUrl(ctx, id+100); err != sql.ErrNoRows {
+		t.Errorf("PurgeMockUrl of a missing interface = %v, want sql.ErrNoRows", err)
+	}
+	if err := s.RestoreMockUrl(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RestoreMockUrl(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("RestoreMockUrl of an active interface = %v, want sql.ErrNoRows", err)
+	}
+	if got := ruleBodies(mustRules(t, s, id)); !reflect.DeepEqual(got, []string{"a=1"}) {
+		t.Errorf("after restoring, rules = %v, want only the rule deleted with the interface", got)
+	}
+
+	if err := s.PurgeMockUrl(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("PurgeMockUrl of an active interface = %v, want sql.ErrNoRows", err)
+	}
+	if err := s.DeleteMockUrl(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PurgeMockUrl(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := s.GetAllMockUrls(ctx, "", "", string(model.StatusDeleted), 1, 10); total != 0 {
+		t.Errorf("%d deleted interfaces left after purging", total)
+	}
+	if err := s.RestoreMockUrl(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("RestoreMockUrl of a purged interface = %v, want sql.ErrNoRows", err)
+	}
+	if revisions, err := s.GetRevisions(ctx, id); err != nil || len(revisions) != 1 {
+		t.Errorf("revisions after purging = %d, %v, want the one saved", len(revisions), err)
+	}
+
+	// The URL can be used again
+	mustSave(t, s, testInterface("GET", model.URLTypeExact, "/gone", "again"))
+	if resp, err := s.GetMockResponse(ctx, "GET", "/gone"); err != nil || resp.ResponseBody != "again" {
+		t.Errorf("GetMockResponse after saving over a purged interface = %+v, %v", resp, err)
+	}
+}
+
+func testStatus(t *testing.T, s Storage) {
+	ctx := context.Background()
+	r1, r2 := testRule(1, "a=1"), testRule(2, "a=2")
+	r1.Scenario = "login"
+	r2.Scenario = "checkout"
+	id := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/status", "default"), r1, r2)
+
+	if err := s.SetMockUrlStatus(ctx, id, model.StatusInactive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetMockResponse(ctx, "GET", "/status"); err != sql.ErrNoRows {
+		t.Errorf("GetMockResponse of an inactive interface = %v, want sql.ErrNoRows", err)
+	}
+	if got := mustGet(t, s, id); got.Status != model.StatusInactive {
+		t.Errorf("status = %q, want inactive", got.Status)
+	}
+	if err := s.SetMockUrlStatus(ctx, id, model.StatusActive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetMockResponse(ctx, "GET", "/status"); err != nil {
+		t.Errorf("GetMockResponse of a reactivated interface: %v", err)
+	}
+
+	if err := s.SetRuleStatus(ctx, r2.ID, model.StatusInactive); err != nil {
+		t.Fatal(err)
+	}
+	if got := ruleBodies(mustRules(t, s, id)); !reflect.DeepEqual(got, []string{"a=1"}) {
+		t.Errorf("active rules = %v, want [a=1]", got)
+	}
+	all, err := s.GetRulesByInterfaceID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[1].Status != model.StatusInactive {
+		t.Errorf("GetRulesByInterfaceID = %d rules, want both with the second inactive", len(all))
+	}
+	scenarios, err := s.GetScenarios(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(scenarios)
+	if !reflect.DeepEqual(scenarios, []string{"login"}) {
+		t.Errorf("GetScenarios = %v, want the scenario of the active rule only", scenarios)
+	}
+
+	if err := s.SetMockUrlStatus(ctx, id+100, model.StatusInactive); err != sql.ErrNoRows {
+		t.Errorf("SetMockUrlStatus of a missing interface = %v, want sql.ErrNoRows", err)
+	}
+	if err := s.SetRuleStatus(ctx, r2.ID+100, model.StatusInactive); err != sql.ErrNoRows {
+		t.Errorf("SetRuleStatus of a missing rule = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testGetAllMockUrls(t *testing.T, s Storage) {
+	ctx := context.Background()
+	one := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/a/one", "1"))
+	two := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/a/two", "2"))
+	bob := testInterface("GET", model.URLTypeExact, "/b/three", "3")
+	bob.Owner = "bob"
+	three := mustSave(t, s, bob)
+	if err := s.SetMockUrlStatus(ctx, two, model.StatusInactive); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(interfaces []*model.Interface) []int64 {
+		out := make([]int64, 0, len(interfaces))
+		for _, iface := range interfaces {
+			out = append(out, iface.ID)
+		}
+		return out
+	}
+	tests := []struct {
+		name           string
+		keyword, owner string
+		status         string
+		page, pageSize int
+		want           []int64
+		wantTotal      int
+	}{
+		{"active, newest first", "", "", string(model.StatusActive), 1, 10, []int64{three, one}, 2},
+		{"inactive", "", "", string(model.StatusInactive), 1, 10, []int64{two}, 1},
+		{"all", "", "", model.StatusFilterAll, 1, 10, []int64{three, two, one}, 3},
+		{"keyword", "/a/", "", model.StatusFilterAll, 1, 10, []int64{two, one}, 2},
+		{"owner", "", "bob", model.StatusFilterAll, 1, 10, []int64{three}, 1},
+		{"second page", "", "", model.StatusFilterAll, 2, 2, []int64{one}, 3},
+	}
+	for _, tt := range tests {
+		got, total, err := s.GetAllMockUrls(ctx, tt.keyword, tt.owner, tt.status, tt.page, tt.pageSize)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(ids(got), tt.want) || total != tt.wantTotal {
+			t.Errorf("%s: got %v (total %d), want %v (total %d)", tt.name, ids(got), total, tt.want, tt.wantTotal)
+		}
+	}
+}
+
+func testGetActiveMockUrls(t *testing.T, s Storage) {
+	ctx := context.Background()
+	r1, r2 := testRule(1, "a=1"), testRule(2, "a=2")
+	one := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/one", "one"), r1, r2)
+	if err := s.SetRuleStatus(ctx, r2.ID, model.StatusInactive); err != nil {
+		t.Fatal(err)
+	}
+	two := mustSave(t, s, testInterface("GET", model.URLTypeTemplate, "/two/{id}", "two"))
+	off := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/off", "off"), testRule(1, "b=1"))
+	if err := s.SetMockUrlStatus(ctx, off, model.StatusInactive); err != nil {
+		t.Fatal(err)
+	}
+	gone := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/gone", "gone"), testRule(1, "c=1"))
+	if err := s.DeleteMockUrl(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+
+	interfaces, rules, err := s.GetActiveMockUrls(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interfaces) != 2 || interfaces[0].ID != one || interfaces[1].ID != two {
+		t.Fatalf("GetActiveMockUrls returned %d interfaces, want %d and %d", len(interfaces), one, two)
+	}
+	if !reflect.DeepEqual(interfaces[0], mustGet(t, s, one)) {
+		t.Errorf("GetActiveMockUrls interface = %+v, want it as GetMockUrl returns it", interfaces[0])
+	}
+	if want := mustRules(t, s, one); !reflect.DeepEqual(rules[one], want) {
+		t.Errorf("GetActiveMockUrls rules = %+v, want them as GetRules returns them: %+v", rules[one], want)
+	}
+	if len(rules[two]) != 0 || len(rules[off]) != 0 || len(rules[gone]) != 0 {
+		t.Errorf("GetActiveMockUrls returned rules of %v, want only those of %d", rules, one)
+	}
+}
+
+func testRevisions(t *testing.T, s Storage) {
+	ctx := context.Background()
+	id := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/revisions", "default"))
+
+	for _, action := range []string{model.RevisionCreate, model.RevisionUpdate} {
+		rev := &model.Revision{InterfaceID: id, Action: action, Author: "alice", Snapshot: `{"action": "` + action + `"}`}
+		if err := s.SaveRevision(ctx, rev); err != nil {
+			t.Fatal(err)
+		}
+		if rev.ID == 0 || rev.CreatedAt.IsZero() {
+			t.Errorf("SaveRevision left ID %d and creation time %v", rev.ID, rev.CreatedAt)
+		}
+	}
+
+	revisions, err := s.GetRevisions(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 2 || revisions[0].Action != model.RevisionUpdate || revisions[1].Version != 1 {
+		t.Fatalf("GetRevisions = %+v, want versions 2 and 1", revisions)
+	}
+
+	latest, err := s.GetRevision(ctx, id, 0)
+	if err != nil || latest.Version != 2 || latest.Snapshot != `{"action": "update"}` || latest.Author != "alice" {
+		t.Errorf("GetRevision(latest) = %+v, %v, want version 2", latest, err)
+	}
+	first, err := s.GetRevision(ctx, id, 1)
+	if err != nil || first.Action != model.RevisionCreate {
+		t.Errorf("GetRevision(1) = %+v, %v, want the create revision", first, err)
+	}
+	if _, err := s.GetRevision(ctx, id, 3); err != sql.ErrNoRows {
+		t.Errorf("GetRevision of a missing version = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetRevision(ctx, id+100, 0); err != sql.ErrNoRows {
+		t.Errorf("GetRevision of an interface without revisions = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testVersion(t *testing.T, s Storage) {
+	ctx := context.Background()
+	r1, r2 := testRule(1, "a=1"), testRule(2, "a=2")
+	id := mustSave(t, s, testInterface("GET", model.URLTypeExact, "/version", "default"), r1, r2)
+
+	// Every change to the interface or its rules moves its version on
+	version := mustGet(t, s, id).Version
+	changes := []struct {
+		name   string
+		change func() error
+	}{
+		{"save rule", func() error { return s.SaveRule(ctx, id, testRule(3, "a=3")) }},
+		{"update rule", func() error { r1.ResponseBody = "changed"; return s.UpdateRule(ctx, r1) }},
+		{"reorder rules", func() error {
+			rules, err := s.GetRulesByInterfaceID(ctx, id)
+			if err != nil {
+				return err
+			}
+			ids := make([]int64, 0, len(rules))
+			for i := len(rules) - 1; i >= 0; i-- {
+				ids = append(ids, rules[i].ID)
+			}
+			return s.ReorderRules(ctx, id, ids)
+		}},
+		{"set rule status", func() error { return s.SetRuleStatus(ctx, r1.ID, model.StatusInactive) }},
+		{"delete rule", func() error { return s.DeleteRule(ctx, r2.ID) }},
+		{"replace rules", func() error { return s.ReplaceRules(ctx, id, nil) }},
+		{"set status", func() error { return s.SetMockUrlStatus(ctx, id, model.StatusInactive) }},
+		{"update", func() error {
+			iface := testInterface("GET", model.URLTypeExact, "/version", "updated")
+			iface.ID = id
+			return s.UpdateMockUrl(ctx, iface)
+		}},
+	}
+	for _, c := range changes {
+		if err := c.change(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		next := mustGet(t, s, id).Version
+		if next <= version {
+			t.Errorf("%s left the version at %d", c.name, next)
+		}
+		version = next
+	}
+
+	stale := testInterface("GET", model.URLTypeExact, "/version", "stale")
+	stale.ID = id
+	stale.Version = version - 1
+	if err := s.UpdateMockUrl(ctx, stale); err != ErrVersionConflict {
+		t.Errorf("UpdateMockUrl at an old version = %v, want ErrVersionConflict", err)
+	}
+	if got := mustGet(t, s, id); got.ResponseBody != "updated" || got.Version != version {
+		t.Errorf("a refused update changed the interface to %q at version %d", got.ResponseBody, got.Version)
+	}
+	stale.Version = version
+	if err := s.UpdateMockUrl(ctx, stale); err != nil {
+		t.Errorf("UpdateMockUrl at the current version: %v", err)
+	}
+
+	missing := testInterface("GET", model.URLTypeExact, "/missing", "")
+	missing.ID = id + 100
+	if err := s.UpdateMockUrl(ctx, missing); err != sql.ErrNoRows {
+		t.Errorf("UpdateMockUrl of a missing interface = %v, want sql.ErrNoRows", err)
+	}
+}